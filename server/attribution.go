@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Why a quote's attribution needs an admin to look at it.
+	reviewNoAttribution string = "No attribution found."
+	reviewUnknownUser   string = "%s isn't a user here."
+	reviewConflicting   string = "It could be from %s or %s."
+	reviewMidSentence   string = "The dash before %s isn't after the end of a sentence, so it might be part of the quote."
+)
+
+var (
+	// One speaker: "@shane", "Gus", or a name of up to four words.
+	speakerPattern = regexp.MustCompile(`^@?[\p{L}\p{N}_][\p{L}\p{N}_.'-]*(?: [\p{L}\p{N}_][\p{L}\p{N}_.'-]*){0,3}$`)
+
+	// What goes between speakers: "Gus, Rob", "Gus & Rob", "Gus and Rob".
+	speakerSeparatorPattern = regexp.MustCompile(`\s*(?:,|&|/|\band\b)\s*`)
+
+	// Attributions at the end of a quote: "... - Anthony", "... --@shane",
+	// "... -Shane", "... ~ Bob". A dash with spaces on both sides only counts
+	// after the end of a sentence (or line), so "Well - maybe" keeps its
+	// "maybe". Other dashes count anywhere, but unless they're before
+	// @usernames they could be part of the quote, like "up to 11 -- loud";
+	// the first group is set if it's after the end of a sentence.
+	dashAttributionPattern = regexp.MustCompile(`(?:([.!?"'”’)\n])\s*(?:--+|[-~—–])\s*|\s(?:--+|[~—–])\s*|\s-)(@?[\p{L}\p{N}_][\p{L}\p{N}_.'@,&/ -]{0,80}?)\s*$`)
+
+	// Dialogue: "Gus: '...' Rob: '...'". Each speaker starts the quote, a
+	// line, or follows the end of the last thing said.
+	dialoguePattern = regexp.MustCompile(`(?:^|[.!?"'”’]\s+|\n\s*)(@?[\p{L}][\p{L}\p{N}_.'-]*(?: [\p{L}][\p{L}\p{N}_.'-]*)?):\s`)
+
+	// Who passed it on, at the end of a quote: "(as paraphrased by
+	// Anthony)", "(via @shane)".
+	reportedAttributionPattern = regexp.MustCompile(`\((?:[^()]*\s)?(?:by|via|from)\s+(@?[\p{L}\p{N}_][\p{L}\p{N}_.'@,&/ -]{0,80}?)\s*\)[.!]?\s*$`)
+)
+
+// Speaker - Someone a quote is attributed to.
+type Speaker struct {
+	Name   string `json:"name"`              // As written in the quote, without any "@".
+	UserID string `json:"user_id,omitempty"` // Set if they're a user here; Name is their username.
+}
+
+// -----------------------------------------------------------------------------
+// Attribution parsing
+// -----------------------------------------------------------------------------
+
+// splitSpeakers - Split a list of speakers like "Gus and @rob" into names.
+// Returns nil if any of them doesn't look like a name; names need a letter,
+// so "-1" isn't from someone called 1.
+func splitSpeakers(text string) []string {
+	var names []string
+	for _, name := range speakerSeparatorPattern.Split(strings.TrimSpace(text), -1) {
+		name = strings.TrimRight(name, ".")
+		if speakerPattern.MatchString(name) == false || strings.IndexFunc(name, unicode.IsLetter) < 0 {
+			return nil
+		}
+
+		names = appendName(names, name)
+	}
+
+	return names
+}
+
+// appendName - Add name to names, unless it's already there.
+func appendName(names []string, name string) []string {
+	for idx := range names {
+		if strings.EqualFold(names[idx], name) {
+			return names
+		}
+	}
+
+	return append(names, name)
+}
+
+// ParseAttribution - Find who said a quote. Returns the speakers' names as
+// written (with any "@"), and why an admin should check them, if they
+// should.
+//
+// Dialogue ("Gus: '...' Rob: '...'") wins over an attribution at the end
+// ("... - Anthony"), which wins over who passed it on ("(via Anthony)"). If
+// more than one style finds different speakers, the first one is used but an
+// admin should check it. So should an attribution after a dash in the middle
+// of a sentence, unless something else agrees with it.
+func ParseAttribution(text string) ([]string, string) {
+	var found [][]string
+	unsure := ""
+
+	var dialogue []string
+	for _, match := range dialoguePattern.FindAllStringSubmatch(text, -1) {
+		dialogue = appendName(dialogue, match[1])
+	}
+	if len(dialogue) > 0 {
+		found = append(found, dialogue)
+	}
+
+	match := dashAttributionPattern.FindStringSubmatch(text)
+	if match != nil {
+		names := splitSpeakers(match[2])
+		if len(names) > 0 {
+			found = append(found, names)
+		}
+		if len(names) > 0 && match[1] == "" && allUsernames(names) == false {
+			unsure = fmt.Sprintf(reviewMidSentence, strings.Join(names, ", "))
+		}
+	}
+
+	match = reportedAttributionPattern.FindStringSubmatch(text)
+	if match != nil {
+		names := splitSpeakers(match[1])
+		if len(names) > 0 {
+			found = append(found, names)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, reviewNoAttribution
+	}
+
+	for idx := 1; idx < len(found); idx++ {
+		if sameNames(found[0], found[idx]) == false {
+			return found[0], fmt.Sprintf(reviewConflicting, strings.Join(found[0], ", "), strings.Join(found[idx], ", "))
+		}
+	}
+	if len(found) > 1 {
+		return found[0], ""
+	}
+
+	return found[0], unsure
+}
+
+// allUsernames - Are all of the names @usernames?
+func allUsernames(names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, "@") == false {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameNames - Do a and b have the same names, ignoring case and order?
+func sameNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, name := range b {
+		if len(appendName(a, name)) != len(a) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FormatSpeakers - Format speakers for humans, like "Gus, @shane".
+func FormatSpeakers(speakers []Speaker) string {
+	names := make([]string, 0, len(speakers))
+	for idx := range speakers {
+		if speakers[idx].UserID != "" {
+			names = append(names, "@"+speakers[idx].Name)
+		} else {
+			names = append(names, speakers[idx].Name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// ResolveSpeakers - Turn speakers' names into Speakers, linking the ones that
+// are users here. Returns why an admin should check them, if they should.
+//
+// "@name" has to be a user. A plain name is linked if it happens to be
+// someone's username, and is just a name otherwise; plenty of quotes are
+// from people who aren't on the server.
+func (p *QuotebotPlugin) ResolveSpeakers(names []string) ([]Speaker, string) {
+	speakers := make([]Speaker, 0, len(names))
+	review := ""
+	for _, name := range names {
+		username := strings.TrimPrefix(name, "@")
+		if strings.Contains(username, " ") == false { // Usernames don't have spaces.
+			user, err := p.API.GetUserByUsername(strings.ToLower(username))
+			if err == nil && user != nil {
+				speakers = append(speakers, Speaker{Name: user.Username, UserID: user.Id})
+				continue
+			}
+		}
+
+		if strings.HasPrefix(name, "@") && review == "" {
+			review = fmt.Sprintf(reviewUnknownUser, name)
+		}
+		speakers = append(speakers, Speaker{Name: username})
+	}
+
+	return speakers, review
+}
+
+// ParseSpeakers - Find who said the quote, linking them to users where we
+// can. Returns the speakers, and why an admin should check them, if they
+// should.
+func (p *QuotebotPlugin) ParseSpeakers(text string) ([]Speaker, string) {
+	names, review := ParseAttribution(text)
+	speakers, resolveReview := p.ResolveSpeakers(names)
+	if review == "" {
+		review = resolveReview
+	}
+
+	return speakers, review
+}
+
+// guessSpeakers - Work out who said a quote we haven't looked at yet. Older
+// quotes might have an author already; that's who said it. Otherwise the
+// text says.
+func (p *QuotebotPlugin) guessSpeakers(quote *Quote) ([]Speaker, string) {
+	if quote.Author != "" {
+		speakers, review := p.ResolveSpeakers(splitSpeakers(quote.Author))
+		if len(speakers) > 0 {
+			return speakers, review
+		}
+	}
+
+	return p.ParseSpeakers(quote.Text)
+}
+
+// AttributeQuotes - Work out who said the quotes in store that we haven't
+// looked at yet, like the ones added before we parsed attributions. Returns
+// how many quotes were attributed.
+func (p *QuotebotPlugin) AttributeQuotes(store QuoteStore) (int, *model.AppError) {
+	quotes, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for idx := range quotes {
+		if quotes[idx].IsAttributed() {
+			continue
+		}
+
+		speakers, review := p.guessSpeakers(&quotes[idx])
+		text := quotes[idx].Text
+		changed, err := store.Update(quotes[idx].ID, func(quote *Quote) bool {
+			if quote.IsAttributed() || quote.Text != text {
+				return false // Someone beat us to it.
+			}
+
+			quote.SetSpeakers(speakers, review, "")
+			return true
+		})
+		if err != nil {
+			return count, err
+		}
+		if changed {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAttribution - Test the ParseAttribution function.
+func TestParseAttribution(t *testing.T) {
+	names, review := ParseAttribution("There's lots of primes! - Anthony")
+	assert.EqualValues(t, names, []string{"Anthony"})
+	assert.EqualValues(t, review, "")
+
+	names, review = ParseAttribution("I feel pretty --@shane")
+	assert.EqualValues(t, names, []string{"@shane"})
+	assert.EqualValues(t, review, "")
+
+	names, review = ParseAttribution("I feel pretty. -Shane")
+	assert.EqualValues(t, names, []string{"Shane"})
+	assert.EqualValues(t, review, "")
+
+	names, review = ParseAttribution("Primes are odd\n— Gus")
+	assert.EqualValues(t, names, []string{"Gus"})
+	assert.EqualValues(t, review, "")
+
+	names, _ = ParseAttribution("“I feel pretty.” — Shane Smith.")
+	assert.EqualValues(t, names, []string{"Shane Smith"})
+
+	names, _ = ParseAttribution("It works on my machine. ~ Gus and @rob")
+	assert.EqualValues(t, names, []string{"Gus", "@rob"})
+
+	names, review = ParseAttribution("Gus: 'There's lots of primes!' Rob: 'Name one.' Gus: '2.'")
+	assert.EqualValues(t, names, []string{"Gus", "Rob"})
+	assert.EqualValues(t, review, "")
+
+	names, review = ParseAttribution("Mistakes were made. (as paraphrased by Anthony)")
+	assert.EqualValues(t, names, []string{"Anthony"})
+	assert.EqualValues(t, review, "")
+
+	// More than one style that agree.
+	names, review = ParseAttribution("Gus: 'There's lots of primes!' - gus")
+	assert.EqualValues(t, names, []string{"Gus"})
+	assert.EqualValues(t, review, "")
+
+	// More than one style that don't.
+	names, review = ParseAttribution("Gus: 'There's lots of primes!' (via Anthony)")
+	assert.EqualValues(t, names, []string{"Gus"})
+	assert.EqualValues(t, review, "It could be from Gus or Anthony.")
+
+	// Dashes in the middle of a sentence might be part of the quote.
+	midSentence := map[string]string{
+		"I feel pretty -Shane":                  "Shane",
+		"I was going to go — but then I didn't": "but then I didn't",
+		"Turn it up to 11 -- loud":              "loud",
+	}
+	for text, name := range midSentence {
+		names, review = ParseAttribution(text)
+		assert.EqualValues(t, names, []string{name}, text)
+		assert.EqualValues(t, review, "The dash before "+name+" isn't after the end of a sentence, so it might be part of the quote.", text)
+	}
+
+	// Unless something else agrees.
+	names, review = ParseAttribution("Gus: 'Turn it up to 11' -- Gus")
+	assert.EqualValues(t, names, []string{"Gus"})
+	assert.EqualValues(t, review, "")
+
+	// Nobody.
+	names, review = ParseAttribution("The answer is -1")
+	assert.Nil(t, names)
+	assert.EqualValues(t, review, "No attribution found.")
+
+	names, review = ParseAttribution("Well - maybe")
+	assert.Nil(t, names)
+	assert.EqualValues(t, review, "No attribution found.")
+
+	names, review = ParseAttribution("quote 1")
+	assert.Nil(t, names)
+	assert.EqualValues(t, review, "No attribution found.")
+}
+
+// TestFormatSpeakers - Test the FormatSpeakers function.
+func TestFormatSpeakers(t *testing.T) {
+	assert.EqualValues(t, FormatSpeakers(nil), "")
+	assert.EqualValues(t, FormatSpeakers([]Speaker{{Name: "Gus"}, {Name: "shane", UserID: "shaneid"}}), "Gus, @shane")
+}
+
+// TestResolveSpeakers - Test the ResolveSpeakers function.
+func TestResolveSpeakers(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+
+	speakers, review := p.ResolveSpeakers([]string{"Gus", "Shane", "Shane Smith"})
+	assert.EqualValues(t, speakers, []Speaker{{Name: "Gus"}, {Name: "shane", UserID: "shaneid"}, {Name: "Shane Smith"}})
+	assert.EqualValues(t, review, "")
+
+	speakers, review = p.ResolveSpeakers([]string{"@shane", "@gus"})
+	assert.EqualValues(t, speakers, []Speaker{{Name: "shane", UserID: "shaneid"}, {Name: "gus"}})
+	assert.EqualValues(t, review, "@gus isn't a user here.")
+}
+
+// TestAttributeQuotes - Test the AttributeQuotes function.
+func TestAttributeQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	store := NewMemoryQuoteStore()
+
+	store.Add(Quote{Text: "I feel pretty --@shane"})
+	store.Add(Quote{Text: "Some quote", Author: "Gus"})
+	store.Add(Quote{Text: "quote 3"})
+	store.Add(Quote{Text: "Done already. - Rob", Speakers: []Speaker{{Name: "Bob"}}})
+
+	count, err := p.AttributeQuotes(store)
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 3)
+
+	quotes, _ := store.List()
+	assert.EqualValues(t, quotes[0].Speakers, []Speaker{{Name: "shane", UserID: "shaneid"}})
+	assert.EqualValues(t, quotes[0].Author, "@shane")
+	assert.EqualValues(t, quotes[0].AuthorReview, "")
+	assert.EqualValues(t, quotes[1].Speakers, []Speaker{{Name: "Gus"}})
+	assert.Nil(t, quotes[2].Speakers)
+	assert.EqualValues(t, quotes[2].AuthorReview, "No attribution found.")
+	assert.EqualValues(t, quotes[3].Speakers, []Speaker{{Name: "Bob"}})
+
+	// Only once.
+	count, err = p.AttributeQuotes(store)
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 0)
+}
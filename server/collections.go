@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// The collection everyone used before there were collections. It's also
+	// the one every team uses when SharedQuotes is on.
+	sharedCollection string = ""
+
+	teamCollectionPrefix    string = "team_"
+	channelCollectionPrefix string = "channel_"
+
+	hereFlag string = "--here" // Use the channel's own quotes.
+
+	// Key-value store key listing every collection that's been used, so we
+	// can look after them (emptying the trash, for example) even if nobody
+	// has used them since we started.
+	collectionsKey string = "quote_collections"
+
+	// The shared collection's file when the QuoteDirectory setting is used;
+	// the others are named after their collection.
+	sharedCollectionFile string = "quotes.json"
+)
+
+// -----------------------------------------------------------------------------
+// Quote collections
+// -----------------------------------------------------------------------------
+
+// teamCollection - The name of a team's collection.
+func teamCollection(teamID string) string {
+	return teamCollectionPrefix + teamID
+}
+
+// channelCollection - The name of a channel's collection.
+func channelCollection(channelID string) string {
+	return channelCollectionPrefix + channelID
+}
+
+// keyCollection - The name of the collection a key-value store key belongs
+// to, going by its prefix. Keys without a team's or channel's prefix belong
+// to the shared collection.
+func keyCollection(key string) string {
+	for _, prefix := range []string{teamCollectionPrefix, channelCollectionPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			end := strings.Index(key[len(prefix):], "_")
+			if end > 0 {
+				return key[:len(prefix)+end]
+			}
+		}
+	}
+
+	return sharedCollection
+}
+
+// Store - The quotes for the given team. That's the team's own collection,
+// unless quotes are shared between teams.
+func (p *QuotebotPlugin) Store(teamID string) QuoteStore {
+	if teamID == "" || p.getConfiguration().SharedQuotes {
+		return p.collection(sharedCollection)
+	}
+
+	return p.collection(teamCollection(teamID))
+}
+
+// commandStore - The quotes a command works on: the channel's own if tail
+// has the --here flag, otherwise the team's. Returns the rest of tail, and a
+// response if the user isn't allowed to use the channel's quotes.
+func (p *QuotebotPlugin) commandStore(args *model.CommandArgs, tail string) (QuoteStore, string, *model.CommandResponse) {
+	tail, here := takeFlag(tail, hereFlag)
+	if here == false {
+		return p.Store(args.TeamId), tail, nil
+	}
+
+	// Channel quotes are for the channel's members.
+	if p.IsChannelMember(args.ChannelId, args.UserId) == false {
+		return nil, tail, p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only members of this channel can use its quotes.")
+	}
+
+	return p.collection(channelCollection(args.ChannelId)), tail, nil
+}
+
+// collection - The store for the named collection, opening it the first time
+// it's used.
+func (p *QuotebotPlugin) collection(name string) QuoteStore {
+	p.storeLock.Lock()
+	defer p.storeLock.Unlock()
+
+	store, ok := p.stores[name]
+	if ok {
+		return store
+	}
+
+	if p.stores == nil {
+		p.stores = make(map[string]QuoteStore)
+	}
+	store = p.openCollection(name)
+	p.stores[name] = store
+
+	err := p.registerCollection(name)
+	if err != nil {
+		// It still works, we just might not empty its trash until it's used.
+		p.API.LogWarn("Unable to register quote collection.", "error", err.Error())
+	}
+
+	return store
+}
+
+// openCollection - Open the store for the named collection. That's a file in
+// the QuoteDirectory setting's directory if it's set, otherwise the key-value
+// store.
+func (p *QuotebotPlugin) openCollection(name string) QuoteStore {
+	directory := p.getConfiguration().QuoteDirectory
+	if directory == "" {
+		return NewKVQuoteStore(p.API, name)
+	}
+
+	path := filepath.Join(directory, sharedCollectionFile)
+	if name != sharedCollection {
+		path = filepath.Join(directory, name+".json")
+	}
+	store, err := NewFileQuoteStore(path)
+	if err != nil {
+		// Better the key-value store's quotes than none at all.
+		p.API.LogError("Unable to open quote file, using the key-value store.", "error", err.Error())
+		return NewKVQuoteStore(p.API, name)
+	}
+
+	return store
+}
+
+// closeCollections - Forget the collections we've opened, so they're opened
+// again the next time they're used.
+func (p *QuotebotPlugin) closeCollections() {
+	p.storeLock.Lock()
+	defer p.storeLock.Unlock()
+
+	p.stores = nil
+}
+
+// collectionName - The name of the collection store is, if it's one we've
+// opened.
+func (p *QuotebotPlugin) collectionName(store QuoteStore) (string, bool) {
+	p.storeLock.Lock()
+	defer p.storeLock.Unlock()
+
+	for name := range p.stores {
+		if p.stores[name] == store {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// loadCollections - Load the names of the registered collections, and their
+// raw value for compare-and-set.
+func (p *QuotebotPlugin) loadCollections() ([]string, []byte, *model.AppError) {
+	var names []string
+	raw, err := p.loadJSONKey(collectionsKey, &names, "quote collections")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return names, raw, nil
+}
+
+// registerCollection - Add a collection to the list of collections, if it
+// isn't there already. The shared collection is always there.
+func (p *QuotebotPlugin) registerCollection(name string) *model.AppError {
+	if name == sharedCollection {
+		return nil
+	}
+
+	var names []string
+	return p.updateJSONKey(collectionsKey, &names, "quote collections", func() bool {
+		idx := sort.SearchStrings(names, name)
+		if idx < len(names) && names[idx] == name {
+			return false
+		}
+
+		names = append(names, "")
+		copy(names[idx+1:], names[idx:])
+		names[idx] = name
+
+		return true
+	})
+}
+
+// collections - The names of every collection, starting with the shared one.
+func (p *QuotebotPlugin) collections() ([]string, *model.AppError) {
+	names, _, err := p.loadCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{sharedCollection}, names...), nil
+}
+
+// movedQuoteKey - Something that identifies a quote even after it's been
+// moved to another collection.
+func movedQuoteKey(quote Quote) string {
+	return fmt.Sprintf("%d/%d/%s/%s", quote.ID, quote.CreateAt, quote.UserID, quote.Text)
+}
+
+// MigrateSharedQuotes - Move every quote in the shared collection, trash and
+// all, to the named team's collection.
+//
+// The quotes keep their numbers, and quotes in the trash keep when they were
+// deleted, so the team's collection has to be empty, or only have quotes
+// from an interrupted migration; a team that already has quotes of its own
+// is left alone.
+func (p *QuotebotPlugin) MigrateSharedQuotes(teamName string) *model.AppError {
+	team, err := p.API.GetTeamByName(teamName)
+	if err != nil || team == nil {
+		return p.NewError("Unable to migrate quotes.", fmt.Sprintf("%q isn't a team.", teamName), "MigrateSharedQuotes")
+	}
+
+	from := p.collection(sharedCollection)
+	to := p.collection(teamCollection(team.Id))
+
+	quotes, err := from.List()
+	if err != nil {
+		return err
+	}
+	trash, err := from.Trash()
+	if err != nil {
+		return err
+	}
+	if len(quotes) == 0 && len(trash) == 0 {
+		return nil
+	}
+	lastID, err := from.LastID()
+	if err != nil {
+		return err
+	}
+
+	// Anything the team has must be a copy from an earlier try.
+	shared := make(map[string]bool)
+	for _, quote := range append(quotes, trash...) {
+		shared[movedQuoteKey(quote)] = true
+	}
+	existing, err := to.List()
+	if err != nil {
+		return err
+	}
+	existingTrash, err := to.Trash()
+	if err != nil {
+		return err
+	}
+	existingLastID, err := to.LastID()
+	if err != nil {
+		return err
+	}
+	for _, quote := range append(existing, existingTrash...) {
+		if shared[movedQuoteKey(quote)] == false {
+			return p.NewError("Unable to migrate quotes.",
+				fmt.Sprintf("Team %q already has quotes of its own, so the shared quotes can't keep their numbers.", teamName), "MigrateSharedQuotes")
+		}
+	}
+	if existingLastID > lastID {
+		return p.NewError("Unable to migrate quotes.",
+			fmt.Sprintf("Team %q has already used quote numbers the shared quotes don't have.", teamName), "MigrateSharedQuotes")
+	}
+
+	p.API.LogInfo("Moving the shared quotes to a team.", "team", teamName)
+
+	_, err = p.automaticSnapshot("", "moving the shared quotes to "+teamName)
+	if err != nil {
+		return err
+	}
+
+	for idx := range quotes {
+		quotes[idx].TeamID = team.Id
+	}
+	for idx := range trash {
+		trash[idx].TeamID = team.Id
+	}
+	err = to.Replace(lastID, quotes, trash)
+	if err != nil {
+		return err
+	}
+
+	// Everything's safely in the team's collection, so empty the shared one.
+	// It keeps its last ID, so its numbers aren't handed out again.
+	return from.Replace(lastID, nil, nil)
+}
+
+// warnAboutSharedQuotes - Quotes from before there were teams don't show up
+// anywhere until an admin picks a team for them, so remind them.
+func (p *QuotebotPlugin) warnAboutSharedQuotes() {
+	store := p.collection(sharedCollection)
+	count, err := store.Count()
+	if err != nil {
+		p.API.LogError("Unable to count the shared quotes.", "error", err.Error())
+		return
+	}
+	trash, err := store.Trash()
+	if err != nil {
+		p.API.LogError("Unable to count the shared quotes.", "error", err.Error())
+		return
+	}
+
+	if count+len(trash) > 0 {
+		p.API.LogWarn("There are quotes from before there were teams that no team can see. "+
+			"Set Move Shared Quotes To Team to give them to a team, or turn on Share Quotes Between Teams.", "count", count+len(trash))
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Quote collections
+// -----------------------------------------------------------------------------
+
+// TestStore - Test the Store function.
+func TestStore(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	// Every team gets its own quotes.
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	args := testCommandArgs("")
+	args.TeamId = "otherteamid"
+	resp, err := p.AddQuote(args, "other quote 1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Added \"other quote 1\" as quote number 1.")
+
+	resp, err = p.ShowQuote(args, "1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "> other quote 1")
+	resp, err = p.ShowQuote(testCommandArgs(""), "1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "> quote 1")
+
+	assert.True(t, p.Store("teamid") == p.Store("teamid"))
+	assert.False(t, p.Store("teamid") == p.Store("otherteamid"))
+	assert.True(t, p.Store("") == p.collection(sharedCollection))
+
+	names, err := p.collections()
+	assert.Nil(t, err)
+	assert.EqualValues(t, names, []string{sharedCollection, teamCollection("otherteamid"), teamCollection("teamid")})
+
+	// Unless they're sharing.
+	configuration := p.getConfiguration().Clone()
+	configuration.SharedQuotes = true
+	p.setConfiguration(configuration)
+
+	assert.True(t, p.Store("teamid") == p.collection(sharedCollection))
+	assert.True(t, p.Store("otherteamid") == p.collection(sharedCollection))
+
+	// Keys belong to the collection in their prefix.
+	assert.EqualValues(t, keyCollection("team_teamid_"+quoteKey(1)), teamCollection("teamid"))
+	assert.EqualValues(t, keyCollection("channel_channelid_"+lastQuoteIDKey), channelCollection("channelid"))
+	assert.EqualValues(t, keyCollection(quoteKey(1)), sharedCollection)
+	assert.EqualValues(t, keyCollection(collectionsKey), sharedCollection)
+}
+
+// TestQuoteDirectory - The QuoteDirectory setting keeps the quotes in files.
+func TestQuoteDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotebot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	configuration := p.getConfiguration().Clone()
+	configuration.QuoteDirectory = dir
+	p.setConfiguration(configuration)
+	p.closeCollections()
+
+	p.AddQuote(testCommandArgs(""), "team quote 1")
+	p.AddQuote(testCommandArgs(""), "--here channel quote 1")
+	resp, appErr := p.ShowQuote(testCommandArgs(""), "1")
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, resp.Text, "> team quote 1")
+
+	_, ok := p.Store("teamid").(*FileQuoteStore)
+	assert.True(t, ok)
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.EqualValues(t, names, []string{"channel_channelid.json", "team_teamid.json"})
+
+	// The shared collection has the old name.
+	configuration = p.getConfiguration().Clone()
+	configuration.SharedQuotes = true
+	p.setConfiguration(configuration)
+	p.AddQuote(testCommandArgs(""), "shared quote 1")
+	_, err = os.Stat(filepath.Join(dir, sharedCollectionFile))
+	assert.Nil(t, err)
+
+	// Without it, the quotes are back in the key-value store.
+	assert.Nil(t, p.OnConfigurationChange())
+	_, ok = p.Store("teamid").(*KVQuoteStore)
+	assert.True(t, ok)
+	resp, appErr = p.ShowQuote(testCommandArgs(""), "1")
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
+
+	// A file we can't read leaves the quotes in the key-value store.
+	err = ioutil.WriteFile(filepath.Join(dir, "team_otherteamid.json"), []byte("not json"), 0600)
+	assert.Nil(t, err)
+	configuration = p.getConfiguration().Clone()
+	configuration.QuoteDirectory = dir
+	p.setConfiguration(configuration)
+	p.closeCollections()
+	_, ok = p.Store("otherteamid").(*KVQuoteStore)
+	assert.True(t, ok)
+}
+
+// TestMigrateSharedQuotes - Test the MigrateSharedQuotes function.
+func TestMigrateSharedQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	err := p.MigrateSharedQuotes("fail")
+	assert.NotNil(t, err)
+
+	// Nothing to move.
+	assert.Nil(t, p.MigrateSharedQuotes("team"))
+	assert.EqualValues(t, len(testQuotes(t, p)), 0)
+
+	shared := p.collection(sharedCollection)
+	shared.Add(Quote{Text: "quote 1", UserID: "userid"})
+	shared.Add(Quote{Text: "quote 2", UserID: "userid"})
+	shared.Add(Quote{Text: "quote 3", UserID: "userid"})
+	shared.Add(Quote{Text: "quote 4", UserID: "userid"})
+	shared.Add(Quote{Text: "quote 5", UserID: "userid"})
+	shared.Delete(2, "deleter")
+	shared.Delete(4, "deleter")
+	shared.Purge(model.GetMillis() + 1) // Leaves gaps where 2 and 4 were.
+	shared.Delete(3, "deleter")
+	before, appErr := shared.Trash()
+	assert.Nil(t, appErr)
+
+	assert.Nil(t, p.MigrateSharedQuotes("team"))
+
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].ID, 1)
+	assert.EqualValues(t, quotes[0].Text, "quote 1")
+	assert.EqualValues(t, quotes[0].TeamID, "teamid")
+	assert.EqualValues(t, quotes[1].ID, 5)
+	assert.EqualValues(t, quotes[1].Text, "quote 5")
+
+	// The trash keeps when they were deleted.
+	trash, appErr := p.Store("teamid").Trash()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, len(trash), 1)
+	assert.EqualValues(t, trash[0].ID, 3)
+	assert.EqualValues(t, trash[0].DeletedBy, "deleter")
+	assert.EqualValues(t, trash[0].DeleteAt, before[0].DeleteAt)
+
+	infos, appErr := p.Snapshots()
+	assert.Nil(t, appErr)
+	if assert.EqualValues(t, len(infos), 1) {
+		assert.EqualValues(t, infos[0].Reason, "moving the shared quotes to team")
+	}
+
+	// Numbers aren't handed out again, by the team or the shared collection.
+	added, appErr := p.Store("teamid").Add(Quote{Text: "quote 6"})
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, added.ID, 6)
+	lastID, appErr := shared.LastID()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, lastID, 5)
+
+	count, appErr := shared.Count()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, count, 0)
+	trash, appErr = shared.Trash()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, len(trash), 0)
+
+	// Moving them again doesn't change anything.
+	assert.Nil(t, p.MigrateSharedQuotes("team"))
+	assert.EqualValues(t, len(testQuotes(t, p)), 3)
+
+	// A team with quotes of its own is left alone.
+	shared.Replace(5, []Quote{{ID: 1, Text: "quote 1", UserID: "userid"}}, nil)
+	assert.NotNil(t, p.MigrateSharedQuotes("team"))
+	assert.EqualValues(t, len(testQuotes(t, p)), 3)
+	count, appErr = shared.Count()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, count, 1)
+}
+
+// TestMigrateSharedQuotesInterrupted - A move that stopped before emptying the
+// shared collection picks up where it left off.
+func TestMigrateSharedQuotesInterrupted(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	shared := p.collection(sharedCollection)
+	shared.Add(Quote{Text: "quote 1", UserID: "userid"})
+	shared.Add(Quote{Text: "quote 2", UserID: "userid"})
+	quotes, appErr := shared.List()
+	assert.Nil(t, appErr)
+
+	// The team got its copy, but the shared collection wasn't emptied.
+	copies := append([]Quote(nil), quotes...)
+	for idx := range copies {
+		copies[idx].TeamID = "teamid"
+	}
+	assert.Nil(t, p.Store("teamid").Replace(2, copies[:1], nil))
+
+	assert.Nil(t, p.MigrateSharedQuotes("team"))
+	moved := testQuotes(t, p)
+	assert.EqualValues(t, len(moved), 2)
+	assert.EqualValues(t, moved[1].ID, 2)
+	assert.EqualValues(t, moved[1].Text, "quote 2")
+	count, appErr := shared.Count()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, count, 0)
+}
+
+// TestChannelQuotes - Test using a channel's own quotes with --here.
+func TestChannelQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ShowQuote(testCommandArgs(""), "--here")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "--here war story 1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Added \"war story 1\" as quote number 1.")
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "--here")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "> war story 1")
+	resp, err = p.ShowQuote(testCommandArgs(""), "--here 1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "> war story 1")
+
+	// They don't leak into the team's quotes.
+	resp, err = p.ShowQuote(testCommandArgs(""), "1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "> quote 1")
+	assert.EqualValues(t, len(testQuotes(t, p)), 1)
+
+	resp, err = p.EditQuote(testCommandArgs(""), "--here 1 war story one")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is now \"war story one\".")
+	resp, err = p.ShowHistory(testCommandArgs(""), "--here 1")
+	assert.Nil(t, err)
+	assert.Contains(t, resp.Text, "Quote 1 has 2 versions.")
+
+	// Only the channel's members can use them.
+	args := testCommandArgs("")
+	args.ChannelId = "otherchannelid"
+	resp, err = p.ShowQuote(args, "--here")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only members of this channel can use its quotes.")
+	resp, err = p.AddQuote(args, "--force --here war story 2")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only members of this channel can use its quotes.")
+
+	names, err := p.collections()
+	assert.Nil(t, err)
+	assert.Contains(t, names, channelCollection("channelid"))
+	assert.NotContains(t, names, channelCollection("otherchannelid"))
+}
@@ -2,66 +2,332 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/mattermost/mattermost-server/model"
 )
 
 // -----------------------------------------------------------------------------
 // Quotebot admin-only commands
+//
+// ExecuteCommand only runs these for admins; their permission is in router.go.
 // -----------------------------------------------------------------------------
 
+// AuthorQuote - Say who said the specified quote, like "Gus and @shane",
+// overriding whoever we thought said it. With nobody, show who said it.
+func (p *QuotebotPlugin) AuthorQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, who, err := splitQuoteNumber(tail)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't change who said quote %d, it doesn't exist.", num)), nil
+	}
+	if who == "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, describeSpeakers(quote)), nil
+	}
+
+	names := splitSpeakers(who)
+	if len(names) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("%q doesn't look like anyone. Use names or @usernames, like Gus and @shane.", who)), nil
+	}
+
+	speakers, review := p.ResolveSpeakers(names)
+	if review != "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, review), nil
+	}
+
+	changed, appErr := store.Update(num, func(quote *Quote) bool {
+		quote.SetSpeakers(speakers, "", args.UserId)
+		return true
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	if changed == false {
+		// Deleted out from under us.
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't change who said quote %d, it doesn't exist.", num)), nil
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Quote %d is from %s.", num, FormatSpeakers(speakers))), nil
+}
+
 // DeleteQuote - Delete the specified quote.
-func (p *QuotebotPlugin) DeleteQuote(userID string, tail string) (*model.CommandResponse, *model.AppError) {
-	if p.IsAdmin(userID) == false {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only admins can delete quotes."), nil
+func (p *QuotebotPlugin) DeleteQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
 	}
 
 	num, err := strconv.Atoi(tail)
 	if err != nil {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote index."), nil
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
 	}
 
-	quoteIdx := num - 1 // The list is 1-based for humans.
-	if quoteIdx < 0 || len(p.quotes) == 0 || quoteIdx >= len(p.quotes) {
+	// Snapshot first, in case it's the wrong quote.
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote != nil {
+		_, appErr = p.automaticSnapshot(args.UserId, fmt.Sprintf("deleting quote %d", num))
+		if appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	// Quote numbers stay put; the rest of the quotes don't get renumbered.
+	deleted, appErr := store.Delete(num, args.UserId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if deleted == false {
+		lastID, appErr := store.LastID()
+		if appErr != nil {
+			return nil, appErr
+		}
+		if num > 0 && num <= lastID {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				fmt.Sprintf("Quote %d was already deleted.", num)), nil
+		}
+
 		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
 			fmt.Sprintf("You can't delete quote %d, it doesn't exist.", num)), nil
 	}
 
-	p.quotes = append(p.quotes[:quoteIdx], p.quotes[quoteIdx+1:]...)
-	saveErr := p.SaveQuotes()
-	if saveErr != nil {
-		return nil, saveErr
+	count, appErr := store.Count()
+	if appErr != nil {
+		return nil, appErr
 	}
 
 	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-		fmt.Sprintf("Deleted quote %d. There are %d quotes on file.", num, len(p.quotes))), nil
+		fmt.Sprintf("Moved quote %d to the trash. There are %d quotes on file.", num, count)), nil
 }
 
-// ListQuotes - List the known quotes.
-func (p *QuotebotPlugin) ListQuotes(userID string) (*model.CommandResponse, *model.AppError) {
-	if p.IsAdmin(userID) == false {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only admins can list the quotes."), nil
+// ExportQuotes - Send the admin every quote, and everything we know about
+// them, as a file in a direct message. The file is JSON, CSV or Markdown;
+// /quote import can bring a JSON export back exactly.
+func (p *QuotebotPlugin) ExportQuotes(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
 	}
 
-	response := fmt.Sprintf("There are %d quotes on file.", len(p.quotes))
+	format := strings.ToLower(strings.TrimSpace(tail))
+	if format == "" {
+		format = exportJSON
+	}
 
-	for idx := range p.quotes {
-		// The list is 1-based for humans.
-		response += fmt.Sprintf("\n* %d = %q", idx+1, p.quotes[idx])
+	export, appErr := NewQuoteExport(store)
+	if appErr != nil {
+		return nil, appErr
+	}
+	data, err := export.Format(format)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Quotes can be exported as %s, %s or %s.", exportJSON, exportCSV, exportMarkdown)), nil
 	}
 
-	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+	name := fmt.Sprintf("quotes-%s.%s", time.Unix(0, export.ExportedAt*int64(time.Millisecond)).UTC().Format("2006-01-02"), format)
+	appErr = p.SendFile(args.UserId, name, data,
+		fmt.Sprintf("Here are the %d quotes, and %d in the trash.", len(export.Quotes), len(export.Trash)))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Sent you %s in a direct message.", name)), nil
 }
 
-// SetChannel - Set the channel the bot monitors.
-func (p *QuotebotPlugin) SetChannel(userID string, channel string, teamID string) (*model.CommandResponse, *model.AppError) {
-	if p.IsAdmin(userID) == false {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only admins can set the channel."), nil
+// ImportQuotes - Add the quotes and responses in the files attached to a post,
+// skipping the ones we already have. The post is the one in tail, or the one
+// the command is replying to.
+func (p *QuotebotPlugin) ImportQuotes(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	postID := args.RootId
+	if strings.TrimSpace(tail) != "" {
+		postID = importPostID(tail)
 	}
+	if postID == "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			"What file? Attach it to a post, then reply to the post with /quote import, or use /quote import *link to the post*."), nil
+	}
+
+	// Only import what the admin can see.
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil || post == nil || p.IsChannelMember(post.ChannelId, args.UserId) == false {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "I can't find that post."), nil
+	}
+	if len(post.FileIds) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "That post doesn't have any files to import."), nil
+	}
+
+	var lines []string
+	for _, fileID := range post.FileIds {
+		info, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if info.Size > maxImportFileSize {
+			lines = append(lines, fmt.Sprintf("%s: too big to import.", info.Name))
+			continue
+		}
+
+		raw, appErr := p.API.GetFile(fileID)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		file, err := ParseImport(raw)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: not a quotes or responses file I understand (%v).", info.Name, err))
+			continue
+		}
 
+		result, appErr := p.importFile(args, store, file)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		lines = append(lines, describeImport(info.Name, result))
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, strings.Join(lines, "\n")), nil
+}
+
+// ReindexQuotes - Rebuild the search index, in case it's been damaged.
+func (p *QuotebotPlugin) ReindexQuotes(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, _, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	count, err := store.Reindex()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Rebuilt the search index for %d quotes.", count)), nil
+}
+
+// RestoreQuote - Bring the specified quote back from the trash.
+func (p *QuotebotPlugin) RestoreQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, err := strconv.Atoi(tail)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+
+	restored, appErr := store.Restore(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if restored == false {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't restore quote %d, it isn't in the trash.", num)), nil
+	}
+
+	count, appErr := store.Count()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Restored quote %d. There are %d quotes on file.", num, count)), nil
+}
+
+// RollbackSnapshot - Put everything back the way it was in the named
+// snapshot. The caller must hold stateLock for writing.
+func (p *QuotebotPlugin) RollbackSnapshot(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	name := NormalizeSnapshotName(tail)
+	if name == "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			"Which snapshot? Use /quote snapshots to list them."), nil
+	}
+
+	info, appErr := p.FindSnapshot(name)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if info == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("There isn't a snapshot called %q. Use /quote snapshots to list them.", name)), nil
+	}
+
+	undo, appErr := p.Rollback(name, args.UserId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Rolled back to snapshot %q from %s. To undo it, use /quote rollback %s.",
+			name, FormatTime(info.CreateAt), undo.Name)), nil
+}
+
+// SaveSnapshot - Save a copy of everything as a snapshot, named after the
+// time if it isn't given a name.
+func (p *QuotebotPlugin) SaveSnapshot(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	name := strings.TrimSpace(tail)
+	if name == "" {
+		name = time.Now().UTC().Format("2006-01-02-150405")
+	}
+	if NormalizeSnapshotName(name) == "" || strings.HasPrefix(NormalizeSnapshotName(name), automaticSnapshotPrefix) {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Snapshot names have up to %d letters, numbers, ., - and _, and don't start with %q.",
+				snapshotNameMaxLength, automaticSnapshotPrefix)), nil
+	}
+	name = NormalizeSnapshotName(name)
+
+	existing, appErr := p.FindSnapshot(name)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if existing != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("There's already a snapshot called %q.", name)), nil
+	}
+
+	info, appErr := p.Snapshot(name, args.UserId, "")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Saved snapshot %q. To go back to it, use /quote rollback %s.", info.Name, info.Name)), nil
+}
+
+// SetChannel - Set the channel the bot monitors. With --here, the bot posts
+// the channel's own quotes there instead of the team's.
+func (p *QuotebotPlugin) SetChannel(channel string, teamID string) (*model.CommandResponse, *model.AppError) {
+	channel, here := takeFlag(channel, hereFlag)
+	channel = strings.TrimSpace(channel)
 	if len(channel) == 0 || channel == "~" {
 		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You must specify a channel name."), nil
 	}
@@ -76,17 +342,20 @@ func (p *QuotebotPlugin) SetChannel(userID string, channel string, teamID string
 			fmt.Sprintf("%q isn't a valid channel, use one that exists.", channel)), nil
 	}
 
-	p.configuration.postChannel = newChannel.DisplayName
-	p.channelID = newChannel.Id
+	configuration := p.getConfiguration().Clone()
+	configuration.postChannel = newChannel.DisplayName
+	configuration.postChannelQuotes = here
+	p.setConfiguration(configuration)
+	p.setPostTarget(newChannel.Id, newChannel.TeamId)
+	if here {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Channel set to %s, using its own quotes.", newChannel.DisplayName)), nil
+	}
 	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Channel set to %s.", newChannel.DisplayName)), nil
 }
 
 // SetInterval - Set the response interval, in minutes.
-func (p *QuotebotPlugin) SetInterval(userID string, tail string) (*model.CommandResponse, *model.AppError) {
-	if p.IsAdmin(userID) == false {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only admins can set the interval."), nil
-	}
-
+func (p *QuotebotPlugin) SetInterval(tail string) (*model.CommandResponse, *model.AppError) {
 	interval, err := strconv.Atoi(tail)
 	if err != nil {
 		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -102,92 +371,732 @@ func (p *QuotebotPlugin) SetInterval(userID string, tail string) (*model.Command
 			"You can't set the Interval to more than a week, that's excessive."), nil
 	}
 
-	p.configuration.postDelta = float64(interval)
+	configuration := p.getConfiguration().Clone()
+	configuration.postDelta = float64(interval)
+	p.setConfiguration(configuration)
 	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-		fmt.Sprintf("Interval set to %v minutes.", p.configuration.postDelta)), nil
+		fmt.Sprintf("Interval set to %v minutes.", configuration.postDelta)), nil
+}
+
+// ShowAuthors - Work out who said the quotes we haven't looked at yet, then
+// list the ones an admin should check.
+func (p *QuotebotPlugin) ShowAuthors(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, _, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	_, err := p.AttributeQuotes(store)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var review []Quote
+	for idx := range quotes {
+		if quotes[idx].AuthorReview != "" {
+			review = append(review, quotes[idx])
+		}
+	}
+	if len(review) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "We know who said every quote."), nil
+	}
+
+	response := fmt.Sprintf("There are %d quotes to check. Use /quote author *x* *who said it* to fix them.", len(review))
+	for idx := range review {
+		response += fmt.Sprintf("\n* %d = %q - %s", review[idx].ID, review[idx].Text, review[idx].AuthorReview)
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+}
+
+// ShowDamage - List the damaged values nobody has checked yet, or with "ok",
+// say they've been checked so Quotebot can change quotes again.
+func (p *QuotebotPlugin) ShowDamage(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	switch strings.ToLower(strings.TrimSpace(tail)) {
+	case "":
+		damage, err := p.Damage()
+		if err != nil {
+			return nil, err
+		}
+		if len(damage) == 0 {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any damaged quotes to check."), nil
+		}
+
+		response := fmt.Sprintf("There are %d damaged values to check.", len(damage))
+		for idx := range damage {
+			response += fmt.Sprintf("\n* %s - %s The original is kept as `%s`.", FormatTime(damage[idx].CreateAt), damage[idx].Problem, damage[idx].BackupKey)
+		}
+		response += "\n\nOnce you've checked them, use /quote damage ok to start changing quotes again."
+
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+
+	case "ok":
+		count, err := p.AcknowledgeDamage(args.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any damaged quotes to check."), nil
+		}
+
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Thanks for checking the %d damaged values. Quotebot can change quotes again.", count)), nil
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Use /quote damage to list the damaged quotes, or /quote damage ok once you've checked them."), nil
+}
+
+// ShowSnapshots - List the snapshots, oldest first.
+func (p *QuotebotPlugin) ShowSnapshots(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	infos, appErr := p.Snapshots()
+	if appErr != nil {
+		return nil, appErr
+	}
+	if len(infos) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any snapshots yet."), nil
+	}
+
+	response := fmt.Sprintf("There are %d snapshots.", len(infos))
+	for idx := range infos {
+		by := pluginName
+		if infos[idx].UserID != "" {
+			by = p.UserName(infos[idx].UserID)
+		}
+		response += fmt.Sprintf("\n* %s - %s by %s", infos[idx].Name, FormatTime(infos[idx].CreateAt), by)
+		if infos[idx].Reason != "" {
+			response += fmt.Sprintf(", before %s", infos[idx].Reason)
+		}
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+}
+
+// ShowTrash - List the quotes in the trash.
+func (p *QuotebotPlugin) ShowTrash(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, _, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	quotes, err := store.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	response := fmt.Sprintf("There are %d quotes in the trash.", len(quotes))
+	days := p.getConfiguration().trashRetentionDays()
+	if days > 0 {
+		response += fmt.Sprintf(" They're deleted for good after %d days.", days)
+	}
+
+	for idx := range quotes {
+		response += fmt.Sprintf("\n* %d = %q, deleted by %s on %s", quotes[idx].ID, quotes[idx].Text,
+			p.UserName(quotes[idx].DeletedBy), FormatTime(quotes[idx].DeleteAt))
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
 }
 
 // -----------------------------------------------------------------------------
 // Quotebot commands
 // -----------------------------------------------------------------------------
 
-// AddQuote - Add the given quote to the quote database.
-func (p *QuotebotPlugin) AddQuote(quote string) (*model.CommandResponse, *model.AppError) {
+// AddQuote - Add the given quote to the quote database. Hashtags at the start
+// of the quote are its tags.
+//
+// Quotes we already know are refused, and ones that look a lot like a quote we
+// already know need "--force" to get added anyway.
+func (p *QuotebotPlugin) AddQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	quote, force := takeFlag(tail, forceFlag)
+	store, quote, denied := p.commandStore(args, quote)
+	if denied != nil {
+		return denied, nil
+	}
+
+	tags, quote := ParseTags(quote)
+	quote = strings.TrimSpace(quote)
 	if len(quote) < 1 {
 		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Empty quote. Try adding a quote with some text."), nil
 	}
 
-	// TODO: Should we search the list for "quote" before adding it?
-	p.quotes = append(p.quotes, quote)
-	err := p.SaveQuotes()
+	exact, near, err := findDuplicateQuote(store, quote)
+	if err != nil {
+		return nil, err
+	}
+
+	if exact != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("That's already quote #%d.", exact.ID)), nil
+	}
+	if near != nil && force == false {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("That looks a lot like quote #%d, %q. If it's really different, use /quote add %s %s",
+				near.ID, near.Text, forceFlag, strings.TrimSpace(tail))), nil
+	}
+
+	newQuote := NewQuote(0, quote, args)
+	newQuote.Tags = tags
+	speakers, review := p.ParseSpeakers(quote)
+	newQuote.SetSpeakers(speakers, review, "")
+	newQuote, err = store.Add(newQuote)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(tags) > 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
+			fmt.Sprintf("Added %q as quote number %d, tagged %s.", quote, newQuote.ID, FormatTags(tags))), nil
+	}
 	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
-		fmt.Sprintf("Added %q as quote number %d.", quote, len(p.quotes))), nil
+		fmt.Sprintf("Added %q as quote number %d.", quote, newQuote.ID)), nil
+}
+
+// EditQuote - Change the text of the specified quote, keeping the old text in
+// its history. Admins and the person who added the quote can edit it.
+func (p *QuotebotPlugin) EditQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, text, err := splitQuoteNumber(tail)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+	if len(text) < 1 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Empty quote. Try editing it to have some text."), nil
+	}
+
+	return p.reviseQuote(args, store, num, text, fmt.Sprintf("Quote %d is now %q.", num, text))
+}
+
+// ListQuotes - List the quotes, a page at a time: "page 2" for the second
+// page, "--author", "--contains" or a query to list only some of them, and
+// "--sort" for newest or oldest first.
+func (p *QuotebotPlugin) ListQuotes(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	tokens, unreadable := p.commandTokens(args, tail)
+	if unreadable != nil {
+		return unreadable, nil
+	}
+	options, rest, problem := parseListOptions(tokens)
+	if problem != "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, problem+"\n"+findSubcommand("list").usageText()), nil
+	}
+	query, queryErr := parseQueryTokens(rest)
+	if queryErr != nil {
+		return p.unreadable(args, tail, queryErr), nil
+	}
+	p.linkQueryUsers(query)
+	options.query = query
+
+	collection := ""
+	if options.here {
+		collection = hereFlag
+	}
+	store, _, denied := p.commandStore(args, collection)
+	if denied != nil {
+		return denied, nil
+	}
+
+	quotes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	sortQuotes(quotes, options.newest)
+	for idx := range quotes {
+		if options.matches(&quotes[idx]) {
+			lines = append(lines, formatListLine(&quotes[idx]))
+		}
+	}
+
+	response := fmt.Sprintf("There are %d quotes on file.", len(quotes))
+	if options.filtered() {
+		response = fmt.Sprintf("%d of the %d quotes on file match.", len(lines), len(quotes))
+	}
+
+	pages := pageLines(lines, listPageRunes)
+	if options.page > 1 && options.page > len(pages) {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("%s There's no page %d; there are only %d.", response, options.page, len(pages))), nil
+	}
+	if len(pages) <= 1 {
+		for _, line := range lines {
+			response += "\n" + line
+		}
+
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+	}
+
+	for _, line := range pages[options.page-1] {
+		response += "\n" + line
+	}
+	response += fmt.Sprintf("\n\nPage %d of %d.", options.page, len(pages))
+	if options.page < len(pages) {
+		response += fmt.Sprintf(" For the next page, use %s.", options.command(options.page+1))
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+}
+
+// RevertQuote - Change the specified quote back to one of its earlier
+// versions. Admins and the person who added the quote can revert it.
+func (p *QuotebotPlugin) RevertQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, versionText, err := splitQuoteNumber(tail)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+
+	version, err := strconv.Atoi(versionText)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("What version? Use /quote history %d to see them.", num)), nil
+	}
+
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't revert quote %d, it doesn't exist.", num)), nil
+	}
+
+	versions := quote.Versions()
+	if version < 1 || version > len(versions) {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Quote %d doesn't have a version %d. Use /quote history %d to see them.", num, version, num)), nil
+	}
+
+	text := versions[version-1].Text
+
+	return p.reviseQuote(args, store, num, text, fmt.Sprintf("Reverted quote %d to version %d, %q.", num, version, text))
+}
+
+// SearchQuotes - Show the quotes that best match the given words, with the
+// matching words highlighted.
+func (p *QuotebotPlugin) SearchQuotes(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	search := strings.TrimSpace(tail)
+	terms := SearchTerms(search)
+	if len(terms) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What are you looking for? Try /quote search *some words*."), nil
+	}
+
+	quotes, err := store.Find(terms, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	results := FindQuotes(quotes, terms)
+	if len(results) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("No quotes match %q.", search)), nil
+	}
+
+	response := fmt.Sprintf("Found %d quotes matching %q.", len(results), search)
+	if len(results) > searchResultLimit {
+		response += fmt.Sprintf(" Here are the best %d.", searchResultLimit)
+		results = results[:searchResultLimit]
+	}
+
+	for idx := range results {
+		response += fmt.Sprintf("\n* %d = %s", results[idx].Quote.ID, HighlightTerms(results[idx].Quote.Text, terms))
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
 }
 
 // ShowHelp - Post the usage instructions.
 func (p *QuotebotPlugin) ShowHelp(userID string) (*model.CommandResponse, *model.AppError) {
 	if p.IsAdmin(userID) {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, strings.Join([]string{helpText, adminHelpText}, "\n\n")), nil
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, strings.Join([]string{helpText(), adminHelpText()}, "\n\n")), nil
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, helpText()), nil
+}
+
+// ShowHistory - Show every version of the specified quote, with who changed
+// it and when.
+func (p *QuotebotPlugin) ShowHistory(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, err := strconv.Atoi(strings.TrimSpace(tail))
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Quote %d doesn't exist, so it doesn't have a history.", num)), nil
+	}
+
+	versions := quote.Versions()
+	response := fmt.Sprintf("Quote %d has %d versions.", num, len(versions))
+	for idx := range versions {
+		response += fmt.Sprintf("\n%d. %q, by %s on %s", idx+1, versions[idx].Text,
+			p.UserName(versions[idx].UserID), FormatTime(versions[idx].CreateAt))
 	}
 
-	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, helpText), nil
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
 }
 
 // ShowInfo - Show plug info.
 // This function is an i18n nightmare, but at least it's short...
-func (p *QuotebotPlugin) ShowInfo(userID string) (*model.CommandResponse, *model.AppError) {
+func (p *QuotebotPlugin) ShowInfo(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 	info := "You are a"
-	if p.IsAdmin(userID) {
+	if p.IsAdmin(args.UserId) {
 		info += "n Admin."
 	} else {
 		info += " User."
 	}
 
-	info += fmt.Sprintf(" Quotebot knows %v quotes.", len(p.quotes))
+	count, appErr := p.Store(args.TeamId).Count()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	info += fmt.Sprintf(" Quotebot knows %v quotes.", count)
 
-	channel, err := p.API.GetChannel(p.channelID)
+	channelID, _ := p.postTarget()
+	channel, err := p.API.GetChannel(channelID)
 	if err == nil {
-		info += fmt.Sprintf(" Monitoring %s for activity every %v minutes.", channel.DisplayName, p.configuration.postDelta)
+		info += fmt.Sprintf(" Monitoring %s for activity every %v minutes.", channel.DisplayName, p.getConfiguration().postDelta)
 	} else {
 		info += fmt.Sprintf(" Monitoring a non-existent channel. An Admin should fix that.")
 	}
+	if p.readOnly {
+		info += " Quotebot found damaged quotes, and won't change any until an Admin checks them."
+	}
 
 	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, info), nil
 }
 
-// ShowQuote - Post the specified quote.
-func (p *QuotebotPlugin) ShowQuote(userID string, tail string) (*model.CommandResponse, *model.AppError) {
+// ShowQuote - Post the specified quote, or a random one matching a query
+// like "@gus #work", or said by someone, like "from Gus M".
+func (p *QuotebotPlugin) ShowQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
 	// If tail is a number, show that quote.
-	num, err := strconv.Atoi(tail)
+	num, err := strconv.Atoi(strings.TrimSpace(tail))
+	if err == nil {
+		return p.showQuote(store, num)
+	}
+
+	query, unreadable := p.commandQuery(args, tail)
+	if unreadable != nil {
+		return unreadable, nil
+	}
+
+	return p.showRandom(args.ChannelId, store, query)
+}
+
+// ShowRandom - Show a random quotation in response to a command.
+func (p *QuotebotPlugin) ShowRandom(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	return p.showRandom(args.ChannelId, p.Store(args.TeamId), nil)
+}
+
+// ShowTags - List the tags, and how many quotes have each one.
+func (p *QuotebotPlugin) ShowTags(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, _, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	quotes, err := store.List()
 	if err != nil {
-		return p.ShowHelp(userID)
+		return nil, err
 	}
 
-	if len(p.quotes) == 0 {
-		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any quotes yet."), nil
-	} else if len(p.quotes) < num {
+	counts := CountTags(quotes)
+	if len(counts) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any tags yet."), nil
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	response := fmt.Sprintf("There are %d tags.", len(tags))
+	for idx := range tags {
+		response += fmt.Sprintf("\n* #%s - %d quotes", tags[idx], counts[tags[idx]])
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, response), nil
+}
+
+// TagQuote - Add and remove the specified quote's tags: "+tag" (or just
+// "tag") adds one, "-tag" removes one. Admins and the person who added the
+// quote can tag it. With no tags, show the quote's tags.
+func (p *QuotebotPlugin) TagQuote(args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+	store, tail, denied := p.commandStore(args, tail)
+	if denied != nil {
+		return denied, nil
+	}
+
+	num, changes, err := splitQuoteNumber(tail)
+	if err != nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "What quote? You have to specify a quote number."), nil
+	}
+
+	var add []string
+	var remove []string
+	for _, change := range strings.Fields(changes) {
+		tag := NormalizeTag(strings.TrimLeft(change, "+-"))
+		if tag == "" {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				fmt.Sprintf("%q isn't a tag. Tags start with a letter, and have letters, numbers, - and _.", change)), nil
+		}
+
+		if strings.HasPrefix(change, "-") {
+			remove = append(remove, tag)
+		} else {
+			add = append(add, tag)
+		}
+	}
+
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't tag quote %d, it doesn't exist.", num)), nil
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, describeTags(quote)), nil
+	}
+	if p.mayChange(args, quote) == false {
 		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			fmt.Sprintf("Unable to show quote %v, it doesn't exist yet. There are %d quotes on file.", num,
-				len(p.quotes))), nil
+			fmt.Sprintf("Only admins and whoever added quote %d can change it.", num)), nil
 	}
 
-	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL, fmt.Sprintf("> %v", p.quotes[num-1])), nil
+	_, appErr = store.Update(num, func(quote *Quote) bool {
+		return quote.Retag(add, remove)
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	quote, appErr = store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		// Deleted out from under us.
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't tag quote %d, it doesn't exist.", num)), nil
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, describeTags(quote)), nil
 }
 
-// ShowRandom - Show a random quotation in response to a command.
-func (p *QuotebotPlugin) ShowRandom(userID string) (*model.CommandResponse, *model.AppError) {
-	numQuotes := len(p.quotes)
-	if numQuotes == 1 {
-		return p.ShowQuote(userID, "1")
+// -----------------------------------------------------------------------------
+// Command utilities
+// -----------------------------------------------------------------------------
+
+// takeFlag - Take flag out of the flags ("--something") at the start of tail.
+// Returns the rest of tail, and whether the flag was there.
+func takeFlag(tail string, flag string) (string, bool) {
+	rest := strings.TrimLeftFunc(tail, unicode.IsSpace)
+	kept := ""
+	for strings.HasPrefix(rest, "--") {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+
+		token := rest[:end]
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+		if token == flag {
+			return kept + rest, true
+		}
+
+		kept += token + " "
+	}
+
+	return tail, false
+}
+
+// showQuote - Post the specified quote from store.
+func (p *QuotebotPlugin) showQuote(store QuoteStore, num int) (*model.CommandResponse, *model.AppError) {
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if quote == nil {
+		lastID, appErr := store.LastID()
+		if appErr != nil {
+			return nil, appErr
+		}
+		count, appErr := store.Count()
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		if lastID == 0 {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any quotes yet."), nil
+		} else if num > 0 && num <= lastID {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Quote %v was deleted.", num)), nil
+		}
+
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Unable to show quote %v, it doesn't exist yet. There are %d quotes on file.", num, count)), nil
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL, fmt.Sprintf("> %v", quote.Text)), nil
+}
+
+// showRandom - Post the channel's next shuffled quote from store matching the
+// query.
+func (p *QuotebotPlugin) showRandom(channelID string, store QuoteStore, query *Query) (*model.CommandResponse, *model.AppError) {
+	quote, err := p.ShuffledQuote(channelID, store, query)
+	if err != nil {
+		return nil, err
+	}
+	if quote == nil && query.Empty() {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any quotes yet."), nil
+	}
+	if quote == nil && query.person() != "" {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("There aren't any quotes from %s.", query.person())), nil
+	}
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("No quotes match %s.", query.String())), nil
+	}
+
+	return p.showQuote(store, quote.ID)
+}
+
+// splitQuoteNumber - Split a command's tail into the quote number at the
+// start and the rest.
+func splitQuoteNumber(tail string) (int, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(tail), " ", 2)
+	num, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", err
+	}
+	if len(parts) < 2 {
+		return num, "", nil
+	}
+
+	return num, strings.TrimSpace(parts[1]), nil
+}
+
+// describeSpeakers - Describe who said a quote for humans.
+func describeSpeakers(quote *Quote) string {
+	description := fmt.Sprintf("We don't know who said quote %d.", quote.ID)
+	if len(quote.Speakers) > 0 {
+		description = fmt.Sprintf("Quote %d is from %s.", quote.ID, FormatSpeakers(quote.Speakers))
+	}
+	if quote.AuthorReview != "" {
+		description += " " + quote.AuthorReview
+	}
+
+	return description
+}
+
+// describeImport - Describe what happened when a file was imported for
+// humans.
+func describeImport(name string, result ImportResult) string {
+	if result.Restored {
+		return fmt.Sprintf("%s: restored %d quotes exactly as they were exported.", name, result.AddedQuotes)
+	}
+
+	var parts []string
+	if result.AddedQuotes+result.SkippedQuotes > 0 || result.AddedResponses+result.SkippedResponses == 0 {
+		parts = append(parts, fmt.Sprintf("added %d quotes, skipped %d", result.AddedQuotes, result.SkippedQuotes))
+	}
+	if result.AddedResponses+result.SkippedResponses > 0 {
+		parts = append(parts, fmt.Sprintf("added %d responses, skipped %d", result.AddedResponses, result.SkippedResponses))
+	}
+
+	return fmt.Sprintf("%s: %s.", name, strings.Join(parts, "; "))
+}
+
+// describeTags - Describe a quote's tags for humans.
+func describeTags(quote *Quote) string {
+	if len(quote.Tags) == 0 {
+		return fmt.Sprintf("Quote %d doesn't have any tags.", quote.ID)
+	}
+
+	return fmt.Sprintf("Quote %d is tagged %s.", quote.ID, FormatTags(quote.Tags))
+}
+
+// mayChange - Is the user allowed to change quote? Admins can change any
+// quote, everyone else only the ones they added.
+func (p *QuotebotPlugin) mayChange(args *model.CommandArgs, quote *Quote) bool {
+	return quote.UserID == args.UserId || p.IsAdmin(args.UserId)
+}
+
+// reviseQuote - Change the text of the specified quote if the user is allowed
+// to, and respond with done if it worked.
+func (p *QuotebotPlugin) reviseQuote(args *model.CommandArgs, store QuoteStore, num int, text string, done string) (*model.CommandResponse, *model.AppError) {
+	quote, appErr := store.Get(num)
+	if appErr != nil {
+		return nil, appErr
 	}
-	if numQuotes > 1 {
-		// rand.Intn() throws an exception if you call it with 0...
-		return p.ShowQuote(userID, fmt.Sprintf("%d", rand.Intn(numQuotes)+1))
+	if quote == nil {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("You can't edit quote %d, it doesn't exist.", num)), nil
+	}
+	if p.mayChange(args, quote) == false {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Only admins and whoever added quote %d can change it.", num)), nil
+	}
+
+	speakers, review := p.ParseSpeakers(text)
+	changed, appErr := store.Update(num, func(quote *Quote) bool {
+		if quote.Revise(text, args.UserId) == false {
+			return false
+		}
+
+		// Unless an admin said who said it, the new text says who said it.
+		if quote.AuthorSetBy == "" {
+			quote.SetSpeakers(speakers, review, "")
+		}
+		return true
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	if changed == false {
+		// Either it already says that, or it was deleted out from under us.
+		quote, appErr = store.Get(num)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if quote == nil {
+			return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				fmt.Sprintf("You can't edit quote %d, it doesn't exist.", num)), nil
+		}
+
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Quote %d already says that.", num)), nil
 	}
 
-	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There aren't any quotes yet."), nil
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL, done), nil
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/mattermost/mattermost-server/model"
 	"github.com/mattermost/mattermost-server/plugin"
@@ -72,6 +77,7 @@ func testChannel(channelID string) (*model.Channel, *model.AppError) {
 	default:
 		fakeChannel = &model.Channel{
 			Id:          "some ID string",
+			TeamId:      "teamid",
 			DisplayName: "mock",
 		}
 		fakeErr = nil
@@ -80,38 +86,158 @@ func testChannel(channelID string) (*model.Channel, *model.AppError) {
 	return fakeChannel, fakeErr
 }
 
+func testCommandArgs(cmd string) *model.CommandArgs {
+	return &model.CommandArgs{
+		Command:   cmd,
+		UserId:    "userid",
+		ChannelId: "channelid",
+		TeamId:    "teamid",
+	}
+}
+
+func testQuotes(t *testing.T, p *QuotebotPlugin) []Quote {
+	quotes, err := p.Store("teamid").List()
+	assert.Nil(t, err)
+
+	return quotes
+}
+
+// setTestStore - Use store for the team's quotes.
+func setTestStore(p *QuotebotPlugin, teamID string, store QuoteStore) {
+	p.storeLock.Lock()
+	defer p.storeLock.Unlock()
+
+	if p.stores == nil {
+		p.stores = make(map[string]QuoteStore)
+	}
+	p.stores[teamCollection(teamID)] = store
+}
+
 func runTestPluginCommand(t *testing.T, cmd string, user string, channelID string) (*model.CommandResponse, *model.AppError) {
 	p := initTestPlugin(t, user, channelID)
 	assert.Nil(t, p.OnActivate())
 
-	var command *model.CommandArgs
-	command = &model.CommandArgs{
-		Command: cmd,
-		UserId:  "userid",
-		TeamId:  "teamid",
+	return p.ExecuteCommand(&plugin.Context{}, testCommandArgs(cmd))
+}
+
+// testKV - A fake key-value store for the mock API.
+type testKV struct {
+	sync.Mutex
+	data map[string][]byte
+	race func(key string)      // If set, called just before a compare-and-set to simulate losing a race.
+	fail func(key string) bool // If set, sets of keys it returns true for fail.
+}
+
+func (kv *testKV) get(key string) []byte {
+	kv.Lock()
+	defer kv.Unlock()
+
+	return kv.data[key]
+}
+
+func (kv *testKV) set(key string, value []byte) *model.AppError {
+	kv.Lock()
+	defer kv.Unlock()
+
+	if kv.fail != nil && kv.fail(key) {
+		return &model.AppError{Message: "Nope."}
+	}
+
+	kv.data[key] = value
+	return nil
+}
+
+func (kv *testKV) compareAndSet(key string, oldValue []byte, newValue []byte) bool {
+	kv.Lock()
+	defer kv.Unlock()
+
+	if kv.race != nil {
+		kv.race(key)
+	}
+
+	current, exists := kv.data[key]
+	if oldValue == nil && exists {
+		return false
+	}
+	if oldValue != nil && bytes.Equal(current, oldValue) == false {
+		return false
+	}
+
+	kv.data[key] = newValue
+	return true
+}
+
+func (kv *testKV) delete(key string) *model.AppError {
+	kv.Lock()
+	defer kv.Unlock()
+
+	delete(kv.data, key)
+	return nil
+}
+
+func (kv *testKV) list(page int, perPage int) []string {
+	kv.Lock()
+	defer kv.Unlock()
+
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	start := page * perPage
+	if start > len(keys) {
+		start = len(keys)
+	}
+	end := start + perPage
+	if end > len(keys) {
+		end = len(keys)
 	}
 
-	return p.ExecuteCommand(&plugin.Context{}, command)
+	return keys[start:end]
 }
 
 func initAPI(t *testing.T, user string, channelID string, quotesRaw []byte) *plugintest.API {
+	api, _ := initKVAPI(t, user, channelID, quotesRaw)
+
+	return api
+}
+
+func initKVAPI(t *testing.T, user string, channelID string, quotesRaw []byte) (*plugintest.API, *testKV) {
 	api := &plugintest.API{}
 	fakeUser := testUser(user)
 	fakeChannel, fakeChannelErr := testChannel(channelID)
 
+	kv := &testKV{data: make(map[string][]byte)}
+	if quotesRaw != nil {
+		kv.data[quotesKey] = quotesRaw
+	}
+
 	// Things that don't change depending on user/channelID.
 	api.On("RegisterCommand", mock.Anything).Return(nil)
 	api.On("UnregisterCommand", mock.Anything, mock.Anything).Return(nil)
 	api.On("LoadPluginConfiguration", mock.Anything).Return(nil)
-	api.On("KVGet", mock.Anything).Return(quotesRaw, nil)
-	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+	api.On("KVGet", mock.Anything).Return(kv.get, nil)
+	api.On("KVSet", mock.Anything, mock.Anything).Return(kv.set)
+	api.On("KVCompareAndSet", mock.Anything, mock.Anything, mock.Anything).Return(kv.compareAndSet, nil)
+	api.On("KVDelete", mock.Anything).Return(kv.delete)
+	api.On("KVList", mock.Anything, mock.Anything).Return(kv.list, nil)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Return()
 
 	// These need specific mocks.
 	api.On("GetUser", mock.Anything).Return(fakeUser, (*model.AppError)(nil))
 	api.On("GetChannelByName", mock.Anything, mock.Anything, mock.Anything).Return(fakeChannel, fakeChannelErr)
 	api.On("GetChannel", mock.Anything).Return(fakeChannel, fakeChannelErr)
-
-	return api
+	api.On("GetChannelMember", "channelid", "userid").Return(&model.ChannelMember{ChannelId: "channelid", UserId: "userid"}, (*model.AppError)(nil))
+	api.On("GetChannelMember", "otherchannelid", "userid").Return((*model.ChannelMember)(nil), &model.AppError{Message: "Nope."})
+	api.On("GetUserByUsername", "shane").Return(&model.User{Id: "shaneid", Username: "shane"}, (*model.AppError)(nil))
+	api.On("GetUserByUsername", mock.Anything).Return((*model.User)(nil), &model.AppError{Message: "Nope."})
+	api.On("GetTeamByName", "team").Return(&model.Team{Id: "teamid", Name: "team"}, (*model.AppError)(nil))
+	api.On("GetTeamByName", "fail").Return((*model.Team)(nil), &model.AppError{Message: "Nope."})
+
+	return api, kv
 }
 
 func initTestPlugin(t *testing.T, user string, channelID string) *QuotebotPlugin {
@@ -120,6 +246,11 @@ func initTestPlugin(t *testing.T, user string, channelID string) *QuotebotPlugin
 	p := QuotebotPlugin{}
 	p.SetAPI(api)
 
+	// Stop anything OnActivate started before the next test.
+	t.Cleanup(func() {
+		p.OnDeactivate()
+	})
+
 	return &p
 }
 
@@ -127,86 +258,400 @@ func initTestPlugin(t *testing.T, user string, channelID string) *QuotebotPlugin
 // Quotebot admin-only commands
 // -----------------------------------------------------------------------------
 
+// TestAuthorQuote - Test the AuthorQuote function.
+func TestAuthorQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote author 1 Gus"))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote author.")
+
+	p = initTestPlugin(t, "team", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "1 Gus")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't change who said quote 1, it doesn't exist.")
+
+	p.AddQuote(testCommandArgs(""), "There's lots of primes! (via Anthony)")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is from Anthony.")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "2")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "We don't know who said quote 2. No attribution found.")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "1 Gus and @shane")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is from Gus, @shane.")
+	assert.EqualValues(t, testQuotes(t, p)[0].Speakers, []Speaker{{Name: "Gus"}, {Name: "shane", UserID: "shaneid"}})
+	assert.EqualValues(t, testQuotes(t, p)[0].AuthorSetBy, "userid")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "2 @nobody")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "@nobody isn't a user here.")
+
+	resp, err = p.AuthorQuote(testCommandArgs(""), "2 ???")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "\"???\" doesn't look like anyone. Use names or @usernames, like Gus and @shane.")
+
+	// Editing the quote doesn't undo it.
+	p.EditQuote(testCommandArgs(""), "1 There's lots of primes! - Rob")
+	assert.EqualValues(t, testQuotes(t, p)[0].Author, "Gus, @shane")
+}
+
 // TestDeleteQuote - Test the DeleteQuote function.
 func TestDeleteQuote(t *testing.T) {
 	// Regular user testing.
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err := p.DeleteQuote("userid", "1")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote delete 1"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Only admins can delete quotes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote delete.")
 
 	// Admin testing.
 	p = initTestPlugin(t, "team", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.DeleteQuote("userid", "")
+	resp, err = p.DeleteQuote(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote index.")
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
 
-	resp, err = p.DeleteQuote("userid", "1")
+	resp, err = p.DeleteQuote(testCommandArgs(""), "1")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You can't delete quote 1, it doesn't exist.")
 
-	resp, err = p.AddQuote("quote 1")
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	resp, err = p.DeleteQuote(testCommandArgs(""), "1")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Moved quote 1 to the trash. There are 0 quotes on file.")
 
-	resp, err = p.DeleteQuote("userid", "1")
+	resp, err = p.DeleteQuote(testCommandArgs(""), "1")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Deleted quote 1. There are 0 quotes on file.")
+	assert.EqualValues(t, resp.Text, "Quote 1 was already deleted.")
+
+	// Deleting doesn't renumber the other quotes, or reuse the ID.
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.AddQuote(testCommandArgs(""), "quote 3")
+
+	resp, err = p.DeleteQuote(testCommandArgs(""), "2")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Moved quote 2 to the trash. There are 1 quotes on file.")
+	assert.EqualValues(t, testQuotes(t, p)[0].ID, 3)
+
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 4")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Added \"quote 4\" as quote number 4.")
 }
 
-// TestListQuotes - Test the ListQuotes function.
-func TestListQuotes(t *testing.T) {
-	// Regular user testing.
+// TestExportQuotes - Test the ExportQuotes function.
+func TestExportQuotes(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err := p.ListQuotes("userid")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote export"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Only admins can list the quotes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote export.")
+
+	p = initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "#math There's lots of primes! - @shane")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.AddQuote(testCommandArgs(""), "quote 3")
+	p.EditQuote(testCommandArgs(""), "3 quote three")
+	p.DeleteQuote(testCommandArgs(""), "2")
+
+	// Nobody to post as, so the admin sends it to themselves.
+	var uploaded []byte
+	api := p.API.(*plugintest.API)
+	api.On("GetDirectChannel", "userid", "userid").Return(&model.Channel{Id: "dmid"}, (*model.AppError)(nil))
+	api.On("UploadFile", mock.Anything, "dmid", mock.Anything).Return(func(data []byte, channelID string, name string) *model.FileInfo {
+		uploaded = data
+		return &model.FileInfo{Id: "fileid", Name: name}
+	}, (*model.AppError)(nil))
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, (*model.AppError)(nil))
+
+	resp, err = p.ExportQuotes(testCommandArgs(""), "pdf")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotes can be exported as json, csv or md.")
+
+	resp, err = p.ExportQuotes(testCommandArgs(""), "CSV")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "Sent you quotes-"))
+	assert.True(t, strings.HasSuffix(resp.Text, ".csv in a direct message."))
+	assert.True(t, strings.HasPrefix(string(uploaded), "id,text,"))
+
+	resp, err = p.ExportQuotes(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(resp.Text, ".json in a direct message."))
+	api.AssertCalled(t, "CreatePost", &model.Post{UserId: "userid", ChannelId: "dmid", Message: "Here are the 2 quotes, and 1 in the trash.", FileIds: []string{"fileid"}})
+
+	// Importing it somewhere empty brings it all back.
+	store := p.Store("teamid")
+	quotes, _ := store.List()
+	trash, _ := store.Trash()
+	file, parseErr := ParseImport(uploaded)
+	assert.Nil(t, parseErr)
+
+	before, _ := p.Snapshots()
+	other := p.collection(channelCollection("channelid"))
+	result, err := p.importFile(testCommandArgs(""), other, file)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result, ImportResult{AddedQuotes: 3, Restored: true})
+	imported, _ := other.List()
+	assert.EqualValues(t, imported, quotes)
+	importedTrash, _ := other.Trash()
+	assert.EqualValues(t, importedTrash, trash)
+	lastID, _ := other.LastID()
+	assert.EqualValues(t, lastID, 3)
+	infos, _ := p.Snapshots()
+	if assert.EqualValues(t, len(infos), len(before)+1) {
+		assert.EqualValues(t, infos[len(before)].Reason, "restoring quotes from an export")
+	}
+
+	// Not somewhere that already has quotes, and without a snapshot, since
+	// nothing's replaced.
+	result, err = p.importFile(testCommandArgs(""), store, file)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result, ImportResult{SkippedQuotes: 2})
+	infos, _ = p.Snapshots()
+	assert.EqualValues(t, len(infos), len(before)+1)
+}
+
+// TestImportQuotes - Test the ImportQuotes function.
+func TestImportQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote import"))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote import.")
+
+	p = initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	api := p.API.(*plugintest.API)
+	api.On("GetPost", "postidpostidpostidpostid01").Return(&model.Post{Id: "postidpostidpostidpostid01", ChannelId: "channelid", FileIds: []string{"quotesid", "responsesid", "bigid", "brokenid"}}, (*model.AppError)(nil))
+	api.On("GetPost", "postidpostidpostidpostid02").Return(&model.Post{Id: "postidpostidpostidpostid02", ChannelId: "otherchannelid", FileIds: []string{"quotesid"}}, (*model.AppError)(nil))
+	api.On("GetPost", "postidpostidpostidpostid03").Return(&model.Post{Id: "postidpostidpostidpostid03", ChannelId: "channelid"}, (*model.AppError)(nil))
+	api.On("GetPost", mock.Anything).Return((*model.Post)(nil), &model.AppError{Message: "Nope."})
+	api.On("GetFileInfo", "quotesid").Return(&model.FileInfo{Id: "quotesid", Name: "quotes.txt", Size: 10}, (*model.AppError)(nil))
+	api.On("GetFileInfo", "responsesid").Return(&model.FileInfo{Id: "responsesid", Name: "responses.json", Size: 10}, (*model.AppError)(nil))
+	api.On("GetFileInfo", "bigid").Return(&model.FileInfo{Id: "bigid", Name: "big.json", Size: maxImportFileSize + 1}, (*model.AppError)(nil))
+	api.On("GetFileInfo", "brokenid").Return(&model.FileInfo{Id: "brokenid", Name: "broken.json", Size: 10}, (*model.AppError)(nil))
+	api.On("GetFile", "quotesid").Return([]byte("quote 1\n#work quote 2\n"), (*model.AppError)(nil))
+	api.On("GetFile", "responsesid").Return([]byte(`[{"trigger": "dunno", "response": "Me neither."}]`), (*model.AppError)(nil))
+	api.On("GetFile", "brokenid").Return([]byte(`["quote 3"`), (*model.AppError)(nil))
+
+	resp, err = p.ImportQuotes(testCommandArgs(""), "https://chat.example.com/team/pl/postidpostidpostidpostid01")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "quotes.txt: added 1 quotes, skipped 1.\n"+
+		"responses.json: added 1 responses, skipped 0.\n"+
+		"big.json: too big to import.\n"+
+		"broken.json: not a quotes or responses file I understand (unexpected end of JSON input).")
+
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[1].Text, "quote 2")
+	assert.EqualValues(t, quotes[1].Tags, []string{"work"})
+	responses, err := p.Responses()
+	assert.Nil(t, err)
+	assert.EqualValues(t, responses, []Response{{Trigger: "dunno", Response: "Me neither."}})
+
+	// Replying to the post.
+	args := testCommandArgs("")
+	args.RootId = "postidpostidpostidpostid01"
+	resp, err = p.ImportQuotes(args, "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "quotes.txt: added 0 quotes, skipped 2.\n"+
+		"responses.json: added 0 responses, skipped 1.\n"+
+		"big.json: too big to import.\n"+
+		"broken.json: not a quotes or responses file I understand (unexpected end of JSON input).")
+
+	resp, err = p.ImportQuotes(testCommandArgs(""), "--here postidpostidpostidpostid01")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "quotes.txt: added 2 quotes, skipped 0.\n"))
+
+	// Posts we can't use.
+	resp, err = p.ImportQuotes(testCommandArgs(""), "postidpostidpostidpostid02")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "I can't find that post.")
+
+	resp, err = p.ImportQuotes(testCommandArgs(""), "postidpostidpostidpostid03")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "That post doesn't have any files to import.")
+
+	resp, err = p.ImportQuotes(testCommandArgs(""), "postidpostidpostidpostid04")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "I can't find that post.")
+
+	resp, err = p.ImportQuotes(testCommandArgs(""), "quotes.json")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What file? Attach it to a post, then reply to the post with /quote import, or use /quote import *link to the post*.")
+}
+
+// TestReindexQuotes - Test the ReindexQuotes function.
+func TestReindexQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote reindex"))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote reindex.")
 
-	// Admin testing.
 	p = initTestPlugin(t, "team", "mock")
 	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "There's lots of primes! - Gus")
+	p.AddQuote(testCommandArgs(""), "Prime time.")
+	p.AddQuote(testCommandArgs(""), "--here Channel primes.")
 
-	resp, err = p.ListQuotes("userid")
+	resp, err = p.ReindexQuotes(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "There are 0 quotes on file.")
+	assert.EqualValues(t, resp.Text, "Rebuilt the search index for 2 quotes.")
+
+	resp, err = p.ReindexQuotes(testCommandArgs(""), "--here")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Rebuilt the search index for 1 quotes.")
 
-	resp, err = p.AddQuote("quote 1")
+	resp, err = p.SearchQuotes(testCommandArgs(""), "prime")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Found 2 quotes matching \"prime\".\n* 2 = **Prime** time.\n* 1 = There's lots of **primes**! - Gus")
+}
+
+// TestRollbackSnapshot - Test the RollbackSnapshot function.
+func TestRollbackSnapshot(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.ListQuotes("userid")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote rollback before"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "There are 1 quotes on file.\n* 1 = \"quote 1\"")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote rollback.")
+
+	p = initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.SaveSnapshot(testCommandArgs(""), "before")
+	p.DeleteQuote(testCommandArgs(""), "1")
+
+	resp, err = p.RollbackSnapshot(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Which snapshot? Use /quote snapshots to list them.")
 
-	resp, err = p.AddQuote("quote 2")
+	resp, err = p.RollbackSnapshot(testCommandArgs(""), "after")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There isn't a snapshot called \"after\". Use /quote snapshots to list them.")
+
+	info, _ := p.FindSnapshot("before")
+	resp, err = p.RollbackSnapshot(testCommandArgs(""), "Before")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	infos, _ := p.Snapshots()
+	undo := infos[len(infos)-1]
+	assert.EqualValues(t, resp.Text, fmt.Sprintf("Rolled back to snapshot \"before\" from %s. To undo it, use /quote rollback %s.",
+		FormatTime(info.CreateAt), undo.Name))
+	assert.EqualValues(t, len(testQuotes(t, p)), 1)
+}
 
-	resp, err = p.ListQuotes("userid")
+// TestSaveSnapshot - Test the SaveSnapshot function.
+func TestSaveSnapshot(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote snapshot"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "There are 2 quotes on file.\n* 1 = \"quote 1\"\n* 2 = \"quote 2\"")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote snapshot.")
+
+	p = initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err = p.SaveSnapshot(testCommandArgs(""), "Before-Import")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Saved snapshot \"before-import\". To go back to it, use /quote rollback before-import.")
+
+	resp, err = p.SaveSnapshot(testCommandArgs(""), "before-import")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There's already a snapshot called \"before-import\".")
+
+	resp, err = p.SaveSnapshot(testCommandArgs(""), "auto-1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Snapshot names have up to 32 letters, numbers, ., - and _, and don't start with \"auto-\".")
+
+	resp, err = p.SaveSnapshot(testCommandArgs(""), "two words")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Snapshot names have up to 32 letters, numbers, ., - and _, and don't start with \"auto-\".")
+
+	// Named after the time.
+	resp, err = p.SaveSnapshot(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	infos, _ := p.Snapshots()
+	assert.EqualValues(t, len(infos), 2)
+	assert.EqualValues(t, resp.Text, fmt.Sprintf("Saved snapshot %q. To go back to it, use /quote rollback %s.", infos[1].Name, infos[1].Name))
 }
 
 // TestSetChannel - test the SetChannel function.
@@ -215,51 +660,64 @@ func TestSetChannel(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err := p.SetChannel("userid", "town-square", "teamid")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote channel town-square"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Only admins can set the channel.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote channel.")
 
 	// Admin testing.
 	p = initTestPlugin(t, "team", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.SetChannel("userid", "", "teamid")
+	resp, err = p.SetChannel("", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You must specify a channel name.")
 
-	resp, err = p.SetChannel("userid", "~", "teamid")
+	resp, err = p.SetChannel("~", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You must specify a channel name.")
 
-	resp, err = p.SetChannel("userid", "town-square", "teamid")
+	resp, err = p.SetChannel("town-square", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "Channel set to mock.")
 
-	resp, err = p.SetChannel("userid", "~town-square", "teamid")
+	resp, err = p.SetChannel("~town-square", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "Channel set to mock.")
+	assert.False(t, p.getConfiguration().postChannelQuotes)
+
+	resp, err = p.SetChannel("--here ~town-square", "teamid")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Channel set to mock, using its own quotes.")
+	assert.True(t, p.getConfiguration().postChannelQuotes)
+	assert.EqualValues(t, p.teamID, "teamid")
+
+	resp, err = p.SetChannel("--here", "teamid")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You must specify a channel name.")
 
 	// Fails.
 	p = initTestPlugin(t, "team", "fail")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.SetChannel("userid", "town-square", "teamid")
+	resp, err = p.SetChannel("town-square", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "\"town-square\" isn't a valid channel, use one that exists.")
 
-	resp, err = p.SetChannel("userid", "~town-square", "teamid")
+	resp, err = p.SetChannel("~town-square", "teamid")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
@@ -272,47 +730,47 @@ func TestSetInterval(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err := p.SetInterval("userid", "15")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote interval 15"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Only admins can set the interval.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote interval.")
 
 	// Admin testing.
 	p = initTestPlugin(t, "team", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.SetInterval("userid", "")
+	resp, err = p.SetInterval("")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You have to specify an interval in minutes, >= 15.")
 
-	resp, err = p.SetInterval("userid", "cat")
+	resp, err = p.SetInterval("cat")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You have to specify an interval in minutes, >= 15.")
 
-	resp, err = p.SetInterval("userid", "5")
+	resp, err = p.SetInterval("5")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "You can't set an Interval less than 15 minutes, it's annoying.")
 
-	resp, err = p.SetInterval("userid", "15")
+	resp, err = p.SetInterval("15")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "Interval set to 15 minutes.")
 
-	resp, err = p.SetInterval("userid", "60")
+	resp, err = p.SetInterval("60")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "Interval set to 60 minutes.")
 
-	resp, err = p.SetInterval("userid", "10081")
+	resp, err = p.SetInterval("10081")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
@@ -327,139 +785,896 @@ func TestShowHelpAdmin(t *testing.T) {
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, strings.Join([]string{helpText, adminHelpText}, "\n\n"))
+	assert.EqualValues(t, resp.Text, strings.Join([]string{helpText(), adminHelpText()}, "\n\n"))
 }
 
-// -----------------------------------------------------------------------------
-// Quotebot commands
-// -----------------------------------------------------------------------------
-
-// TestAddQuote - Test the AddQuote function.
-func TestAddQuote(t *testing.T) {
+// TestShowAuthors - Test the ShowAuthors function.
+func TestShowAuthors(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
-	assert.EqualValues(t, len(p.quotes), 0)
 
-	resp, err := p.AddQuote("")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote authors"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "Empty quote. Try adding a quote with some text.")
-	assert.EqualValues(t, len(p.quotes), 0)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote authors.")
+
+	p = initTestPlugin(t, "team", "mock")
+	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.AddQuote("quote 1")
+	resp, err = p.ShowAuthors(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
-	assert.EqualValues(t, resp.Text, "Added \"quote 1\" as quote number 1.")
-	assert.EqualValues(t, len(p.quotes), 1)
-}
+	assert.EqualValues(t, resp.Text, "We know who said every quote.")
 
-// TestShowHelp - Test the ShowHelp function.
-func TestShowHelp(t *testing.T) {
-	p := initTestPlugin(t, "normal", "mock")
+	p.AddQuote(testCommandArgs(""), "There's lots of primes! - Gus")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.AddQuote(testCommandArgs(""), "I feel pretty --@nobody")
 
-	resp, err := p.ShowHelp("userid")
+	// Quotes from before we looked.
+	p.Store("teamid").Add(Quote{Text: "Old quote. - Rob"})
+	p.Store("teamid").Add(Quote{Text: "Old quote 5"})
+
+	resp, err = p.ShowAuthors(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, helpText)
+	assert.EqualValues(t, resp.Text, "There are 3 quotes to check. Use /quote author *x* *who said it* to fix them."+
+		"\n* 2 = \"quote 2\" - No attribution found."+
+		"\n* 3 = \"I feel pretty --@nobody\" - @nobody isn't a user here."+
+		"\n* 5 = \"Old quote 5\" - No attribution found.")
+	assert.EqualValues(t, testQuotes(t, p)[3].Author, "Rob")
+
+	p.AuthorQuote(testCommandArgs(""), "2 Gus")
+	p.AuthorQuote(testCommandArgs(""), "3 @shane")
+	p.EditQuote(testCommandArgs(""), "5 Old quote 5. - Rob")
+
+	resp, err = p.ShowAuthors(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "We know who said every quote.")
 }
 
-// TestShowInfo - Test the ShowInfo function.
-func TestShowInfo(t *testing.T) {
+// TestShowDamage - Test the ShowDamage function.
+func TestShowDamage(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err := p.ShowInfo("userid")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote damage"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "You are a User. Quotebot knows 0 quotes. Monitoring mock for activity every 15 minutes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote damage.")
 
-	p = initTestPlugin(t, "normal", "fail")
+	p = initTestPlugin(t, "system", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.ShowInfo("userid")
-	assert.NotNil(t, resp)
+	resp, err = p.ShowDamage(testCommandArgs(""), "")
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text,
-		"You are a User. Quotebot knows 0 quotes. Monitoring a non-existent channel. An Admin should fix that.")
+	assert.EqualValues(t, resp.Text, "There aren't any damaged quotes to check.")
+	resp, err = p.ShowDamage(testCommandArgs(""), "ok")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any damaged quotes to check.")
+	resp, err = p.ShowDamage(testCommandArgs(""), "what")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Use /quote damage to list the damaged quotes, or /quote damage ok once you've checked them.")
 
-	p = initTestPlugin(t, "channel", "mock")
+	damage, err := p.quarantine(quoteKey(1), []byte(`{"te`), "Quote 1 was damaged beyond repair, and removed.")
+	assert.Nil(t, err)
+	p.stateLock.Lock()
+	p.readOnly = true
+	p.stateLock.Unlock()
+
+	resp, err = p.ShowDamage(testCommandArgs(""), "")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 1 damaged values to check.\n"+
+		"* "+FormatTime(damage.CreateAt)+" - Quote 1 was damaged beyond repair, and removed. The original is kept as `"+damage.BackupKey+"`.\n"+
+		"\nOnce you've checked them, use /quote damage ok to start changing quotes again.")
+
+	resp, err = p.ShowInfo(testCommandArgs(""))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(resp.Text, " Quotebot found damaged quotes, and won't change any until an Admin checks them."))
+
+	resp, err = p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote damage OK"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Thanks for checking the 1 damaged values. Quotebot can change quotes again.")
+	assert.False(t, p.readOnly)
+}
+
+// TestShowSnapshots - Test the ShowSnapshots function.
+func TestShowSnapshots(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.ShowInfo("userid")
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote snapshots"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "You are an Admin. Quotebot knows 0 quotes. Monitoring mock for activity every 15 minutes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote snapshots.")
 
-	p = initTestPlugin(t, "channel", "fail")
+	p = initTestPlugin(t, "system", "mock")
 	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.ShowInfo("userid")
+	resp, err = p.ShowSnapshots(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "You are an Admin. Quotebot knows 0 quotes. Monitoring a non-existent channel. An Admin should fix that.")
+	assert.EqualValues(t, resp.Text, "There aren't any snapshots yet.")
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.SaveSnapshot(testCommandArgs(""), "mine")
+	p.DeleteQuote(testCommandArgs(""), "1")
+	p.DeleteQuote(testCommandArgs(""), "1") // Already deleted, so no snapshot.
+	infos, _ := p.Snapshots()
+	assert.EqualValues(t, len(infos), 2)
+
+	// Quotebot snapshots by itself before purging the trash.
+	p.Store("teamid").Replace(1, nil, []Quote{{ID: 1, Text: "quote 1", DeleteAt: 1, DeletedBy: "userid"}})
+	p.PurgeTrash()
+	infos, _ = p.Snapshots()
+	assert.EqualValues(t, len(infos), 3)
+
+	resp, err = p.ShowSnapshots(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 3 snapshots.\n"+
+		"* mine - "+FormatTime(infos[0].CreateAt)+" by @Someone\n"+
+		"* "+infos[1].Name+" - "+FormatTime(infos[1].CreateAt)+" by @Someone, before deleting quote 1\n"+
+		"* "+infos[2].Name+" - "+FormatTime(infos[2].CreateAt)+" by Quotebot, before purging the trash")
 }
 
-// TestShowQuote - Test the ShowQuote function.
-func TestShowQuote(t *testing.T) {
+// TestShowTrash - Test the ShowTrash function.
+func TestShowTrash(t *testing.T) {
+	// Regular user testing.
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
-	assert.EqualValues(t, len(p.quotes), 0)
 
-	resp, err := p.ShowQuote("userid", "foo") // "" calls ShowRandom() instead of ShowQuote().
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote trash"))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, helpText)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote trash.")
 
-	resp, err = p.ShowQuote("userid", "1")
-	assert.NotNil(t, resp)
-	assert.Nil(t, err)
-	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
-	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
+	// Admin testing.
+	p = initTestPlugin(t, "team", "mock")
+	assert.Nil(t, p.OnActivate())
 
-	resp, err = p.AddQuote("quote 1")
+	resp, err = p.ShowTrash(testCommandArgs(""), "")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 0 quotes in the trash. They're deleted for good after 30 days.")
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.DeleteQuote(testCommandArgs(""), "2")
+	trash, _ := p.Store("teamid").Trash()
 
-	resp, err = p.ShowQuote("userid", "1")
+	resp, err = p.ShowTrash(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "There are 1 quotes in the trash. They're deleted for good after 30 days.\n"+
+		"* 2 = \"quote 2\", deleted by @Someone on "+FormatTime(trash[0].DeleteAt))
+
+	// Keeping them forever.
+	configuration := p.getConfiguration().Clone()
+	configuration.TrashRetentionDays = "0"
+	p.setConfiguration(configuration)
+
+	resp, err = p.ShowTrash(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.Contains(t, resp.Text, "There are 1 quotes in the trash.\n")
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot commands
+// -----------------------------------------------------------------------------
+
+// TestAddQuote - Test the AddQuote function.
+func TestAddQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	assert.EqualValues(t, len(testQuotes(t, p)), 0)
+
+	resp, err := p.AddQuote(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Empty quote. Try adding a quote with some text.")
+	assert.EqualValues(t, len(testQuotes(t, p)), 0)
+
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "Added \"quote 1\" as quote number 1.")
+	assert.EqualValues(t, len(testQuotes(t, p)), 1)
+	assert.EqualValues(t, testQuotes(t, p)[0].ID, 1)
+	assert.EqualValues(t, testQuotes(t, p)[0].Text, "quote 1")
+	assert.EqualValues(t, testQuotes(t, p)[0].UserID, "userid")
+	assert.EqualValues(t, testQuotes(t, p)[0].ChannelID, "channelid")
+	assert.EqualValues(t, testQuotes(t, p)[0].TeamID, "teamid")
+
+	// Duplicates.
+	resp, err = p.AddQuote(testCommandArgs(""), "“Quote 1”")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "That's already quote #1.")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "--force quote 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "That's already quote #1.")
+	assert.EqualValues(t, len(testQuotes(t, p)), 1)
+
+	p.AddQuote(testCommandArgs(""), "I feel pretty, oh so pretty. -- @shane")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "I feel pretty; oh, so pretty! ~Bob")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "That looks a lot like quote #2, \"I feel pretty, oh so pretty. -- @shane\". "+
+		"If it's really different, use /quote add --force I feel pretty; oh, so pretty! ~Bob")
+	assert.EqualValues(t, len(testQuotes(t, p)), 2)
+
+	resp, err = p.AddQuote(testCommandArgs(""), "--force I feel pretty; oh, so pretty! ~Bob")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "Added \"I feel pretty; oh, so pretty! ~Bob\" as quote number 3.")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "--force")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Empty quote. Try adding a quote with some text.")
+
+	// Tags.
+	resp, err = p.AddQuote(testCommandArgs(""), "#work #Gus There's lots of primes! - Gus")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "Added \"There's lots of primes! - Gus\" as quote number 4, tagged #gus #work.")
+	assert.EqualValues(t, testQuotes(t, p)[3].Text, "There's lots of primes! - Gus")
+	assert.EqualValues(t, testQuotes(t, p)[3].Tags, []string{"gus", "work"})
+	assert.EqualValues(t, testQuotes(t, p)[3].Author, "Gus")
+	assert.EqualValues(t, testQuotes(t, p)[3].Speakers, []Speaker{{Name: "Gus"}})
+
+	resp, err = p.AddQuote(testCommandArgs(""), "#work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Empty quote. Try adding a quote with some text.")
+}
+
+// TestEditQuote - Test the EditQuote function.
+func TestEditQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.EditQuote(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Empty quote. Try editing it to have some text.")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "1 quote one")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't edit quote 1, it doesn't exist.")
+
+	// You can edit your own quotes.
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "1  quote one ")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "Quote 1 is now \"quote one\".")
+	assert.EqualValues(t, testQuotes(t, p)[0].Text, "quote one")
+	assert.EqualValues(t, testQuotes(t, p)[0].Revisions[0].Text, "quote 1")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "1 quote one")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Quote 1 already says that.")
+
+	// But not anyone else's.
+	args := testCommandArgs("")
+	args.UserId = "otherid"
+	p.AddQuote(args, "quote 2")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "2 quote two")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only admins and whoever added quote 2 can change it.")
+	assert.EqualValues(t, testQuotes(t, p)[1].Text, "quote 2")
+
+	// Unless you're an admin.
+	p = initTestPlugin(t, "team", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(args, "quote 1")
+
+	resp, err = p.EditQuote(testCommandArgs(""), "1 quote one")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is now \"quote one\".")
+	assert.EqualValues(t, testQuotes(t, p)[0].EditedBy, "userid")
+}
+
+// TestListQuotes - Test the ListQuotes function.
+func TestListQuotes(t *testing.T) {
+	// Anyone can list the quotes.
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	setTestStore(p, "teamid", NewMemoryQuoteStore()) // Commands don't care where quotes live.
+
+	resp, err := p.ListQuotes(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "There are 0 quotes on file.")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 1 quotes on file.\n* 1 = \"quote 1\"")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "#work quote 2")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 2 quotes on file.\n* 1 = \"quote 1\"\n* 2 = \"quote 2\" #work")
+
+	// Filtering and sorting.
+	now := model.GetMillis()
+	store := p.Store("teamid")
+	_, err = store.Add(Quote{Text: "So long, and thanks for all the fish.", Speakers: []Speaker{{Name: "gus", UserID: "gusid"}}, CreateAt: now + 1})
+	assert.Nil(t, err)
+	_, err = store.Add(Quote{Text: "It’s so long since I’ve seen you.", Author: "Rob", CreateAt: now + 2})
+	assert.Nil(t, err)
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "--author @Gus")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "1 of the 4 quotes on file match.\n* 3 = \"So long, and thanks for all the fish.\"")
+
+	resp, err = p.ListQuotes(testCommandArgs(""), `--contains="so long" --sort newest`)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "2 of the 4 quotes on file match.\n* 4 = \"It’s so long since I’ve seen you.\"\n* 3 = \"So long, and thanks for all the fish.\"")
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "--contains \"it's so\" --author rob")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "1 of the 4 quotes on file match.\n* 4 = \"It’s so long since I’ve seen you.\"")
+
+	// Pages.
+	for idx := 0; idx < 40; idx++ {
+		_, err = store.Add(Quote{Text: fmt.Sprintf("%02d %s", idx, strings.Repeat("x", 1000)), CreateAt: now + int64(idx+3)})
+		assert.Nil(t, err)
+	}
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "There are 44 quotes on file.\n* 1 = \"quote 1\"\n"))
+	assert.True(t, strings.HasSuffix(resp.Text, "\n\nPage 1 of 3. For the next page, use /quote list page 2."))
+	assert.True(t, utf8.RuneCountInString(resp.Text) <= model.POST_MESSAGE_MAX_RUNES_V2)
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "page 2 --sort newest --contains xxx")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "40 of the 44 quotes on file match.\n* "))
+	assert.True(t, strings.HasSuffix(resp.Text, "\n\nPage 2 of 3. For the next page, use /quote list page 3 --contains xxx --sort newest."))
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "PAGE 3")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(resp.Text, "* 44 = \"39 "+strings.Repeat("x", 1000)+"\"\n\nPage 3 of 3."))
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "page 4")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 44 quotes on file. There's no page 4; there are only 3.")
+
+	// Mistakes.
+	resp, err = p.ListQuotes(testCommandArgs(""), "page two")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "\"two\" isn't a page number. Pages are numbered from 1.\nUsage: /quote list [page *n*]"))
+
+	resp, err = p.ListQuotes(testCommandArgs(""), "--sort sideways")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "Quotes can be sorted newest or oldest, not \"sideways\".\n"))
+
+	resp, err = p.ListQuotes(testCommandArgs("/quote list --author \"Gus"), "--author \"Gus")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotebot couldn't read that. Column 22: This \" is never closed.\n```\n/quote list --author \"Gus\n                     ^\n```")
+}
+
+// TestRevertQuote - Test the RevertQuote function.
+func TestRevertQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.RevertQuote(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What version? Use /quote history 1 to see them.")
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "1 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't revert quote 1, it doesn't exist.")
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.EditQuote(testCommandArgs(""), "1 quote one")
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "1 3")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 doesn't have a version 3. Use /quote history 1 to see them.")
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "1 2")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 already says that.")
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "1 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "Reverted quote 1 to version 1, \"quote 1\".")
+
+	// Reverting is just another edit, so it's in the history too.
+	quote := testQuotes(t, p)[0]
+	assert.EqualValues(t, quote.Text, "quote 1")
+	assert.EqualValues(t, len(quote.Versions()), 3)
+
+	args := testCommandArgs("")
+	args.UserId = "otherid"
+	p.AddQuote(args, "quote 2")
+	p.Store("teamid").Update(2, func(quote *Quote) bool {
+		return quote.Revise("quote two", "otherid")
+	})
+
+	resp, err = p.RevertQuote(testCommandArgs(""), "2 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins and whoever added quote 2 can change it.")
+}
+
+// TestSearchQuotes - Test the SearchQuotes function.
+func TestSearchQuotes(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.SearchQuotes(testCommandArgs(""), " ")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "What are you looking for? Try /quote search *some words*.")
+
+	resp, err = p.SearchQuotes(testCommandArgs(""), "primes")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "No quotes match \"primes\".")
+
+	p.AddQuote(testCommandArgs(""), "There's lots of primes! - Gus")
+	p.AddQuote(testCommandArgs(""), "Prime time.")
+	p.AddQuote(testCommandArgs(""), "quote 3")
+
+	resp, err = p.SearchQuotes(testCommandArgs(""), "PRIMES, Gus?")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Found 1 quotes matching \"PRIMES, Gus?\".\n* 1 = There's lots of **primes**! - **Gus**")
+
+	resp, err = p.SearchQuotes(testCommandArgs(""), "prime")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Found 2 quotes matching \"prime\".\n* 2 = **Prime** time.\n* 1 = There's lots of **primes**! - Gus")
+
+	// Only the best ones.
+	for idx := 0; idx < searchResultLimit; idx++ {
+		p.AddQuote(testCommandArgs(""), fmt.Sprintf("Prime number %d.", idx))
+	}
+
+	resp, err = p.SearchQuotes(testCommandArgs(""), "prime")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.Contains(t, resp.Text, "Found 12 quotes matching \"prime\". Here are the best 10.")
+	assert.EqualValues(t, strings.Count(resp.Text, "\n"), searchResultLimit)
+}
+
+// TestShowHelp - Test the ShowHelp function.
+func TestShowHelp(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+
+	resp, err := p.ShowHelp("userid")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, helpText())
+}
+
+// TestShowHistory - Test the ShowHistory function.
+func TestShowHistory(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ShowHistory(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
+
+	resp, err = p.ShowHistory(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 doesn't exist, so it doesn't have a history.")
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.EditQuote(testCommandArgs(""), "1 quote one")
+	versions := testQuotes(t, p)[0].Versions()
+
+	resp, err = p.ShowHistory(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Quote 1 has 2 versions.\n"+
+		"1. \"quote 1\", by @Someone on "+FormatTime(versions[0].CreateAt)+"\n"+
+		"2. \"quote one\", by @Someone on "+FormatTime(versions[1].CreateAt))
+}
+
+// TestShowInfo - Test the ShowInfo function.
+func TestShowInfo(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ShowInfo(testCommandArgs(""))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "You are a User. Quotebot knows 0 quotes. Monitoring mock for activity every 15 minutes.")
+
+	p = initTestPlugin(t, "normal", "fail")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err = p.ShowInfo(testCommandArgs(""))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text,
+		"You are a User. Quotebot knows 0 quotes. Monitoring a non-existent channel. An Admin should fix that.")
+
+	p = initTestPlugin(t, "channel", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err = p.ShowInfo(testCommandArgs(""))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "You are an Admin. Quotebot knows 0 quotes. Monitoring mock for activity every 15 minutes.")
+
+	p = initTestPlugin(t, "channel", "fail")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err = p.ShowInfo(testCommandArgs(""))
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "You are an Admin. Quotebot knows 0 quotes. Monitoring a non-existent channel. An Admin should fix that.")
+}
+
+// TestShowQuote - Test the ShowQuote function.
+func TestShowQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	assert.EqualValues(t, len(testQuotes(t, p)), 0)
+
+	resp, err := p.ShowQuote(testCommandArgs(""), "foo") // "" calls ShowRandom() instead of ShowQuote().
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "No quotes match foo.")
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
+
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "1")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
 	assert.EqualValues(t, resp.Text, "> quote 1")
 
-	resp, err = p.ShowQuote("userid", "2")
+	resp, err = p.ShowQuote(testCommandArgs(""), "2")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "Unable to show quote 2, it doesn't exist yet. There are 1 quotes on file.")
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "0")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Unable to show quote 0, it doesn't exist yet. There are 1 quotes on file.")
+
+	// Deleted quotes say so.
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.Store("teamid").Delete(1, "userid")
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Quote 1 was deleted.")
+
+	resp, err = p.ShowQuote(testCommandArgs(""), "2")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "> quote 2")
+}
+
+// TestShowQuoteTagged - Test the ShowQuote function with a tag.
+func TestShowQuoteTagged(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ShowQuote(testCommandArgs(""), "#work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "No quotes match #work.")
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.AddQuote(testCommandArgs(""), "#work quote 2")
+	p.AddQuote(testCommandArgs(""), "#play quote 3")
+
+	for idx := 0; idx < 10; idx++ {
+		resp, err = p.ShowQuote(testCommandArgs(""), "#Work")
+		assert.NotNil(t, resp)
+		assert.Nil(t, err)
+		assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+		assert.EqualValues(t, resp.Text, "> quote 2")
+	}
+
+	resp, err = p.ShowQuote(testCommandArgs("/quote #3"), "#3")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotebot couldn't read that. Column 8: \"#3\" isn't a tag. Tags start with a letter, and have letters, numbers, - and _.\n```\n/quote #3\n       ^\n```")
+}
+
+// TestShowQuoteQuery - Test the ShowQuote function with a query.
+func TestShowQuoteQuery(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	setTestStore(p, "teamid", NewMemoryQuoteStore()) // Commands don't care where quotes live.
+
+	store := p.Store("teamid")
+	store.Add(Quote{Text: "Primes are odd. -- Gus", Speakers: []Speaker{{Name: "gus"}}, Tags: []string{"work"}, CreateAt: 1704067200000}) // 2024-01-01
+	store.Add(Quote{Text: "Primes are fun. -- Gus", Speakers: []Speaker{{Name: "gus"}}, Tags: []string{"nsfw", "work"}, CreateAt: 1704067200000})
+	store.Add(Quote{Text: "Primes are old. -- Gus", Speakers: []Speaker{{Name: "gus"}}, Tags: []string{"work"}, CreateAt: 1672531200000}) // 2023-01-01
+	store.Add(Quote{Text: "Evens are odd. -- Gus", Speakers: []Speaker{{Name: "gus"}}, Tags: []string{"work"}, CreateAt: 1704067200000})
+	store.Add(Quote{Text: "Primes are odd. -- Rob", Speakers: []Speaker{{Name: "rob"}}, Tags: []string{"work"}, CreateAt: 1704067200000})
+
+	for idx := 0; idx < 10; idx++ {
+		resp, err := p.ShowQuote(testCommandArgs(""), `@gus #work -#nsfw since:2024 "primes"`)
+		assert.Nil(t, err)
+		assert.EqualValues(t, resp.Text, "> Primes are odd. -- Gus")
+	}
+
+	resp, err := p.ShowQuote(testCommandArgs(""), `@gus since:2025`)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "No quotes match @gus since:2025.")
+
+	resp, err = p.ShowQuote(testCommandArgs("/quote @gus since:last-week"), "@gus since:last-week")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotebot couldn't read that. Column 13: \"last-week\" isn't a date. Use a year like since:2024, a month like since:2024-03, or a day like since:2024-03-15.\n```\n/quote @gus since:last-week\n            ^\n```")
+}
+
+// TestShowQuoteFrom - Random quotes from someone, linked or not.
+func TestShowQuoteFrom(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	setTestStore(p, "teamid", NewMemoryQuoteStore()) // Commands don't care where quotes live.
+
+	store := p.Store("teamid")
+	store.Add(Quote{Text: "I feel pretty. -- @shanedev", Speakers: []Speaker{{Name: "shanedev", UserID: "shaneid"}}}) // Before a rename.
+	store.Add(Quote{Text: "Primes are odd. -- Gus M", Speakers: []Speaker{{Name: "Gus M"}}})
+	store.Add(Quote{Text: "From before speakers. -- Rob", Author: "Rob"})
+
+	tests := map[string]string{
+		"@shane":         "> I feel pretty. -- @shanedev",
+		"from @Shane":    "> I feel pretty. -- @shanedev",
+		"from gus m":     "> Primes are odd. -- Gus M",
+		`from "Gus M"`:   "> Primes are odd. -- Gus M",
+		"from rob":       "> From before speakers. -- Rob",
+		"@rob":           "> From before speakers. -- Rob",
+		"@anthony":       "There aren't any quotes from anthony.",
+		"FROM Anthony B": "There aren't any quotes from Anthony B.",
+		"from":           "From who? Put a name after from, like /quote from Gus.",
+		"from @":         "From who? Put a name after from, like /quote from Gus.",
+		`"from" pretty`:  "No quotes match from pretty.",
+	}
+	for tail, expected := range tests {
+		resp, err := p.ShowQuote(testCommandArgs(""), tail)
+		assert.Nil(t, err, tail)
+		assert.EqualValues(t, resp.Text, expected, tail)
+	}
+
+	// Linked users are named as users.
+	store.Delete(1, "userid")
+	resp, err := p.ShowQuote(testCommandArgs(""), "@shane")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any quotes from @shane.")
 }
 
 // TestShowRandom - Test the ShowRandom function.
 func TestShowRandom(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
-	assert.EqualValues(t, len(p.quotes), 0)
+	setTestStore(p, "teamid", NewMemoryQuoteStore()) // Commands don't care where quotes live.
+	assert.EqualValues(t, len(testQuotes(t, p)), 0)
 
-	resp, err := p.ShowRandom("userid")
+	resp, err := p.ShowRandom(testCommandArgs(""))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
 	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
 
-	resp, err = p.AddQuote("quote 1")
+	resp, err = p.AddQuote(testCommandArgs(""), "quote 1")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 
-	resp, err = p.ShowRandom("userid")
+	resp, err = p.ShowRandom(testCommandArgs(""))
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
 	assert.EqualValues(t, resp.Text, "> quote 1")
 }
+
+// TestShowTags - Test the ShowTags function.
+func TestShowTags(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.ShowTags(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "There aren't any tags yet.")
+
+	p.AddQuote(testCommandArgs(""), "#work #gus quote 1")
+	p.AddQuote(testCommandArgs(""), "#work quote 2")
+	p.AddQuote(testCommandArgs(""), "quote 3")
+
+	resp, err = p.ShowTags(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 2 tags.\n* #gus - 1 quotes\n* #work - 2 quotes")
+}
+
+// TestTagQuote - Test the TagQuote function.
+func TestTagQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	resp, err := p.TagQuote(testCommandArgs(""), "")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote number.")
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1 +work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't tag quote 1, it doesn't exist.")
+
+	// You can tag your own quotes.
+	p.AddQuote(testCommandArgs(""), "#gus quote 1")
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is tagged #gus.")
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1 +work #Math -gus")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is tagged #math #work.")
+	assert.EqualValues(t, testQuotes(t, p)[0].Tags, []string{"math", "work"})
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1 -#math -work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 doesn't have any tags.")
+	assert.Nil(t, testQuotes(t, p)[0].Tags)
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1 +work!")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "\"+work!\" isn't a tag. Tags start with a letter, and have letters, numbers, - and _.")
+
+	// But not anyone else's.
+	args := testCommandArgs("")
+	args.UserId = "otherid"
+	p.AddQuote(args, "quote 2")
+
+	resp, err = p.TagQuote(testCommandArgs(""), "2 +work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins and whoever added quote 2 can change it.")
+	assert.Nil(t, testQuotes(t, p)[1].Tags)
+
+	// Unless you're an admin.
+	p = initTestPlugin(t, "team", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(args, "quote 1")
+
+	resp, err = p.TagQuote(testCommandArgs(""), "1 work")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 1 is tagged #work.")
+}
+
+// -----------------------------------------------------------------------------
+// Command utilities
+// -----------------------------------------------------------------------------
+
+// TestDescribeImport - Test the describeImport function.
+func TestDescribeImport(t *testing.T) {
+	assert.EqualValues(t, describeImport("quotes.json", ImportResult{AddedQuotes: 2, SkippedQuotes: 1}),
+		"quotes.json: added 2 quotes, skipped 1.")
+	assert.EqualValues(t, describeImport("responses.json", ImportResult{AddedResponses: 2}),
+		"responses.json: added 2 responses, skipped 0.")
+	assert.EqualValues(t, describeImport("both.json", ImportResult{AddedQuotes: 1, AddedResponses: 2, SkippedResponses: 1}),
+		"both.json: added 1 quotes, skipped 0; added 2 responses, skipped 1.")
+	assert.EqualValues(t, describeImport("empty.txt", ImportResult{}), "empty.txt: added 0 quotes, skipped 0.")
+	assert.EqualValues(t, describeImport("quotes.json", ImportResult{AddedQuotes: 3, Restored: true}),
+		"quotes.json: restored 3 quotes exactly as they were exported.")
+}
+
+// TestTakeFlag - Test the takeFlag function.
+func TestTakeFlag(t *testing.T) {
+	tail, found := takeFlag("", "--here")
+	assert.False(t, found)
+	assert.EqualValues(t, tail, "")
+
+	tail, found = takeFlag("--here", "--here")
+	assert.True(t, found)
+	assert.EqualValues(t, tail, "")
+
+	tail, found = takeFlag("  --here some  quote\nline two", "--here")
+	assert.True(t, found)
+	assert.EqualValues(t, tail, "some  quote\nline two")
+
+	tail, found = takeFlag("--force --here some quote", "--here")
+	assert.True(t, found)
+	assert.EqualValues(t, tail, "--force some quote")
+
+	// Only flags at the start count.
+	tail, found = takeFlag("some quote --here", "--here")
+	assert.False(t, found)
+	assert.EqualValues(t, tail, "some quote --here")
+
+	tail, found = takeFlag("--herein", "--here")
+	assert.False(t, found)
+	assert.EqualValues(t, tail, "--herein")
+}
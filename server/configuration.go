@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strconv"
+
 	"github.com/pkg/errors"
 )
 
@@ -16,9 +18,30 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
-	postDelta   float64 // Minutes between posting random quotations.
-	postChannel string  // Channel to post random quotations to.
-	postUser    string  // Name of the user to post as.
+	postDelta         float64 // Minutes between posting random quotations.
+	postChannel       string  // Channel to post random quotations to.
+	postChannelQuotes bool    // Post the channel's own quotes instead of the team's?
+	postUser          string  // Name of the user to post as.
+
+	// Days to keep deleted quotes in the trash; 0 keeps them forever. It's a
+	// string because that's what text settings give us.
+	TrashRetentionDays string
+
+	// Every team gets its own quotes, unless SharedQuotes is on. If
+	// MigrateToTeam names a team, the quotes from before there were teams'
+	// quotes are moved to that team when the plugin starts.
+	SharedQuotes  bool
+	MigrateToTeam string
+
+	// Only quotes matching this query, like "#work -#nsfw", are posted at
+	// random. Empty posts any of them.
+	PostQuery string
+
+	// If QuoteDirectory is set, the quotes are kept in JSON files in that
+	// directory on the server instead of the key-value store, for
+	// development. Snapshots, repairs and migrations only cover the key-value
+	// store.
+	QuoteDirectory string
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -28,6 +51,17 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// trashRetentionDays returns the number of days to keep deleted quotes in the trash, or 0 to
+// keep them forever.
+func (c *configuration) trashRetentionDays() int {
+	days, err := strconv.Atoi(c.TrashRetentionDays)
+	if err != nil || days < 0 {
+		return defaultTrashRetentionDays
+	}
+
+	return days
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -86,7 +120,13 @@ func (p *QuotebotPlugin) OnConfigurationChange() error {
 	configuration := new(configuration)
 	err := p.loadConfiguration(configuration)
 	if err == nil {
+		quoteDirectory := p.getConfiguration().QuoteDirectory
 		p.setConfiguration(configuration)
+
+		// The collections we've opened are in the wrong place now.
+		if configuration.QuoteDirectory != quoteDirectory {
+			p.closeCollections()
+		}
 	}
 
 	return nil
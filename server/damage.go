@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store keys for damaged values. When a value can't be loaded,
+	// the original is copied to its own key before it's repaired, and
+	// damageKey lists them. Snapshots leave them alone.
+	damageKeyPrefix string = "damaged_"
+	damageKey       string = "damage"
+
+	damageAdminPageSize int = 100 // Users per page when looking for admins to tell.
+)
+
+// Damage - A value we couldn't load when we started, and what we did about it.
+type Damage struct {
+	Key            string `json:"key"`                       // Where it was.
+	BackupKey      string `json:"backup_key"`                // Where the original is kept.
+	Problem        string `json:"problem"`                   // What was wrong, and what we salvaged.
+	CreateAt       int64  `json:"create_at"`                 // In milliseconds since the epoch.
+	AcknowledgeAt  int64  `json:"acknowledge_at,omitempty"`  // When an admin said they'd checked it.
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"` // User ID of that admin.
+}
+
+// isDamageKey - Is key one of the damage keys, which snapshots leave alone?
+func isDamageKey(key string) bool {
+	return key == damageKey || strings.HasPrefix(key, damageKeyPrefix)
+}
+
+// -----------------------------------------------------------------------------
+// Salvaging damaged JSON
+// -----------------------------------------------------------------------------
+
+// salvageFrame - An object or array salvageJSON is in the middle of.
+type salvageFrame struct {
+	object   bool // Is it an object, rather than an array?
+	items    int  // How many complete items (values, or key-value pairs) it has.
+	key      bool // In an object, is the next token a key?
+	complete int  // The length of the output after its last complete item.
+}
+
+// salvageJSON - Everything in raw up to the first damage, as valid JSON.
+//
+// Objects and arrays cut short by the damage are closed after their last
+// complete item, so a list of quotes that was cut off part way through keeps
+// the quotes before the cut. Returns nil if there's nothing to salvage.
+func salvageJSON(raw []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var out bytes.Buffer
+	var stack []*salvageFrame
+
+	// finish - A value just ended; count it in the object or array it's in.
+	finish := func() {
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			top.items++
+			top.key = top.object
+			top.complete = out.Len()
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteRune(rune(delim))
+			finish()
+		} else {
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if top.items > 0 && (top.object == false || top.key) {
+					out.WriteByte(',')
+				}
+			}
+
+			if isDelim {
+				out.WriteRune(rune(delim))
+				stack = append(stack, &salvageFrame{object: delim == '{', key: delim == '{', complete: out.Len()})
+			} else {
+				// Without json.Marshal's HTML escaping, so text comes back as it was.
+				var value bytes.Buffer
+				encoder := json.NewEncoder(&value)
+				encoder.SetEscapeHTML(false)
+				if encoder.Encode(token) != nil {
+					break
+				}
+				out.Write(bytes.TrimSuffix(value.Bytes(), []byte("\n")))
+
+				if len(stack) > 0 && stack[len(stack)-1].key {
+					out.WriteByte(':')
+					stack[len(stack)-1].key = false
+				} else {
+					finish()
+				}
+			}
+		}
+
+		if len(stack) == 0 {
+			break
+		}
+	}
+
+	// Close whatever the damage cut short.
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		out.Truncate(top.complete)
+		if top.object {
+			out.WriteByte('}')
+		} else {
+			out.WriteByte(']')
+		}
+		stack = stack[:len(stack)-1]
+		finish()
+	}
+
+	if out.Len() == 0 {
+		return nil
+	}
+
+	return out.Bytes()
+}
+
+// salvageQuote - Whatever we can get out of a damaged quote, or nil if it
+// doesn't even have any text left. Fields that are damaged are left out.
+func salvageQuote(raw []byte) *Quote {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(salvageJSON(raw), &fields)
+	if err != nil {
+		return nil
+	}
+
+	// One field at a time, so a damaged field doesn't take the rest with it.
+	var quote Quote
+	for name, value := range fields {
+		field, err := json.Marshal(map[string]json.RawMessage{name: value})
+		if err == nil {
+			json.Unmarshal(field, &quote)
+		}
+	}
+	if strings.TrimSpace(quote.Text) == "" {
+		return nil
+	}
+
+	return &quote
+}
+
+// salvageQuotes - Whatever we can get out of a damaged list of quotes (or
+// quote strings, from older versions). Quotes without an ID get their place
+// in the list, like QuotesFromStrings gives them.
+func salvageQuotes(raw []byte) []Quote {
+	var items []json.RawMessage
+	err := json.Unmarshal(salvageJSON(raw), &items)
+	if err != nil {
+		return nil
+	}
+
+	var quotes []Quote
+	for idx := range items {
+		var text string
+		quote := &Quote{}
+		if json.Unmarshal(items[idx], &text) == nil {
+			quote.Text = text
+		} else {
+			quote = salvageQuote(items[idx])
+		}
+		if quote == nil || strings.TrimSpace(quote.Text) == "" {
+			continue
+		}
+
+		if quote.ID == 0 {
+			quote.ID = idx + 1
+		}
+		quotes = append(quotes, *quote)
+	}
+
+	return quotes
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// loadDamage - Load the list of damaged values, and its raw value for
+// compare-and-set.
+func (p *QuotebotPlugin) loadDamage() ([]Damage, []byte, *model.AppError) {
+	var damage []Damage
+	raw, err := p.loadJSONKey(damageKey, &damage, "the damaged quotes")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return damage, raw, nil
+}
+
+// updateDamage - Change the list of damaged values with compare-and-set,
+// retrying if someone else changed it first. The update function returns the
+// new list.
+func (p *QuotebotPlugin) updateDamage(update func([]Damage) []Damage) *model.AppError {
+	var damage []Damage
+	return p.updateJSONKey(damageKey, &damage, "the damaged quotes", func() bool {
+		damage = update(damage)
+
+		return true
+	})
+}
+
+// Damage - Every damaged value nobody has checked yet, oldest first.
+func (p *QuotebotPlugin) Damage() ([]Damage, *model.AppError) {
+	damage, _, err := p.loadDamage()
+	if err != nil {
+		return nil, err
+	}
+
+	var unchecked []Damage
+	for idx := range damage {
+		if damage[idx].AcknowledgeAt == 0 {
+			unchecked = append(unchecked, damage[idx])
+		}
+	}
+
+	return unchecked, nil
+}
+
+// quarantine - Keep a copy of a damaged value under its own key before it's
+// repaired, and add it to the list of damage. problem says what was wrong.
+func (p *QuotebotPlugin) quarantine(key string, raw []byte, problem string) (*Damage, *model.AppError) {
+	// The random part keeps values quarantined at the same moment apart.
+	damage := Damage{
+		Key:       key,
+		BackupKey: fmt.Sprintf("%s%d-%04d", damageKeyPrefix, model.GetMillis(), rand.Intn(10000)),
+		Problem:   problem,
+		CreateAt:  model.GetMillis(),
+	}
+
+	err := p.API.KVSet(damage.BackupKey, raw)
+	if err != nil {
+		return nil, err
+	}
+	err = p.updateDamage(func(list []Damage) []Damage {
+		return append(list, damage)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.API.LogError(problem, "backup_key", damage.BackupKey)
+
+	return &damage, nil
+}
+
+// CheckQuotes - Look for damage in every collection, and repair what we can.
+// Damaged values are quarantined first. Quotebot is read-only while there's
+// damage an admin hasn't checked; returns the damage found this time.
+func (p *QuotebotPlugin) CheckQuotes() ([]Damage, *model.AppError) {
+	// Leave data from a newer version of Quotebot alone; we don't know what
+	// it should look like.
+	version, _, err := p.loadSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	err = p.checkSchemaVersion(version, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Damage
+	quarantine := func(key string, raw []byte, problem string) *model.AppError {
+		damage, err := p.quarantine(key, raw, problem)
+		if err == nil {
+			found = append(found, *damage)
+		}
+
+		return err
+	}
+
+	// List the keys once, and hand each collection its own.
+	keys, err := p.kvKeys()
+	if err != nil {
+		return nil, err
+	}
+	collectionKeys := make(map[string][]string)
+	for _, key := range keys {
+		name := keyCollection(key)
+		collectionKeys[name] = append(collectionKeys[name], key)
+	}
+
+	names, err := p.repairCollections(keys, quarantine)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		err = NewKVQuoteStore(p.API, name).Repair(collectionKeys[name], quarantine)
+		if err != nil {
+			return found, err
+		}
+	}
+
+	unchecked, err := p.Damage()
+	if err != nil {
+		return found, err
+	}
+	p.stateLock.Lock()
+	p.readOnly = len(unchecked) > 0
+	p.stateLock.Unlock()
+	if len(unchecked) > 0 && len(found) == 0 {
+		p.API.LogWarn("Quotebot is read-only until an admin checks the damaged quotes.", "damaged", len(unchecked))
+	}
+
+	return found, nil
+}
+
+// repairCollections - The names of every collection, including the shared
+// one. If the list is damaged, it's quarantined and worked out again from
+// keys, the keys in the key-value store.
+func (p *QuotebotPlugin) repairCollections(keys []string, quarantine func(string, []byte, string) *model.AppError) ([]string, *model.AppError) {
+	names, err := p.collections()
+	if err == nil {
+		return names, nil
+	}
+
+	raw, err := p.API.KVGet(collectionsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, key := range keys {
+		if strings.HasSuffix(key, "_"+lastQuoteIDKey) == false {
+			continue
+		}
+
+		name := strings.TrimSuffix(key, "_"+lastQuoteIDKey)
+		if strings.HasPrefix(name, teamCollectionPrefix) || strings.HasPrefix(name, channelCollectionPrefix) {
+			found[name] = true
+		}
+	}
+	names = nil
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	err = quarantine(collectionsKey, raw, fmt.Sprintf("The list of quote collections was damaged; found %d collections again.", len(names)))
+	if err != nil {
+		return nil, err
+	}
+	newRaw, jsonErr := json.Marshal(names)
+	if jsonErr != nil {
+		return nil, p.NewError("Unable to save quote collections.", fmt.Sprintf("json.Marshal(%v) failed.", names), "repairCollections")
+	}
+	err = p.API.KVSet(collectionsKey, newRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{sharedCollection}, names...), nil
+}
+
+// AcknowledgeDamage - An admin has checked the damage, so Quotebot can change
+// things again. Returns how much damage they checked.
+//
+// The caller must hold stateLock for writing, since this changes readOnly.
+func (p *QuotebotPlugin) AcknowledgeDamage(userID string) (int, *model.AppError) {
+	count := 0
+	now := model.GetMillis()
+	err := p.updateDamage(func(damage []Damage) []Damage {
+		count = 0
+		for idx := range damage {
+			if damage[idx].AcknowledgeAt == 0 {
+				damage[idx].AcknowledgeAt = now
+				damage[idx].AcknowledgedBy = userID
+				count++
+			}
+		}
+
+		return damage
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	p.readOnly = false
+
+	return count, nil
+}
+
+// isReadOnly - Is there damage an admin hasn't checked? For callers that
+// don't already hold stateLock.
+func (p *QuotebotPlugin) isReadOnly() bool {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+
+	return p.readOnly
+}
+
+// ReportDamage - Tell the system admins about damage, in a direct message.
+func (p *QuotebotPlugin) ReportDamage(damage []Damage) {
+	if len(damage) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("Quotebot found %d damaged values when it started, and kept copies before repairing them:\n", len(damage))
+	for idx := range damage {
+		message += fmt.Sprintf("\n* %s The original is kept as `%s`.", damage[idx].Problem, damage[idx].BackupKey)
+	}
+	message += "\n\nQuotebot won't change any quotes until an admin checks them and uses /quote damage ok."
+
+	for page := 0; ; page++ {
+		admins, err := p.API.GetUsers(&model.UserGetOptions{
+			Role:    model.SYSTEM_ADMIN_ROLE_ID,
+			Page:    page,
+			PerPage: damageAdminPageSize,
+		})
+		if err != nil {
+			p.API.LogError("Unable to find the admins to tell about damaged quotes.", "error", err.Error())
+			return
+		}
+
+		for _, admin := range admins {
+			err = p.SendMessage(admin.Id, message)
+			if err != nil {
+				p.API.LogError("Unable to tell an admin about damaged quotes.", "error", err.Error())
+			}
+		}
+		if len(admins) < damageAdminPageSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost-server/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSalvageJSON - Test the salvageJSON function.
+func TestSalvageJSON(t *testing.T) {
+	tests := []struct {
+		raw      string
+		salvaged string
+	}{
+		{`[1, 2, 3]`, `[1,2,3]`},
+		{`[1, 2, 3`, `[1,2,3]`},
+		{`[1, 2, 3,`, `[1,2,3]`},
+		{`["a", "b`, `["a"]`},
+		{`[{"id": 1, "text": "one"}, {"id": 2, "te`, `[{"id":1,"text":"one"},{"id":2}]`},
+		{`{"id": 3, "text": "three", "tags": ["a", "b"`, `{"id":3,"text":"three","tags":["a","b"]}`},
+		{`{"id": 3, "text": "three", "tags": ["a" "b"]}`, `{"id":3,"text":"three","tags":["a"]}`},
+		{`{"id": 3, "text": "three"}}}`, `{"id":3,"text":"three"}`},
+		{`{"text": "<three> & four"`, `{"text":"<three> & four"}`},
+		{`["a", {"b": [1.5, null, true]}, "c" garbage`, `["a",{"b":[1.5,null,true]},"c"]`},
+		{`garbage`, ``},
+		{``, ``},
+	}
+	for _, test := range tests {
+		assert.EqualValues(t, string(salvageJSON([]byte(test.raw))), test.salvaged, test.raw)
+		if test.salvaged != "" {
+			assert.True(t, json.Valid(salvageJSON([]byte(test.raw))), test.raw)
+		}
+	}
+}
+
+// TestSalvageQuote - Test the salvageQuote and salvageQuotes functions.
+func TestSalvageQuote(t *testing.T) {
+	quote := salvageQuote([]byte(`{"id": 3, "text": "quote 3", "create_at": "yesterday", "tags": ["work"], "user_id": "user`))
+	assert.EqualValues(t, quote, &Quote{ID: 3, Text: "quote 3", Tags: []string{"work"}})
+
+	assert.Nil(t, salvageQuote([]byte(`{"id": 3, "te`)))
+	assert.Nil(t, salvageQuote([]byte(`nope`)))
+
+	quotes := salvageQuotes([]byte(`["quote 1", {"id": 5, "text": "quote 5"}, {"text": "quote 3", "id": "three"}, 4, {"text": "quote 5`))
+	assert.EqualValues(t, quotes, []Quote{{ID: 1, Text: "quote 1"}, {ID: 5, Text: "quote 5"}, {ID: 3, Text: "quote 3"}})
+
+	assert.Nil(t, salvageQuotes([]byte(`{"text": "not a list"}`)))
+}
+
+// TestCheckQuotes - Damaged quotes are quarantined, repaired, and reported,
+// and Quotebot stays read-only until an admin checks them.
+func TestCheckQuotes(t *testing.T) {
+	api, kv := initKVAPI(t, "system", "mock", []byte(`["quote 1", "quote 2", "quote`))
+	kv.data["team_teamid_"+quoteKey(1)] = []byte(`{"id": 1, "text": "team quote 1", "delete_at": 1571300000000}`)
+	kv.data["team_teamid_"+quoteKey(2)] = []byte(`{"id": 2, "text": "team quote 2", "tags": ["wo`)
+	kv.data["team_teamid_"+quoteKey(3)] = []byte(`{"id": 3, "te`)
+	kv.data["team_teamid_"+quoteKey(4)] = []byte(`{"id": 4, "text": "team quote 4"}`)
+	kv.data["team_teamid_"+quoteIndexKey(0)] = []byte(`[2, 3, 4`)
+	kv.data["team_teamid_"+quoteTrashKey] = []byte(`[1]`)
+	kv.data["team_teamid_"+lastQuoteIDKey] = []byte(`four`)
+	kv.data[collectionsKey] = []byte(`["team_teamid"`)
+	api.On("GetUsers", &model.UserGetOptions{Role: model.SYSTEM_ADMIN_ROLE_ID, PerPage: damageAdminPageSize}).Return([]*model.User{{Id: "adminid"}}, (*model.AppError)(nil))
+	api.On("GetDirectChannel", "adminid", "adminid").Return(&model.Channel{Id: "dmid"}, (*model.AppError)(nil))
+	var posts []*model.Post
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		posts = append(posts, post)
+		return post
+	}, (*model.AppError)(nil))
+
+	p := &QuotebotPlugin{}
+	p.SetAPI(api)
+	assert.Nil(t, p.OnActivate())
+	assert.True(t, p.readOnly)
+
+	damage, err := p.Damage()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(damage), 6)
+	var problems []string
+	for idx := range damage {
+		problems = append(problems, damage[idx].Problem)
+
+		// The originals are kept.
+		assert.NotNil(t, kv.get(damage[idx].BackupKey))
+	}
+	assert.EqualValues(t, problems, []string{
+		"The list of quote collections was damaged; found 1 collections again.",
+		"The old list of quotes was damaged; salvaged 2 quotes from it.",
+		"Quote 2 was damaged; kept what was left of it.",
+		"Quote 3 was damaged beyond repair, and removed.",
+		"The last quote number was damaged; set it to 4, the highest one we have.",
+		"The list \"team_teamid_quote_index_0\" was damaged; made it again from the quotes.",
+	})
+	assert.EqualValues(t, string(kv.get(damage[0].BackupKey)), `["team_teamid"`)
+
+	// The admins heard about it.
+	assert.EqualValues(t, len(posts), 1)
+	assert.EqualValues(t, posts[0].ChannelId, "dmid")
+	assert.True(t, strings.HasPrefix(posts[0].Message, "Quotebot found 6 damaged values when it started"))
+
+	// What could be salvaged was.
+	quotes, err := p.collection(sharedCollection).List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, quotes, []Quote{{ID: 1, Text: "quote 1"}, {ID: 2, Text: "quote 2"}})
+	quotes = testQuotes(t, p)
+	assert.EqualValues(t, quotes, []Quote{{ID: 2, Text: "team quote 2"}, {ID: 4, Text: "team quote 4"}})
+	trash, err := p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 1)
+	lastID, err := p.Store("teamid").LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 4)
+
+	// Nothing changes the quotes until an admin checks.
+	resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote add quote 5"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotebot found damaged quotes, so it won't change any until an admin checks them with /quote damage.")
+	resp, err = p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote 4"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "> team quote 4")
+
+	// Checking again lists the keys once, not once for every collection.
+	kvLists := func() int {
+		count := 0
+		for _, call := range api.Calls {
+			if call.Method == "KVList" {
+				count++
+			}
+		}
+
+		return count
+	}
+	listed := kvLists()
+	_, err = p.CheckQuotes()
+	assert.Nil(t, err)
+	assert.EqualValues(t, kvLists()-listed, 1)
+
+	// Starting again doesn't find anything new, but it's still read-only.
+	assert.Nil(t, p.OnDeactivate())
+	assert.Nil(t, p.OnActivate())
+	assert.EqualValues(t, len(posts), 1)
+	resp, err = p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote add quote 5"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotebot found damaged quotes, so it won't change any until an admin checks them with /quote damage.")
+
+	resp, err = p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote damage ok"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Thanks for checking the 6 damaged values. Quotebot can change quotes again.")
+	damage, err = p.Damage()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(damage), 0)
+
+	resp, err = p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote add quote 5"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Added \"quote 5\" as quote number 5.")
+
+	// Snapshots leave the damage alone.
+	_, err = p.Snapshot("after", "userid", "")
+	assert.Nil(t, err)
+	raw, _ := api.KVGet(snapshotKeyPrefix + "after")
+	assert.False(t, strings.Contains(string(raw), damageKeyPrefix))
+}
+
+// TestCheckQuotesNewerSchema - Data from a newer Quotebot isn't repaired.
+func TestCheckQuotesNewerSchema(t *testing.T) {
+	api, kv := initKVAPI(t, "system", "mock", nil)
+	kv.data[schemaVersionKey] = []byte("1000")
+	kv.data[quoteKey(1)] = []byte(`{"id": 1, "te`)
+
+	p := &QuotebotPlugin{}
+	p.SetAPI(api)
+	assert.NotNil(t, p.OnActivate())
+	assert.EqualValues(t, string(kv.get(quoteKey(1))), `{"id": 1, "te`)
+	assert.Nil(t, kv.get(damageKey))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// How alike two quotes have to be, from 0 to 1, before we think they're
+	// the same quote with different punctuation or attribution.
+	nearDuplicateThreshold float64 = 0.85
+
+	// Short quotes are too alike to compare; "Yes." and "No." are only a
+	// couple of letters apart. They have to match exactly to be duplicates.
+	nearDuplicateMinLength int = 20
+)
+
+var (
+	// Fancy quotes and dashes, and what we compare them as.
+	quoteTextReplacer = strings.NewReplacer(
+		"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "«", `"`, "»", `"`,
+		"‘", "'", "’", "'", "‚", "'", "‛", "'",
+		"–", "-", "—", "-", "―", "-", "‒", "-",
+	)
+
+	// An attribution at the end of a quote: "... -- @shane", "... ~ Bob", or
+	// "...! - Bob". A single dash only counts after the end of a sentence, so
+	// "Well - maybe" keeps its "maybe".
+	attributionPattern = regexp.MustCompile(`(?:\s+(?:--+|~)|([.!?"'])\s*-)\s*@?[\p{L}\p{N}_.' ]{1,40}$`)
+)
+
+// -----------------------------------------------------------------------------
+// Duplicate detection
+// -----------------------------------------------------------------------------
+
+// NormalizeQuoteText - Boil a quote's text down to what matters when looking
+// for duplicates: fancy quotes and dashes become plain ones, the attribution
+// and surrounding quotation marks go, and case and whitespace are ignored.
+func NormalizeQuoteText(text string) string {
+	text = quoteTextReplacer.Replace(text)
+	text = strings.Join(strings.Fields(text), " ")
+	text = attributionPattern.ReplaceAllString(text, "${1}") // Keep the end of the sentence.
+	text = strings.Trim(text, `"' `)
+
+	return strings.ToLower(text)
+}
+
+// similarityKey - A quote's normalized text without any punctuation, for
+// comparing near-duplicates.
+func similarityKey(text string) []rune {
+	key := make([]rune, 0, len(text))
+	space := false
+	for _, r := range NormalizeQuoteText(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && len(key) > 0 {
+				key = append(key, ' ')
+			}
+			key = append(key, r)
+			space = false
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+
+	return key
+}
+
+// editDistance - The Levenshtein distance between a and b.
+func editDistance(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for idx := range previous {
+		previous[idx] = idx
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// QuoteSimilarity - How alike two quotes are, from 0 (nothing alike) to 1
+// (the same, give or take case, punctuation and attribution).
+func QuoteSimilarity(a string, b string) float64 {
+	keyA := similarityKey(a)
+	keyB := similarityKey(b)
+
+	return similarity(keyA, keyB)
+}
+
+// similarity - How alike two similarity keys are, from 0 to 1.
+func similarity(a []rune, b []rune) float64 {
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(editDistance(a, b))/float64(longest)
+}
+
+// findDuplicateQuote - Look for text in store's quotes, like FindDuplicate.
+//
+// Only the quotes sharing at least half of text's words can be duplicates, so
+// those are the only ones we compare.
+func findDuplicateQuote(store QuoteStore, text string) (*Quote, *Quote, *model.AppError) {
+	var quotes []Quote
+	var err *model.AppError
+	terms := SearchTerms(NormalizeQuoteText(text))
+	if len(terms) == 0 {
+		quotes, err = store.List()
+	} else {
+		quotes, err = store.Find(terms, (len(terms)+1)/2)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exact, near := FindDuplicate(quotes, text)
+
+	return exact, near, nil
+}
+
+// FindDuplicate - Look for text in quotes. Returns the quote it duplicates
+// exactly, or failing that, the most similar quote above
+// nearDuplicateThreshold. Both are nil if it's original.
+func FindDuplicate(quotes []Quote, text string) (exact *Quote, near *Quote) {
+	normalized := NormalizeQuoteText(text)
+	key := similarityKey(text)
+	best := nearDuplicateThreshold
+	for idx := range quotes {
+		if NormalizeQuoteText(quotes[idx].Text) == normalized {
+			return &quotes[idx], nil
+		}
+
+		otherKey := similarityKey(quotes[idx].Text)
+		if len(key) < nearDuplicateMinLength || len(otherKey) < nearDuplicateMinLength {
+			continue
+		}
+
+		alike := similarity(key, otherKey)
+		if alike >= best {
+			best = alike
+			near = &quotes[idx]
+		}
+	}
+
+	return nil, near
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalizeQuoteText - Test the NormalizeQuoteText function.
+func TestNormalizeQuoteText(t *testing.T) {
+	assert.EqualValues(t, NormalizeQuoteText(""), "")
+	assert.EqualValues(t, NormalizeQuoteText("I feel pretty."), "i feel pretty.")
+	assert.EqualValues(t, NormalizeQuoteText("  I   feel\tpretty.  "), "i feel pretty.")
+	assert.EqualValues(t, NormalizeQuoteText("“I feel pretty.” — @shane"), "i feel pretty.")
+	assert.EqualValues(t, NormalizeQuoteText(`"I feel pretty." -- shane`), "i feel pretty.")
+	assert.EqualValues(t, NormalizeQuoteText("I feel pretty. - Shane"), "i feel pretty.")
+	assert.EqualValues(t, NormalizeQuoteText("I feel pretty ~Shane"), "i feel pretty")
+	assert.EqualValues(t, NormalizeQuoteText("It’s fine"), "it's fine")
+
+	// A dash in the middle of a sentence isn't an attribution.
+	assert.EqualValues(t, NormalizeQuoteText("Well - maybe"), "well - maybe")
+}
+
+// TestQuoteSimilarity - Test the QuoteSimilarity function.
+func TestQuoteSimilarity(t *testing.T) {
+	assert.EqualValues(t, QuoteSimilarity("", ""), 1)
+	assert.EqualValues(t, QuoteSimilarity("I feel pretty.", "i feel pretty!!! -- @shane"), 1)
+	assert.EqualValues(t, QuoteSimilarity("abc", "xyz"), 0)
+	assert.InDelta(t, QuoteSimilarity("kitten", "sitting"), 1-3.0/7.0, 0.0001)
+}
+
+// TestFindDuplicate - Test the FindDuplicate function.
+func TestFindDuplicate(t *testing.T) {
+	quotes := []Quote{
+		{ID: 1, Text: "It's like Speed but more stupid. -- @chris"},
+		{ID: 2, Text: "I feel pretty. -- @shane"},
+		{ID: 4, Text: "Yes."},
+	}
+
+	exact, near := FindDuplicate(nil, "I feel pretty.")
+	assert.Nil(t, exact)
+	assert.Nil(t, near)
+
+	exact, near = FindDuplicate(quotes, "“i feel  PRETTY.” — Shane")
+	assert.EqualValues(t, exact.ID, 2)
+	assert.Nil(t, near)
+
+	exact, near = FindDuplicate(quotes, "Its like Speed, but more stupid!")
+	assert.Nil(t, exact)
+	assert.EqualValues(t, near.ID, 1)
+
+	exact, near = FindDuplicate(quotes, "It's like Speed, but way more stupid.")
+	assert.Nil(t, exact)
+	assert.EqualValues(t, near.ID, 1)
+
+	exact, near = FindDuplicate(quotes, "It's nothing like Speed.")
+	assert.Nil(t, exact)
+	assert.Nil(t, near)
+
+	// Short quotes only count if they're exactly the same.
+	exact, near = FindDuplicate(quotes, "No.")
+	assert.Nil(t, exact)
+	assert.Nil(t, near)
+	exact, near = FindDuplicate(quotes, " YES. ")
+	assert.EqualValues(t, exact.ID, 4)
+	assert.Nil(t, near)
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"regexp"
-	"strings"
+	"fmt"
 
 	"github.com/mattermost/mattermost-server/model"
 	"github.com/mattermost/mattermost-server/plugin"
@@ -35,9 +34,35 @@ func (p *QuotebotPlugin) OnActivate() error {
 
 	p.setConfiguration(configuration)
 
-	p.commandPattern = regexp.MustCompile(commandRegex)
+	// Prime the quote cannon! Damaged quotes are repaired as well as they can
+	// be, but if we can't even check them, don't start at all.
+	damage, checkErr := p.CheckQuotes()
+	if checkErr != nil {
+		p.API.LogError("Unable to check the quotes.", "error", checkErr.Error())
+		return checkErr
+	}
+	p.ReportDamage(damage)
+
+	migrateErr := p.Migrate(migrations)
+	if migrateErr != nil {
+		p.API.LogError("Unable to migrate the quotes.", "error", migrateErr.Error())
+		return migrateErr
+	}
+
+	if configuration.MigrateToTeam != "" && configuration.SharedQuotes == false && p.isReadOnly() == false {
+		migrateErr = p.MigrateSharedQuotes(configuration.MigrateToTeam)
+		if migrateErr != nil {
+			p.API.LogError("Unable to move the shared quotes to a team.", "error", migrateErr.Error())
+		}
+	}
+	if configuration.MigrateToTeam == "" && configuration.SharedQuotes == false {
+		p.warnAboutSharedQuotes()
+	}
 
-	err = p.LoadQuotes() // Prime the quote cannon!
+	p.stopPurging()
+	p.stopPurge = make(chan bool)
+	p.purgeDone = make(chan bool)
+	go p.purgeTrashPeriodically(p.stopPurge, p.purgeDone)
 
 	err = p.API.RegisterCommand(&model.Command{
 		Trigger:          trigger,
@@ -45,7 +70,7 @@ func (p *QuotebotPlugin) OnActivate() error {
 		DisplayName:      pluginName,
 		AutoComplete:     true,
 		AutoCompleteDesc: "📜 Keep track of quotes and post them! Use `/" + trigger + " help` for usage.",
-		AutoCompleteHint: "[add quotation | #]",
+		AutoCompleteHint: autocompleteHint(),
 		IconURL:          iconURI,
 	})
 
@@ -55,6 +80,7 @@ func (p *QuotebotPlugin) OnActivate() error {
 // OnDeactivate - Plugin has been deactivated.
 func (p *QuotebotPlugin) OnDeactivate() error {
 	p.active = false
+	p.stopPurging()
 
 	return nil
 }
@@ -65,64 +91,38 @@ func (p *QuotebotPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandAr
 		return nil, nil
 	}
 
-	if p.commandPattern.MatchString(args.Command) == false {
+	command, tail := parseCommand(args.Command)
+	if command == nil {
 		// It's not for us.
 		return nil, nil
 	}
 
-	// Dig out the command and tail.
-	matches := FindNamedSubstrings(p.commandPattern, args.Command)
-	command := matches["command"]
-	tail := matches["tail"]
+	// A rollback changes everything, and checking the damage changes whether
+	// anything else can change anything, so nothing else runs while they do.
+	if command.exclusive {
+		p.stateLock.Lock()
+		defer p.stateLock.Unlock()
+	} else {
+		p.stateLock.RLock()
+		defer p.stateLock.RUnlock()
+	}
 
-	var response *model.CommandResponse
-	var responseError *model.AppError
+	if command.permission == permissionAdmin && p.IsAdmin(args.UserId) == false {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			fmt.Sprintf("Only admins can use %s.", command.invocation(usage{}))), nil
+	}
 
-	if command == "" {
-		if tail == "" {
-			// "/quote" - Show a random quote.
-			response, responseError = p.ShowRandom(args.UserId)
-		} else {
-			response, responseError = p.ShowQuote(args.UserId, tail)
-		}
-	} else {
-		switch strings.ToLower(strings.TrimSpace(command)) {
-		case "debug": // TODO: DELETE ME WHEN DONE.
-			p.PostRandom()
-			response = p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "PostRandom() is done.")
-			responseError = nil
-
-		case "add":
-			// Anyone can add quotes.
-			response, responseError = p.AddQuote(tail)
-
-		case "channel": // Admins only.
-			// Tell the bot which channel to monitor.
-			response, responseError = p.SetChannel(args.UserId, tail, args.TeamId)
-
-		case "delete": // Admins only.
-			// Delete a quote specified by tail as a number.
-			response, responseError = p.DeleteQuote(args.UserId, tail)
-
-		case "help":
-			// Anyone can ask for help.
-			response, responseError = p.ShowHelp(args.UserId)
-
-		case "info":
-			// Anyone can ask for the info.
-			response, responseError = p.ShowInfo(args.UserId)
-
-		case "interval": // Admins only.
-			// Change the posting interval, in minutes.
-			response, responseError = p.SetInterval(args.UserId, tail)
-
-		case "list":
-			// List all known quotes. Admins only.
-			response, responseError = p.ListQuotes(args.UserId)
-		}
+	// Nothing changes the quotes while there's damage nobody has checked.
+	if p.readOnly && command.changesQuotes {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			"Quotebot found damaged quotes, so it won't change any until an admin checks them with /quote damage."), nil
+	}
+
+	if command.missingArguments(tail) {
+		return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, command.usageText()), nil
 	}
 
-	return response, responseError
+	return command.run(p, args, tail)
 }
 
 // MessageHasBeenPosted - can use this to periodically post a quote if people are talking...
@@ -132,7 +132,7 @@ func (p *QuotebotPlugin) MessageHasBeenPosted(c *plugin.Context, post *model.Pos
 	}
 
 	// TODO: How to ignore posts from bots?
-	if post.ChannelId != p.channelID { // Ignore posts in other channels.
+	if channelID, _ := p.postTarget(); post.ChannelId != channelID { // Ignore posts in other channels.
 		return
 	}
 
@@ -146,7 +146,7 @@ func (p *QuotebotPlugin) UserHasJoinedChannel(c *plugin.Context, channelMember *
 		return
 	}
 
-	if channelMember.ChannelId != p.channelID { // Ignore posts in other channels.
+	if channelID, _ := p.postTarget(); channelMember.ChannelId != channelID { // Ignore posts in other channels.
 		return
 	}
 
@@ -160,7 +160,7 @@ func (p *QuotebotPlugin) UserHasLeftChannel(c *plugin.Context, channelMember *mo
 		return
 	}
 
-	if channelMember.ChannelId != p.channelID { // Ignore posts in other channels.
+	if channelID, _ := p.postTarget(); channelMember.ChannelId != channelID { // Ignore posts in other channels.
 		return
 	}
 
@@ -48,56 +48,151 @@ func TestExecuteCommand(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
 
+	resp, err = runTestPluginCommand(t, "/quote --here", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any quotes yet.")
+
 	resp, err = runTestPluginCommand(t, "/quote add", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Empty quote. Try adding a quote with some text.")
+	assert.EqualValues(t, resp.Text, "Usage: /quote add *genius quote* - Store *genius quote* for later. Don't forget to include an attribution! If it looks a lot like a quote Quotebot already knows, use /quote add --force *genius quote* to add it anyway. Start it with hashtags to tag it, like /quote add #work #gus *genius quote*.")
 
 	resp, err = runTestPluginCommand(t, "/quote add some genius quote", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.Text, "Added \"some genius quote\" as quote number 1.")
 
+	resp, err = runTestPluginCommand(t, "/quote edit 1 some genius quote", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't edit quote 1, it doesn't exist.")
+
+	resp, err = runTestPluginCommand(t, "/quote history 2", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quote 2 doesn't exist, so it doesn't have a history.")
+
+	resp, err = runTestPluginCommand(t, "/quote revert 1", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What version? Use /quote history 1 to see them.")
+
+	resp, err = runTestPluginCommand(t, "/quote #work", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "No quotes match #work.")
+
+	resp, err = runTestPluginCommand(t, "/quote tag 1 +work", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't tag quote 1, it doesn't exist.")
+
+	resp, err = runTestPluginCommand(t, "/quote search primes", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "No quotes match \"primes\".")
+
+	resp, err = runTestPluginCommand(t, "/quote tags", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any tags yet.")
+
 	resp, err = runTestPluginCommand(t, "/quote help", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, helpText)
+	assert.EqualValues(t, resp.Text, helpText())
 
 	// Admin commands.
 	resp, err = runTestPluginCommand(t, "/quote channel", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can set the channel.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote channel.")
 
 	resp, err = runTestPluginCommand(t, "/quote channel ~town-square", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can set the channel.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote channel.")
 
 	resp, err = runTestPluginCommand(t, "/quote delete", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can delete quotes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote delete.")
 
 	resp, err = runTestPluginCommand(t, "/quote delete 1", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can delete quotes.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote delete.")
 
 	resp, err = runTestPluginCommand(t, "/quote interval", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can set the interval.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote interval.")
 
 	resp, err = runTestPluginCommand(t, "/quote interval 1", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can set the interval.")
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote interval.")
 
 	resp, err = runTestPluginCommand(t, "/quote list", "user", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "Only admins can list the quotes.")
+	assert.EqualValues(t, resp.Text, "There are 0 quotes on file.")
+
+	resp, err = runTestPluginCommand(t, "/quote author 1 Gus", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote author.")
+
+	resp, err = runTestPluginCommand(t, "/quote authors", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote authors.")
+
+	resp, err = runTestPluginCommand(t, "/quote export", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote export.")
+
+	resp, err = runTestPluginCommand(t, "/quote import", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote import.")
+
+	resp, err = runTestPluginCommand(t, "/quote reindex", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote reindex.")
+
+	resp, err = runTestPluginCommand(t, "/quote restore 1", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote restore.")
+
+	resp, err = runTestPluginCommand(t, "/quote rollback before", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote rollback.")
+
+	resp, err = runTestPluginCommand(t, "/quote snapshot", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote snapshot.")
+
+	resp, err = runTestPluginCommand(t, "/quote snapshots", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote snapshots.")
+
+	resp, err = runTestPluginCommand(t, "/quote damage", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote damage.")
+
+	resp, err = runTestPluginCommand(t, "/quote trash", "user", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Only admins can use /quote trash.")
 }
 
 // TestExecuteCommandAdmin - Test the ExecuteCommand() triggers that require admin access.
@@ -105,7 +200,7 @@ func TestExecuteCommandAdmin(t *testing.T) {
 	resp, err := runTestPluginCommand(t, "/quote channel", "system", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "You must specify a channel name.")
+	assert.EqualValues(t, resp.Text, "Usage: /quote channel *x* - Monitor channel *x* for activity and randomly show quotes there. Use /quote channel --here *x* to show *x*'s own quotes instead of the team's.")
 
 	resp, err = runTestPluginCommand(t, "/quote channel ~town-square", "system", "mock")
 	assert.NotNil(t, resp)
@@ -115,7 +210,7 @@ func TestExecuteCommandAdmin(t *testing.T) {
 	resp, err = runTestPluginCommand(t, "/quote delete", "system", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "What quote? You have to specify a quote index.")
+	assert.EqualValues(t, resp.Text, "Usage: /quote delete *x* - Move quote number *x* to the trash.")
 
 	// TODO: Test this with a list of actual quotes.
 	resp, err = runTestPluginCommand(t, "/quote delete -1", "system", "mock")
@@ -128,10 +223,40 @@ func TestExecuteCommandAdmin(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.Text, "You can't delete quote 1, it doesn't exist.")
 
+	resp, err = runTestPluginCommand(t, "/quote export xml", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Quotes can be exported as json, csv or md.")
+
+	resp, err = runTestPluginCommand(t, "/quote import", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "What file? Attach it to a post, then reply to the post with /quote import, or use /quote import *link to the post*.")
+
+	resp, err = runTestPluginCommand(t, "/quote reindex", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Rebuilt the search index for 0 quotes.")
+
+	resp, err = runTestPluginCommand(t, "/quote rollback", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "Usage: /quote rollback *name* - Put all the quotes and settings back the way they were in snapshot *name*.")
+
+	resp, err = runTestPluginCommand(t, "/quote snapshots", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any snapshots yet.")
+
+	resp, err = runTestPluginCommand(t, "/quote damage", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There aren't any damaged quotes to check.")
+
 	resp, err = runTestPluginCommand(t, "/quote interval", "system", "mock")
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
-	assert.EqualValues(t, resp.Text, "You have to specify an interval in minutes, >= 15.")
+	assert.EqualValues(t, resp.Text, "Usage: /quote interval *x* - The time between automatically posting quotes in a channel.")
 
 	resp, err = runTestPluginCommand(t, "/quote interval 1", "system", "mock")
 	assert.NotNil(t, resp)
@@ -147,6 +272,16 @@ func TestExecuteCommandAdmin(t *testing.T) {
 	assert.NotNil(t, resp)
 	assert.Nil(t, err)
 	assert.EqualValues(t, resp.Text, "There are 0 quotes on file.")
+
+	resp, err = runTestPluginCommand(t, "/quote restore 1", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "You can't restore quote 1, it isn't in the trash.")
+
+	resp, err = runTestPluginCommand(t, "/quote trash", "system", "mock")
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "There are 0 quotes in the trash. They're deleted for good after 30 days.")
 }
 
 // // TestMessageHasBeenPosted - Test the MessageHasBeenPosted callback.
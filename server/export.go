@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Export formats.
+	exportJSON     string = "json"
+	exportCSV      string = "csv"
+	exportMarkdown string = "md"
+)
+
+var (
+	// The CSV columns, one per Quote field that matters to humans.
+	exportCSVHeader = []string{
+		"id", "text", "author", "speakers", "tags", "user_id", "create_at", "channel_id", "team_id", "post_id",
+		"edit_at", "edited_by", "revisions", "delete_at", "deleted_by",
+	}
+)
+
+// QuoteExport - Everything in a collection, as exported. /quote import brings
+// it back exactly, IDs, trash and all, into an empty collection.
+type QuoteExport struct {
+	ExportedAt int64   `json:"exported_at"` // In milliseconds since the epoch.
+	LastID     int     `json:"last_id"`
+	Quotes     []Quote `json:"quotes"`
+	Trash      []Quote `json:"trash"`
+}
+
+// -----------------------------------------------------------------------------
+// Export formats
+// -----------------------------------------------------------------------------
+
+// NewQuoteExport - Export everything in store.
+func NewQuoteExport(store QuoteStore) (*QuoteExport, *model.AppError) {
+	lastID, err := store.LastID()
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	trash, err := store.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty lists rather than nulls, for whatever reads the file next.
+	if quotes == nil {
+		quotes = []Quote{}
+	}
+	if trash == nil {
+		trash = []Quote{}
+	}
+
+	return &QuoteExport{
+		ExportedAt: model.GetMillis(),
+		LastID:     lastID,
+		Quotes:     quotes,
+		Trash:      trash,
+	}, nil
+}
+
+// Format - The export as a file in the given format: exportJSON,
+// exportCSV or exportMarkdown.
+func (e *QuoteExport) Format(format string) ([]byte, error) {
+	switch format {
+	case exportJSON:
+		return json.MarshalIndent(e, "", "    ")
+	case exportCSV:
+		return e.formatCSV()
+	case exportMarkdown:
+		return e.formatMarkdown(), nil
+	}
+
+	return nil, fmt.Errorf("%q isn't an export format", format)
+}
+
+// formatCSV - The export as CSV, one quote per row, with the quotes in the
+// trash at the end.
+func (e *QuoteExport) formatCSV() ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	writer.Write(exportCSVHeader)
+	for _, quote := range append(append([]Quote(nil), e.Quotes...), e.Trash...) {
+		writer.Write([]string{
+			strconv.Itoa(quote.ID),
+			quote.Text,
+			quote.Author,
+			FormatSpeakers(quote.Speakers),
+			FormatTags(quote.Tags),
+			quote.UserID,
+			exportTime(quote.CreateAt),
+			quote.ChannelID,
+			quote.TeamID,
+			quote.PostID,
+			exportTime(quote.EditAt),
+			quote.EditedBy,
+			strconv.Itoa(len(quote.Revisions)),
+			exportTime(quote.DeleteAt),
+			quote.DeletedBy,
+		})
+	}
+	writer.Flush()
+
+	return out.Bytes(), writer.Error()
+}
+
+// formatMarkdown - The export as Markdown, for reading.
+func (e *QuoteExport) formatMarkdown() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# Quotes\n\n%d quotes, exported %s.\n", len(e.Quotes), FormatTime(e.ExportedAt))
+	for idx := range e.Quotes {
+		writeMarkdownQuote(&out, &e.Quotes[idx])
+	}
+
+	if len(e.Trash) > 0 {
+		fmt.Fprintf(&out, "\n## Trash\n\n%d quotes.\n", len(e.Trash))
+		for idx := range e.Trash {
+			writeMarkdownQuote(&out, &e.Trash[idx])
+		}
+	}
+
+	return out.Bytes()
+}
+
+// writeMarkdownQuote - Write one quote as Markdown.
+func writeMarkdownQuote(out *bytes.Buffer, quote *Quote) {
+	fmt.Fprintf(out, "\n### Quote %d\n\n", quote.ID)
+	for _, line := range strings.Split(quote.Text, "\n") {
+		fmt.Fprintf(out, "> %s\n", line)
+	}
+
+	var details []string
+	if len(quote.Speakers) > 0 {
+		details = append(details, fmt.Sprintf("From %s.", FormatSpeakers(quote.Speakers)))
+	}
+	if len(quote.Tags) > 0 {
+		details = append(details, fmt.Sprintf("Tagged %s.", FormatTags(quote.Tags)))
+	}
+	if quote.CreateAt != 0 {
+		details = append(details, fmt.Sprintf("Added %s.", FormatTime(quote.CreateAt)))
+	}
+	if quote.EditAt != 0 {
+		details = append(details, fmt.Sprintf("Edited %s.", FormatTime(quote.EditAt)))
+	}
+	if quote.DeleteAt != 0 {
+		details = append(details, fmt.Sprintf("Deleted %s.", FormatTime(quote.DeleteAt)))
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(out, "\n%s\n", strings.Join(details, " "))
+	}
+}
+
+// exportTime - A time in milliseconds since the epoch for a CSV file, or ""
+// if it isn't set.
+func exportTime(millis int64) string {
+	if millis == 0 {
+		return ""
+	}
+
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// messageUserID - Who sends direct messages: the user we post quotes as, if
+// there is one, otherwise the user they're for, to themselves.
+func (p *QuotebotPlugin) messageUserID(userID string) string {
+	if p.userID != "" {
+		return p.userID
+	}
+
+	user, err := p.API.GetUserByUsername(p.getConfiguration().postUser)
+	if err != nil || user == nil {
+		return userID
+	}
+
+	return user.Id
+}
+
+// SendFile - Send a file to a user in a direct message, with message.
+func (p *QuotebotPlugin) SendFile(userID string, name string, data []byte, message string) *model.AppError {
+	fromID := p.messageUserID(userID)
+	channel, err := p.API.GetDirectChannel(fromID, userID)
+	if err != nil {
+		return err
+	}
+
+	info, err := p.API.UploadFile(data, channel.Id, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.API.CreatePost(&model.Post{
+		UserId:    fromID,
+		ChannelId: channel.Id,
+		Message:   message,
+		FileIds:   []string{info.Id},
+	})
+
+	return err
+}
+
+// SendMessage - Send a user a direct message.
+func (p *QuotebotPlugin) SendMessage(userID string, message string) *model.AppError {
+	fromID := p.messageUserID(userID)
+	channel, err := p.API.GetDirectChannel(fromID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.API.CreatePost(&model.Post{
+		UserId:    fromID,
+		ChannelId: channel.Id,
+		Message:   message,
+	})
+
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testExport - An export with a bit of everything in it.
+func testExport() *QuoteExport {
+	return &QuoteExport{
+		ExportedAt: 1571400000000,
+		LastID:     3,
+		Quotes: []Quote{
+			{
+				ID: 1, Text: "There's lots of primes!\nSo many. - Gus", Author: "Gus", UserID: "userid", CreateAt: 1571300000000,
+				ChannelID: "channelid", TeamID: "teamid", Tags: []string{"math", "work"}, Speakers: []Speaker{{Name: "Gus"}},
+				EditAt: 1571350000000, EditedBy: "editor", Revisions: []Revision{{Text: "Primes!", UserID: "userid", CreateAt: 1571300000000}},
+			},
+			{ID: 3, Text: "quote 3"},
+		},
+		Trash: []Quote{
+			{ID: 2, Text: "quote, \"2\"", Speakers: []Speaker{{Name: "shane", UserID: "shaneid"}}, DeleteAt: 1571360000000, DeletedBy: "userid"},
+		},
+	}
+}
+
+// TestQuoteExportFormat - Test the QuoteExport.Format function.
+func TestQuoteExportFormat(t *testing.T) {
+	export := testExport()
+
+	// JSON comes back exactly.
+	raw, err := export.Format(exportJSON)
+	assert.Nil(t, err)
+	file, err := ParseImport(raw)
+	assert.Nil(t, err)
+	assert.EqualValues(t, file.LastID, export.LastID)
+	assert.EqualValues(t, file.Quotes, export.Quotes)
+	assert.EqualValues(t, file.Trash, export.Trash)
+
+	raw, err = export.Format(exportCSV)
+	assert.Nil(t, err)
+	assert.EqualValues(t, string(raw), "id,text,author,speakers,tags,user_id,create_at,channel_id,team_id,post_id,edit_at,edited_by,revisions,delete_at,deleted_by\n"+
+		"1,\"There's lots of primes!\nSo many. - Gus\",Gus,Gus,#math #work,userid,2019-10-17T08:13:20Z,channelid,teamid,,2019-10-17T22:06:40Z,editor,1,,\n"+
+		"3,quote 3,,,,,,,,,,,0,,\n"+
+		"2,\"quote, \"\"2\"\"\",,@shane,,,,,,,,,0,2019-10-18T00:53:20Z,userid\n")
+
+	raw, err = export.Format(exportMarkdown)
+	assert.Nil(t, err)
+	assert.EqualValues(t, string(raw), "# Quotes\n\n2 quotes, exported 2019-10-18 12:00 UTC.\n"+
+		"\n### Quote 1\n\n> There's lots of primes!\n> So many. - Gus\n\nFrom Gus. Tagged #math #work. Added 2019-10-17 08:13 UTC. Edited 2019-10-17 22:06 UTC.\n"+
+		"\n### Quote 3\n\n> quote 3\n"+
+		"\n## Trash\n\n1 quotes.\n"+
+		"\n### Quote 2\n\n> quote, \"2\"\n\nFrom @shane. Deleted 2019-10-18 00:53 UTC.\n")
+
+	_, err = export.Format("pdf")
+	assert.NotNil(t, err)
+}
+
+// TestNewQuoteExport - Test the NewQuoteExport function.
+func TestNewQuoteExport(t *testing.T) {
+	store := NewMemoryQuoteStore()
+	export, err := NewQuoteExport(store)
+	assert.Nil(t, err)
+	assert.EqualValues(t, export.LastID, 0)
+	assert.EqualValues(t, export.Quotes, []Quote{})
+	assert.EqualValues(t, export.Trash, []Quote{})
+
+	original := testExport()
+	err = store.Replace(original.LastID, original.Quotes, original.Trash)
+	assert.Nil(t, err)
+
+	export, err = NewQuoteExport(store)
+	assert.Nil(t, err)
+	assert.EqualValues(t, export.LastID, 3)
+	assert.EqualValues(t, export.Quotes, original.Quotes)
+	assert.EqualValues(t, export.Trash, original.Trash)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	maxImportFileSize int64 = 1024 * 1024 // Bigger files are probably a mistake.
+)
+
+var (
+	// A post's ID, or a permalink to it like https://chat/team/pl/<id>.
+	postLinkPattern = regexp.MustCompile(`^(?:\S*/)?([a-z0-9]{26})/?$`)
+
+	// The comma after the last item in a list, like the one at the end of
+	// quotes.json, which JSON doesn't allow.
+	trailingCommaPattern = regexp.MustCompile(`,\s*\]\s*$`)
+)
+
+// ImportFile - The quotes and responses in a file being imported.
+type ImportFile struct {
+	Quotes    []Quote    `json:"quotes"`
+	Responses []Response `json:"responses"`
+
+	// Only set for exports, and the quote files we save.
+	LastID int     `json:"last_id"`
+	Trash  []Quote `json:"trash"`
+}
+
+// ImportResult - What happened to a file's quotes and responses when they were
+// imported.
+type ImportResult struct {
+	AddedQuotes      int
+	SkippedQuotes    int // Duplicates and empty quotes.
+	AddedResponses   int
+	SkippedResponses int
+	Restored         bool // The file was an export, brought back exactly.
+}
+
+// -----------------------------------------------------------------------------
+// Import parsing
+// -----------------------------------------------------------------------------
+
+// stripImportComments - Take the "//" comment lines (and blank lines) off the
+// start of a file, like the one at the top of quotes.json.
+func stripImportComments(raw []byte) []byte {
+	for {
+		raw = bytes.TrimLeft(raw, " \t\r\n\ufeff")
+		if bytes.HasPrefix(raw, []byte("//")) == false {
+			return raw
+		}
+
+		end := bytes.IndexByte(raw, '\n')
+		if end < 0 {
+			return nil
+		}
+		raw = raw[end+1:]
+	}
+}
+
+// ParseImport - Read the quotes and responses in a file. It can be a JSON
+// list of quotes as strings (like quotes.json), of responses (like
+// responses.json), or of quotes as objects; an object with "quotes" and
+// "responses" lists, like an export or the quotes files we save; or plain
+// text, one quote per line.
+//
+// The JSON can start with "//" comment lines, and have a comma after the last
+// item in a list. Hashtags at the start of a quote that's just text are its
+// tags, like with /quote add.
+func ParseImport(raw []byte) (*ImportFile, error) {
+	raw = stripImportComments(raw)
+
+	var file ImportFile
+	switch {
+	case bytes.HasPrefix(raw, []byte("{")):
+		err := json.Unmarshal(raw, &file)
+		if err != nil {
+			return nil, err
+		}
+
+	case bytes.HasPrefix(raw, []byte("[")):
+		var items []json.RawMessage
+		err := json.Unmarshal(trailingCommaPattern.ReplaceAll(raw, []byte("]")), &items)
+		if err != nil {
+			return nil, err
+		}
+
+		for idx := range items {
+			err = file.parseItem(items[idx])
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", idx+1, err)
+			}
+		}
+
+	default:
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				file.Quotes = append(file.Quotes, importedText(line))
+			}
+		}
+	}
+
+	return &file, nil
+}
+
+// parseItem - Add one item from a JSON list to the file: a quote's text, a
+// quote, or a response.
+func (f *ImportFile) parseItem(item json.RawMessage) error {
+	var text string
+	if json.Unmarshal(item, &text) == nil {
+		f.Quotes = append(f.Quotes, importedText(text))
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(item, &fields)
+	if err != nil {
+		return fmt.Errorf("it isn't a quote or a response")
+	}
+
+	if _, ok := fields["trigger"]; ok {
+		var response Response
+		err = json.Unmarshal(item, &response)
+		if err != nil {
+			return err
+		}
+
+		f.Responses = append(f.Responses, response)
+		return nil
+	}
+
+	var quote Quote
+	err = json.Unmarshal(item, &quote)
+	if err != nil {
+		return err
+	}
+
+	f.Quotes = append(f.Quotes, quote)
+	return nil
+}
+
+// importedText - A quote for text that's being imported, tagged with any
+// hashtags at its start.
+func importedText(text string) Quote {
+	tags, text := ParseTags(text)
+
+	return Quote{Text: strings.TrimSpace(text), Tags: tags}
+}
+
+// importPostID - The post ID in a command's tail, which can be the ID or a
+// link to the post. Returns "" if there isn't one.
+func importPostID(tail string) string {
+	match := postLinkPattern.FindStringSubmatch(strings.TrimSpace(tail))
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// importFile - Add the quotes in file to store, skipping the ones it already
+// has, and the responses to the responses.
+//
+// Imported quotes keep what the file knows about them, and get the rest from
+// args as if they'd been added with /quote add. They're never in the trash.
+//
+// An export imported into an empty collection is brought back exactly
+// instead, numbers, trash and all.
+func (p *QuotebotPlugin) importFile(args *model.CommandArgs, store QuoteStore, file *ImportFile) (ImportResult, *model.AppError) {
+	var result ImportResult
+	if file.LastID > 0 {
+		lastID, err := store.LastID()
+		if err != nil {
+			return result, err
+		}
+
+		if lastID == 0 {
+			// Replacing wipes the collection, so snapshot it first.
+			_, err = p.automaticSnapshot(args.UserId, "restoring quotes from an export")
+			if err != nil {
+				return result, err
+			}
+
+			err = store.Replace(file.LastID, file.Quotes, file.Trash)
+			if err != nil {
+				return result, err
+			}
+
+			result.AddedQuotes = len(file.Quotes) + len(file.Trash)
+			result.Restored = true
+			file = &ImportFile{Responses: file.Responses}
+		}
+	}
+
+	for idx := range file.Quotes {
+		quote := file.Quotes[idx]
+		quote.Text = strings.TrimSpace(quote.Text)
+		if quote.Text == "" {
+			result.SkippedQuotes++
+			continue
+		}
+
+		exact, _, err := findDuplicateQuote(store, quote.Text)
+		if err != nil {
+			return result, err
+		}
+		if exact != nil {
+			result.SkippedQuotes++
+			continue
+		}
+
+		p.fillImportedQuote(args, &quote)
+		_, err = store.Add(quote)
+		if err != nil {
+			return result, err
+		}
+		result.AddedQuotes++
+	}
+
+	added, err := p.AddResponses(file.Responses)
+	if err != nil {
+		return result, err
+	}
+	result.AddedResponses = added
+	result.SkippedResponses = len(file.Responses) - added
+
+	return result, nil
+}
+
+// fillImportedQuote - Fill in what an imported quote doesn't say about itself.
+func (p *QuotebotPlugin) fillImportedQuote(args *model.CommandArgs, quote *Quote) {
+	added := NewQuote(0, quote.Text, args)
+	if quote.UserID == "" {
+		quote.UserID = added.UserID
+	}
+	if quote.CreateAt == 0 {
+		quote.CreateAt = added.CreateAt
+	}
+	if quote.ChannelID == "" {
+		quote.ChannelID = added.ChannelID
+	}
+	if quote.TeamID == "" {
+		quote.TeamID = added.TeamID
+	}
+	quote.ID = 0
+	quote.DeleteAt = 0
+	quote.DeletedBy = ""
+
+	var tags []string
+	for _, tag := range quote.Tags {
+		tag = NormalizeTag(tag)
+		if tag != "" {
+			tags = addTag(tags, tag)
+		}
+	}
+	quote.Tags = tags
+
+	if quote.IsAttributed() == false {
+		speakers, review := p.guessSpeakers(quote)
+		quote.SetSpeakers(speakers, review, "")
+	}
+}
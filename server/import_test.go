@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseImport - Test the ParseImport function.
+func TestParseImport(t *testing.T) {
+	// The files from the old Slack server.
+	raw, err := ioutil.ReadFile("../quotes.json")
+	assert.Nil(t, err)
+	file, err := ParseImport(raw)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(file.Quotes), 56)
+	assert.EqualValues(t, len(file.Responses), 0)
+	assert.EqualValues(t, file.Quotes[0].Text, "'I am the Beastmaster.'- Atsushi")
+
+	raw, err = ioutil.ReadFile("../responses.json")
+	assert.Nil(t, err)
+	file, err = ParseImport(raw)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(file.Quotes), 0)
+	assert.EqualValues(t, len(file.Responses), 25)
+	assert.EqualValues(t, file.Responses[0], Response{Trigger: "dunno", Response: `¯\_(ツ)_/¯`})
+
+	// Plain text.
+	file, err = ParseImport([]byte("\nquote 1\n  #work quote 2  \n\n[not JSON]\n"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, file.Quotes, []Quote{
+		{Text: "quote 1"},
+		{Text: "quote 2", Tags: []string{"work"}},
+		{Text: "[not JSON]"},
+	})
+
+	// Structured quotes.
+	file, err = ParseImport([]byte(`{"last_id": 2, "quotes": [{"id": 2, "text": "quote 2", "tags": ["work"]}], "trash": []}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, file.Quotes, []Quote{{ID: 2, Text: "quote 2", Tags: []string{"work"}}})
+
+	file, err = ParseImport([]byte(`// Mixed.
+[
+	"#work quote 1",
+	{"text": "quote 2", "author": "Gus"},
+	{"trigger": "dunno", "response": "Me neither."},
+]`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, file.Quotes, []Quote{{Text: "quote 1", Tags: []string{"work"}}, {Text: "quote 2", Author: "Gus"}})
+	assert.EqualValues(t, file.Responses, []Response{{Trigger: "dunno", Response: "Me neither."}})
+
+	// Broken.
+	_, err = ParseImport([]byte(`["quote 1"`))
+	assert.NotNil(t, err)
+
+	_, err = ParseImport([]byte(`["quote 1", 2]`))
+	assert.EqualValues(t, err.Error(), "item 2: it isn't a quote or a response")
+}
+
+// TestImportPostID - Test the importPostID function.
+func TestImportPostID(t *testing.T) {
+	assert.EqualValues(t, importPostID("abcdefghijklmnopqrstuvwxyz"), "abcdefghijklmnopqrstuvwxyz")
+	assert.EqualValues(t, importPostID(" https://chat.example.com/team/pl/abcdefghijklmnopqrstuvwxyz "), "abcdefghijklmnopqrstuvwxyz")
+	assert.EqualValues(t, importPostID(""), "")
+	assert.EqualValues(t, importPostID("quotes.json"), "")
+}
+
+// TestImportFile - Test the importFile function.
+func TestImportFile(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	file := &ImportFile{
+		Quotes: []Quote{
+			{Text: "Quote 1"},
+			{Text: " "},
+			{ID: 7, Text: "There's lots of primes! - Gus", Tags: []string{"Math", "#work", "no!"}, DeleteAt: 1},
+			{Text: "quote 2", Author: "@shane", UserID: "otheruserid", CreateAt: 1},
+			{Text: "quote 2"},
+		},
+		Responses: []Response{{Trigger: "dunno", Response: "Me neither."}},
+	}
+	result, err := p.importFile(testCommandArgs(""), p.Store("teamid"), file)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result, ImportResult{AddedQuotes: 2, SkippedQuotes: 3, AddedResponses: 1})
+
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 3)
+	assert.EqualValues(t, quotes[1].ID, 2)
+	assert.EqualValues(t, quotes[1].UserID, "userid")
+	assert.EqualValues(t, quotes[1].Tags, []string{"math", "work"})
+	assert.EqualValues(t, quotes[1].Speakers, []Speaker{{Name: "Gus"}})
+	assert.EqualValues(t, quotes[1].DeleteAt, 0)
+	assert.EqualValues(t, quotes[2].UserID, "otheruserid")
+	assert.EqualValues(t, quotes[2].CreateAt, 1)
+	assert.EqualValues(t, quotes[2].Speakers, []Speaker{{Name: "shane", UserID: "shaneid"}})
+
+	// Importing it again doesn't add anything.
+	result, err = p.importFile(testCommandArgs(""), p.Store("teamid"), file)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result, ImportResult{SkippedQuotes: 5, SkippedResponses: 1})
+	assert.EqualValues(t, len(testQuotes(t, p)), 3)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// How much of a post a page of /quote list can fill, leaving room for
+	// the header and footer.
+	listPageRunes int = model.POST_MESSAGE_MAX_RUNES_V2 - 1000
+
+	listPageWord   string = "page"
+	listSortNewest string = "newest"
+	listSortOldest string = "oldest"
+)
+
+// listOptions - Which quotes /quote list shows, and how.
+type listOptions struct {
+	page     int    // Counting from 1.
+	here     bool   // The channel's own quotes, instead of the team's.
+	author   string // Only quotes said by them, if set.
+	contains string // Only quotes containing this, if set.
+	query    *Query // Only quotes matching it, if set.
+	newest   bool   // Newest first, instead of oldest first.
+}
+
+// -----------------------------------------------------------------------------
+// Listing quotes
+// -----------------------------------------------------------------------------
+
+// parseListOptions - Work out the options from /quote list's arguments, like
+// "page 2 --author Gus --sort newest #work". Returns the words left over for
+// the query, and what's wrong with the options, if anything.
+func parseListOptions(tokens []Token) (listOptions, []Token, string) {
+	options := listOptions{page: 1}
+	var rest []Token
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+
+		// Flags can have their value after an =, or as the next word.
+		value := token.Value
+		if token.Flag != "" && token.Flag != "here" && token.HasValue == false {
+			if idx+1 >= len(tokens) || tokens[idx+1].Flag != "" {
+				return options, nil, fmt.Sprintf("--%s needs a value, like --%s=%s.", token.Flag, token.Flag, listFlagExample(token.Flag))
+			}
+			idx++
+			value = tokens[idx].Text
+		}
+
+		switch {
+		case token.Flag == "here":
+			options.here = true
+
+		case token.Flag == "author":
+			options.author = strings.TrimPrefix(strings.TrimSpace(value), "@")
+
+		case token.Flag == "contains":
+			options.contains = strings.TrimSpace(value)
+
+		case token.Flag == "sort":
+			switch strings.ToLower(value) {
+			case listSortNewest:
+				options.newest = true
+			case listSortOldest:
+				options.newest = false
+			default:
+				return options, nil, fmt.Sprintf("Quotes can be sorted %s or %s, not %q.", listSortNewest, listSortOldest, value)
+			}
+
+		case token.Flag != "":
+			return options, nil, fmt.Sprintf("/quote list doesn't have a --%s flag.", token.Flag)
+
+		case strings.EqualFold(token.Text, listPageWord) && token.Quoted == false:
+			if idx+1 >= len(tokens) {
+				return options, nil, "What page? Pages are numbered from 1."
+			}
+			idx++
+			page, err := strconv.Atoi(tokens[idx].Text)
+			if err != nil || page < 1 {
+				return options, nil, fmt.Sprintf("%q isn't a page number. Pages are numbered from 1.", tokens[idx].Text)
+			}
+			options.page = page
+
+		default:
+			rest = append(rest, token)
+		}
+	}
+
+	return options, rest, ""
+}
+
+// listFlagExample - An example value for one of /quote list's flags.
+func listFlagExample(flag string) string {
+	switch flag {
+	case "author":
+		return "Gus"
+	case "sort":
+		return listSortNewest
+	}
+
+	return "x"
+}
+
+// filtered - Are some of the quotes left out?
+func (o listOptions) filtered() bool {
+	return o.author != "" || o.contains != "" || o.query.Empty() == false
+}
+
+// matches - Should the quote be listed?
+func (o listOptions) matches(quote *Quote) bool {
+	if o.author != "" && saidBy(quote, o.author) == false {
+		return false
+	}
+	if o.contains != "" && containsText(quote.Text, o.contains) == false {
+		return false
+	}
+
+	return o.query.Matches(quote)
+}
+
+// command - The /quote list command for a page with the same options.
+func (o listOptions) command(page int) string {
+	words := []string{slashTrigger, "list"}
+	if o.here {
+		words = append(words, hereFlag)
+	}
+	words = append(words, listPageWord, strconv.Itoa(page))
+	if o.author != "" {
+		words = append(words, "--author", QuoteArgument(o.author))
+	}
+	if o.contains != "" {
+		words = append(words, "--contains", QuoteArgument(o.contains))
+	}
+	if o.newest {
+		words = append(words, "--sort", listSortNewest)
+	}
+	if o.query.Empty() == false {
+		words = append(words, o.query.String())
+	}
+
+	return strings.Join(words, " ")
+}
+
+// saidBy - Did the named person say the quote? Names are compared ignoring
+// case and any "@".
+func saidBy(quote *Quote, name string) bool {
+	name = strings.TrimPrefix(name, "@")
+	for idx := range quote.Speakers {
+		if strings.EqualFold(quote.Speakers[idx].Name, name) {
+			return true
+		}
+	}
+
+	return len(quote.Speakers) == 0 && strings.EqualFold(strings.TrimPrefix(quote.Author, "@"), name)
+}
+
+// saidByUser - Did the user say the quote? They might have changed their
+// username since.
+func saidByUser(quote *Quote, userID string) bool {
+	if userID == "" {
+		return false
+	}
+
+	for idx := range quote.Speakers {
+		if quote.Speakers[idx].UserID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortQuotes - Sort quotes by when they were added, oldest or newest first.
+// Quotes from before we kept track go by their IDs.
+func sortQuotes(quotes []Quote, newest bool) {
+	sort.SliceStable(quotes, func(i, j int) bool {
+		if quotes[i].CreateAt != quotes[j].CreateAt {
+			return (quotes[i].CreateAt < quotes[j].CreateAt) != newest
+		}
+
+		return (quotes[i].ID < quotes[j].ID) != newest
+	})
+}
+
+// pageLines - Split lines into pages of up to limit runes each, counting a
+// newline after every line. A line too long for a page of its own is cut
+// short.
+func pageLines(lines []string, limit int) [][]string {
+	var pages [][]string
+	var page []string
+	size := 0
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) >= limit {
+			line = string([]rune(line)[:limit-2]) + "…"
+		}
+
+		length := utf8.RuneCountInString(line) + 1
+		if size+length > limit && len(page) > 0 {
+			pages = append(pages, page)
+			page = nil
+			size = 0
+		}
+		page = append(page, line)
+		size += length
+	}
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+// formatListLine - A quote as /quote list shows it.
+func formatListLine(quote *Quote) string {
+	line := fmt.Sprintf("* %d = %q", quote.ID, quote.Text)
+	if len(quote.Tags) > 0 {
+		line += " " + FormatTags(quote.Tags)
+	}
+
+	return line
+}
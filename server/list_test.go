@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseListOptions - Test the parseListOptions function.
+func TestParseListOptions(t *testing.T) {
+	tokens, _ := Tokenize(`--here page 3 --author=@Gus #work --contains "so long" --sort NEWEST "page"`)
+	options, rest, problem := parseListOptions(tokens)
+	assert.EqualValues(t, problem, "")
+	assert.EqualValues(t, options, listOptions{page: 3, here: true, author: "Gus", contains: "so long", newest: true})
+	assert.EqualValues(t, rest, []Token{{Text: "#work", Column: 29}, {Text: "page", Quoted: true, Column: 70}})
+
+	options.query, _ = parseQueryTokens(rest)
+	assert.EqualValues(t, options.command(4), `/quote list --here page 4 --author Gus --contains "so long" --sort newest #work page`)
+
+	options, rest, problem = parseListOptions(nil)
+	assert.EqualValues(t, problem, "")
+	assert.Nil(t, rest)
+	assert.EqualValues(t, options, listOptions{page: 1})
+	assert.EqualValues(t, options.command(2), "/quote list page 2")
+
+	problems := map[string]string{
+		"page":              "What page? Pages are numbered from 1.",
+		"page 0":            "\"0\" isn't a page number. Pages are numbered from 1.",
+		"--author":          "--author needs a value, like --author=Gus.",
+		"--author --here":   "--author needs a value, like --author=Gus.",
+		"--sort=random":     "Quotes can be sorted newest or oldest, not \"random\".",
+		"--colour=blue":     "/quote list doesn't have a --colour flag.",
+		"page 2 --contains": "--contains needs a value, like --contains=x.",
+	}
+	for tail, expected := range problems {
+		tokens, err := Tokenize(tail)
+		assert.Nil(t, err, tail)
+		_, _, problem = parseListOptions(tokens)
+		assert.EqualValues(t, problem, expected, tail)
+	}
+}
+
+// TestPageLines - Test the pageLines function.
+func TestPageLines(t *testing.T) {
+	assert.Nil(t, pageLines(nil, 10))
+	assert.EqualValues(t, pageLines([]string{"aaa", "bbb", "ccc"}, 8), [][]string{{"aaa", "bbb"}, {"ccc"}})
+	assert.EqualValues(t, pageLines([]string{"aaa", "bbb", "ccc"}, 7), [][]string{{"aaa"}, {"bbb"}, {"ccc"}})
+	assert.EqualValues(t, pageLines([]string{"a", "too long for a page", "b"}, 8), [][]string{{"a"}, {"too lo…"}, {"b"}})
+}
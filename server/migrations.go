@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store key for the version of the stored data. Version N has
+	// had the first N migrations run on it; there's no key before the first.
+	schemaVersionKey string = "schema_version"
+)
+
+// migration - One change to how the data is stored.
+//
+// Migrations have to be safe to run again: if the plugin stops part way
+// through one, it's run again from the start next time.
+type migration struct {
+	description string // For the log.
+	run         func(p *QuotebotPlugin) *model.AppError
+}
+
+var (
+	// Every migration, in the order they're run. Only ever add to the end;
+	// the schema version is the number of migrations that have been run, so
+	// removing or reordering them would skip some or run others twice.
+	migrations = []migration{
+		{
+			description: "Move the quotes into their own keys.",
+			run: func(p *QuotebotPlugin) *model.AppError {
+				return NewKVQuoteStore(p.API, sharedCollection).Migrate()
+			},
+		},
+	}
+)
+
+// -----------------------------------------------------------------------------
+// Utility functions.
+// -----------------------------------------------------------------------------
+
+// parseSchemaVersion - Turn a raw schema version into a number. Data from
+// before we kept track is version 0.
+func parseSchemaVersion(raw []byte) (int, error) {
+	if raw == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(raw))
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// loadSchemaVersion - Load the version of the stored data, and its raw value
+// for compare-and-set.
+func (p *QuotebotPlugin) loadSchemaVersion() (int, []byte, *model.AppError) {
+	raw, err := p.API.KVGet(schemaVersionKey)
+	if err != nil {
+		return 0, nil, p.NewError("Unable to load the schema version.", "API.KVGet() failed.", "loadSchemaVersion")
+	}
+
+	version, convErr := parseSchemaVersion(raw)
+	if convErr != nil {
+		return 0, nil, p.NewError("Unable to load the schema version.", fmt.Sprintf("strconv.Atoi(%q) failed.", raw), "loadSchemaVersion")
+	}
+
+	return version, raw, nil
+}
+
+// checkSchemaVersion - Refuse data from a newer version of Quotebot than this
+// one, which knows about len(migrations) migrations.
+func (p *QuotebotPlugin) checkSchemaVersion(version int, migrations []migration) *model.AppError {
+	if version > len(migrations) {
+		return p.NewError("The quotes are from a newer version of Quotebot.",
+			fmt.Sprintf("The data is schema version %d, but this version of Quotebot only knows up to %d.", version, len(migrations)),
+			"checkSchemaVersion")
+	}
+
+	return nil
+}
+
+// Migrate - Bring the stored data up to date by running the migrations it
+// hasn't had yet, in order, recording the version after each one.
+//
+// If another server in the cluster is migrating too, whichever one records a
+// version first wins, and the other carries on from there. Refuses to touch
+// data from a newer version of Quotebot.
+func (p *QuotebotPlugin) Migrate(migrations []migration) *model.AppError {
+	version, raw, err := p.loadSchemaVersion()
+	if err != nil {
+		return err
+	}
+	err = p.checkSchemaVersion(version, migrations)
+	if err != nil {
+		return err
+	}
+	if version == len(migrations) {
+		return nil
+	}
+
+	p.API.LogInfo("Migrating the quotes.", "from", version)
+	for version < len(migrations) {
+		next := migrations[version]
+		p.API.LogInfo("Running migration: "+next.description, "version", version+1)
+
+		err = next.run(p)
+		if err != nil {
+			p.API.LogError("Migration failed.", "version", version+1)
+			return err
+		}
+
+		newRaw := []byte(strconv.Itoa(version + 1))
+		ok, err := p.API.KVCompareAndSet(schemaVersionKey, raw, newRaw)
+		if err != nil {
+			return err
+		}
+		if ok {
+			version++
+			raw = newRaw
+			continue
+		}
+
+		// Someone else recorded a version first.
+		version, raw, err = p.loadSchemaVersion()
+		if err != nil {
+			return err
+		}
+		err = p.checkSchemaVersion(version, migrations)
+		if err != nil {
+			return err
+		}
+	}
+	p.API.LogInfo("The quotes are up to date.", "version", version)
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMigrations - Migrations that count how often they run, and fail while
+// *fail is set.
+func testMigrations(runs []int, fail *bool) []migration {
+	var testMigrations []migration
+	for idx := range runs {
+		idx := idx
+		testMigrations = append(testMigrations, migration{
+			description: "Test migration.",
+			run: func(p *QuotebotPlugin) *model.AppError {
+				if idx == len(runs)-1 && *fail {
+					return p.NewError("Nope.", "Nope.", "testMigrations")
+				}
+
+				runs[idx]++
+				return nil
+			},
+		})
+	}
+
+	return testMigrations
+}
+
+// TestMigrate - Test the Migrate function.
+func TestMigrate(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+
+	// A new install runs everything.
+	runs := make([]int, 3)
+	fail := true
+	err := p.Migrate(testMigrations(runs, &fail)[:2])
+	assert.Nil(t, err)
+	assert.EqualValues(t, runs, []int{1, 1, 0})
+	version, _, err := p.loadSchemaVersion()
+	assert.Nil(t, err)
+	assert.EqualValues(t, version, 2)
+
+	// Once.
+	err = p.Migrate(testMigrations(runs, &fail)[:2])
+	assert.Nil(t, err)
+	assert.EqualValues(t, runs, []int{1, 1, 0})
+
+	// A failed migration is tried again next time.
+	err = p.Migrate(testMigrations(runs, &fail))
+	assert.NotNil(t, err)
+	version, _, _ = p.loadSchemaVersion()
+	assert.EqualValues(t, version, 2)
+
+	fail = false
+	err = p.Migrate(testMigrations(runs, &fail))
+	assert.Nil(t, err)
+	assert.EqualValues(t, runs, []int{1, 1, 1})
+	version, _, _ = p.loadSchemaVersion()
+	assert.EqualValues(t, version, 3)
+
+	// Data from a newer Quotebot is left alone.
+	err = p.Migrate(testMigrations(runs, &fail)[:1])
+	assert.NotNil(t, err)
+	assert.EqualValues(t, runs, []int{1, 1, 1})
+	version, _, _ = p.loadSchemaVersion()
+	assert.EqualValues(t, version, 3)
+
+	p.API.KVSet(schemaVersionKey, []byte("three"))
+	err = p.Migrate(testMigrations(runs, &fail))
+	assert.NotNil(t, err)
+}
+
+// TestMigrateOnActivate - The real migrations run when the plugin starts.
+func TestMigrateOnActivate(t *testing.T) {
+	// Quotes from before they had their own keys.
+	legacy, _ := json.Marshal([]string{"quote 1", "quote 2"})
+	api := initAPI(t, "normal", "mock", legacy)
+	p := &QuotebotPlugin{}
+	p.SetAPI(api)
+
+	assert.Nil(t, p.OnActivate())
+	version, _, err := p.loadSchemaVersion()
+	assert.Nil(t, err)
+	assert.EqualValues(t, version, len(migrations))
+	raw, _ := api.KVGet(quotesKey)
+	assert.Nil(t, raw)
+	quotes, err := p.collection(sharedCollection).List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+
+	// Starting again doesn't change anything.
+	assert.Nil(t, p.OnActivate())
+	quotes, err = p.collection(sharedCollection).List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+
+	// Quotebot won't start on data from a newer version.
+	api.KVSet(schemaVersionKey, []byte("1000"))
+	assert.NotNil(t, p.OnActivate())
+}
+
+// TestRollbackSchemaVersion - Snapshots from a newer version of Quotebot
+// can't be rolled back to.
+func TestRollbackSchemaVersion(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	_, err := p.Snapshot("newer", "userid", "")
+	assert.Nil(t, err)
+
+	raw, _ := p.API.KVGet(snapshotKeyPrefix + "newer")
+	var contents snapshot
+	assert.Nil(t, json.Unmarshal(raw, &contents))
+	contents.SchemaVersion = 1000
+	raw, _ = json.Marshal(contents)
+	p.API.KVSet(snapshotKeyPrefix+"newer", raw)
+
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	_, err = p.Rollback("newer", "userid")
+	assert.NotNil(t, err)
+	assert.EqualValues(t, len(testQuotes(t, p)), 2)
+
+	// Older snapshots keep the schema version with their values.
+	raw, _ = json.Marshal(snapshot{Data: map[string][]byte{schemaVersionKey: []byte("1000")}})
+	p.API.KVSet(snapshotKeyPrefix+"newer", raw)
+	_, err = p.Rollback("newer", "userid")
+	assert.NotNil(t, err)
+	assert.EqualValues(t, len(testQuotes(t, p)), 2)
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"regexp"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -24,13 +24,22 @@ type QuotebotPlugin struct {
 	// setConfiguration for usage.
 	configuration *configuration
 
-	active    bool      // Is the plugin currently active?
-	lastPost  time.Time // When did we last post a random quotation?
-	userID    string    // User ID of the user we randomly post as (p.configuration.postUser).
-	channelID string    // The Channel ID of the channel we randomly post to (p.configuration.postChannel).
-	quotes    []string  // The list of quotes we know about.
-
-	commandPattern *regexp.Regexp
+	active    bool       // Is the plugin currently active?
+	postLock  sync.Mutex // Synchronizes access to lastPost, channelID and teamID.
+	lastPost  time.Time  // When did we last post a random quotation?
+	userID    string     // User ID of the user we randomly post as (p.configuration.postUser).
+	channelID string     // The Channel ID of the channel we randomly post to (p.configuration.postChannel).
+	teamID    string     // The Team ID of the channel we randomly post to.
+	stopPurge chan bool  // Closed to stop purging the trash.
+	purgeDone chan bool  // Closed once the trash purge has stopped.
+
+	// Held for writing while a rollback changes everything, and for reading
+	// by everything else that changes anything.
+	stateLock sync.RWMutex
+	readOnly  bool // Is there damage an admin hasn't checked? Guarded by stateLock.
+
+	storeLock sync.Mutex            // Synchronizes access to stores.
+	stores    map[string]QuoteStore // The quote collections we've opened, by name.
 }
 
 // -----------------------------------------------------------------------------
@@ -47,54 +56,21 @@ const (
 	slashTrigger string = "/" + trigger
 	pluginName   string = "Quotebot"
 
-	// ^/quote\s*(?P<command>(add|channel|delete|info|interval|list)\s*)?(?P<tail>.*)\s*$
-	// TODO: Remove "debug" when we're done with it.
-	commandRegex string = `(?i)^` + slashTrigger + `\s*(?P<command>(debug|add|channel|delete|info|interval|list)\s*)?(?P<tail>.*)\s*$`
-
-	// I still haven't looked into i18n.
-	helpText = `Quotebot remembers quotes you tell it about, and spits them out again when you ask it to.
-
-Commands:
-
-* /quote - Regurgitate a random quote.
-* /quote *x* - Show quote number *x*.
-* /quote add *genius quote* - Store *genius quote* for later. Don't forget to
-  include an attribution!
-* /quote help - Show the help.
-* /quote info - Show the number of quotes, the channel, and the interval.`
-	adminHelpText = `Admin commands:
-
-* /quote channel *x* - Monitor channel *x* for activity and randomly
-  show quotes there.
-* /quote delete *x* - Delete quote number *x*.
-* /quote interval *x* - The time between automatically posting quotes
-  in a channel.
-* /quote list - List all known quotes.`
+	forceFlag string = "--force" // Add a quote even if it looks like one we know.
+
+	defaultTrashRetentionDays int           = 30
+	trashPurgeInterval        time.Duration = time.Hour
 )
 
 // -----------------------------------------------------------------------------
-// Utility functions.
+// Quotebot functions
 // -----------------------------------------------------------------------------
 
-// FindNamedSubstrings - Return a map of named matches.
-func FindNamedSubstrings(re *regexp.Regexp, candidate string) map[string]string {
-	found := make(map[string]string)
-
-	values := re.FindStringSubmatch(candidate)
-	keys := re.SubexpNames()
-
-	// Why do you start indexing keys at 1 instead of 0?
-	for idx := 1; idx < len(keys); idx++ {
-		found[keys[idx]] = values[idx]
-	}
-
-	return found
+// FormatTime - Format a time in milliseconds since the epoch for humans.
+func FormatTime(millis int64) string {
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04 MST")
 }
 
-// -----------------------------------------------------------------------------
-// Quotebot functions
-// -----------------------------------------------------------------------------
-
 // IsAdmin - Is the given UserID an admin user?
 func (p *QuotebotPlugin) IsAdmin(userID string) bool {
 	isAdmin := false
@@ -116,6 +92,23 @@ func (p *QuotebotPlugin) IsAdmin(userID string) bool {
 	return isAdmin
 }
 
+// IsChannelMember - Is the given UserID a member of the given channel?
+func (p *QuotebotPlugin) IsChannelMember(channelID string, userID string) bool {
+	member, err := p.API.GetChannelMember(channelID, userID)
+
+	return err == nil && member != nil
+}
+
+// UserName - Get a user's @name for display, or something vague if we can't.
+func (p *QuotebotPlugin) UserName(userID string) string {
+	user, err := p.API.GetUser(userID)
+	if err != nil || user == nil {
+		return "an unknown user"
+	}
+
+	return "@" + user.Username
+}
+
 // NewResponse - Create a new response object.
 func (p *QuotebotPlugin) NewResponse(responseType string, responseText string) *model.CommandResponse {
 	props := map[string]interface{}{
@@ -141,27 +134,153 @@ func (p *QuotebotPlugin) NewError(message string, details string, where string)
 	}
 }
 
+// loadJSONKey - Load the JSON value at key into v, and return its raw value
+// for compare-and-set. v is left alone if there's nothing there. what names the
+// value in error messages, like "snapshots".
+func (p *QuotebotPlugin) loadJSONKey(key string, v interface{}, what string) ([]byte, *model.AppError) {
+	raw, err := p.API.KVGet(key)
+	if err != nil {
+		return nil, p.NewError("Unable to load "+what+".", "API.KVGet() failed.", "loadJSONKey")
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	loadErr := json.Unmarshal(raw, v)
+	if loadErr != nil {
+		return nil, p.NewError("Unable to load "+what+".", fmt.Sprintf("json.Unmarshal(%q) failed.", raw), "loadJSONKey")
+	}
+
+	return raw, nil
+}
+
+// updateJSONKey - Change the JSON value at key with compare-and-set, retrying
+// if someone else changed it first. Each try loads the value into v, a
+// pointer, then calls update to change it; update returns false if there's
+// nothing to save. what names the value in error messages, like "snapshots".
+func (p *QuotebotPlugin) updateJSONKey(key string, v interface{}, what string, update func() bool) *model.AppError {
+	value := reflect.ValueOf(v).Elem()
+	for try := 0; try < maxCompareAndSetTries; try++ {
+		// Start from nothing, so what's left from the last try doesn't get
+		// mixed in.
+		value.Set(reflect.Zero(value.Type()))
+		oldRaw, err := p.loadJSONKey(key, v, what)
+		if err != nil {
+			return err
+		}
+
+		if update() == false {
+			return nil
+		}
+
+		newRaw, jsonErr := json.Marshal(v)
+		if jsonErr != nil {
+			return p.NewError("Unable to save "+what+".", fmt.Sprintf("json.Marshal(%v) failed.", value.Interface()), "updateJSONKey")
+		}
+
+		ok, err := p.API.KVCompareAndSet(key, oldRaw, newRaw)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return p.NewError("Unable to save "+what+".", "Too many concurrent changes to "+what+".", "updateJSONKey")
+}
+
+// RandomQuote - Pick a random quotation, or nil if there aren't any.
+func (p *QuotebotPlugin) RandomQuote(store QuoteStore) (*Quote, *model.AppError) {
+	ids, err := store.IDs()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	// rand.Intn() throws an exception if you call it with 0...
+	return store.Get(ids[rand.Intn(len(ids))])
+}
+
+// RandomMatchingQuote - Pick a random quotation matching the query, or nil if
+// there aren't any.
+func (p *QuotebotPlugin) RandomMatchingQuote(store QuoteStore, query *Query) (*Quote, *model.AppError) {
+	if query.Empty() {
+		return p.RandomQuote(store)
+	}
+
+	quotes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]Quote, 0, len(quotes))
+	for idx := range quotes {
+		if query.Matches(&quotes[idx]) {
+			matching = append(matching, quotes[idx])
+		}
+	}
+	if len(matching) == 0 {
+		return nil, nil
+	}
+
+	return &matching[rand.Intn(len(matching))], nil
+}
+
+// postTarget - The channel we randomly post to, and its team.
+func (p *QuotebotPlugin) postTarget() (string, string) {
+	p.postLock.Lock()
+	defer p.postLock.Unlock()
+
+	return p.channelID, p.teamID
+}
+
+// setPostTarget - Change the channel we randomly post to, and its team.
+func (p *QuotebotPlugin) setPostTarget(channelID string, teamID string) {
+	p.postLock.Lock()
+	defer p.postLock.Unlock()
+
+	p.channelID = channelID
+	p.teamID = teamID
+}
+
 // PostRandom - Post a random quotation if enough time has passed.
 func (p *QuotebotPlugin) PostRandom() {
+	// Not in the middle of a rollback. stateLock comes before postLock, like
+	// it does for commands.
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+
+	p.postLock.Lock()
+	defer p.postLock.Unlock()
+
 	now := time.Now()
 	delta := now.Sub(p.lastPost)
 
-	if delta.Minutes() < p.configuration.postDelta {
+	if delta.Minutes() < p.getConfiguration().postDelta {
 		return
 	}
 
 	p.lastPost = now
 
-	var quote string
-	switch len(p.quotes) {
-	case 0:
-		// something zen
-		quote = "There is no void if you don't try to fill it. -- Marty Rubin"
-	case 1:
-		// rand.Intn() throws an exception if you call it with 0.
-		quote = p.quotes[0]
-	default:
-		quote = p.quotes[rand.Intn(len(p.quotes))+1]
+	// something zen
+	quote := "There is no void if you don't try to fill it. -- Marty Rubin"
+	store := p.Store(p.teamID)
+	if p.getConfiguration().postChannelQuotes {
+		store = p.collection(channelCollection(p.channelID))
+	}
+	query, queryErr := ParseQuery(p.getConfiguration().PostQuery)
+	if queryErr != nil {
+		p.API.LogError("PostRandom() - unable to read the query, posting any quote.", "error", queryErr.Error())
+		query = nil
+	}
+	p.linkQueryUsers(query)
+	randomQuote, randomErr := p.ShuffledQuote(p.channelID, store, query)
+	if randomErr != nil {
+		p.API.LogError("PostRandom() - unable to pick a quote.", "error", randomErr.Error())
+		return
+	}
+	if randomQuote != nil {
+		quote = randomQuote.Text
 	}
 
 	// Example of using CreatPost() from the unit tests:
@@ -187,35 +306,96 @@ func (p *QuotebotPlugin) PostRandom() {
 	}
 }
 
-// LoadQuotes - Load the quote list from the key-value store.
-func (p *QuotebotPlugin) LoadQuotes() *model.AppError {
-	raw, err := p.API.KVGet("quotes")
-	if raw == nil {
-		// Stay empty.
-		return nil
+// PurgeTrash - Permanently delete quotes that have been in the trash longer
+// than the configured retention period, in every collection.
+func (p *QuotebotPlugin) PurgeTrash() {
+	days := p.getConfiguration().trashRetentionDays()
+	if days == 0 {
+		// Keep them forever.
+		return
+	}
+
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+
+	// Damaged quotes might be in the trash; leave them until an admin checks.
+	if p.readOnly {
+		return
 	}
+
+	names, err := p.collections()
 	if err != nil {
-		// message string, details string, where string
-		return p.NewError("Unable to load quotes.", "API.KVGet() failed.", "LoadQuotes")
+		p.API.LogError("Unable to purge the trash.", "error", err.Error())
+		return
 	}
 
-	var quotes []string
-	loadErr := json.Unmarshal(raw, &quotes)
-	if loadErr != nil {
-		return p.NewError("Unable to load quotes.", fmt.Sprintf("json.Unmarshal(%q) failed.", raw), "LoadQuotes")
+	// Purging is for good, so snapshot first, but only if there's something
+	// to purge; snapshots are big.
+	before := model.GetMillis() - int64(days)*int64(24*time.Hour/time.Millisecond)
+	var expired []string
+	for idx := range names {
+		trash, err := p.collection(names[idx]).Trash()
+		if err != nil {
+			p.API.LogError("Unable to purge the trash.", "error", err.Error())
+			continue
+		}
+		for _, quote := range trash {
+			if quote.DeleteAt < before {
+				expired = append(expired, names[idx])
+				break
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	_, err = p.automaticSnapshot("", "purging the trash")
+	if err != nil {
+		p.API.LogError("Unable to purge the trash.", "error", err.Error())
+		return
+	}
+
+	for idx := range expired {
+		purged, err := p.collection(expired[idx]).Purge(before)
+		if err != nil {
+			p.API.LogError("Unable to purge the trash.", "error", err.Error())
+			continue
+		}
+		if purged > 0 {
+			p.API.LogInfo("Purged quotes from the trash.", "count", purged)
+		}
 	}
+}
 
-	p.quotes = quotes
+// purgeTrashPeriodically - Purge the trash every trashPurgeInterval until stop
+// is closed, starting one interval from now so activating the plugin doesn't
+// have to wait for it. Closes done when it stops.
+func (p *QuotebotPlugin) purgeTrashPeriodically(stop chan bool, done chan bool) {
+	defer close(done)
 
-	return nil
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.PurgeTrash()
+	}
 }
 
-// SaveQuotes - Load the quote list from the key-value store.
-func (p *QuotebotPlugin) SaveQuotes() *model.AppError {
-	raw, err := json.Marshal(p.quotes)
-	if err != nil {
-		return p.NewError("Unable to save quotes.", fmt.Sprintf("json.Marshal(%q) failed.", p.quotes), "SaveQuotes")
+// stopPurging - Stop purging the trash, if we are, and wait for a purge that's
+// under way to finish.
+func (p *QuotebotPlugin) stopPurging() {
+	if p.stopPurge == nil {
+		return
 	}
 
-	return p.API.KVSet("quotes", raw)
+	close(p.stopPurge)
+	<-p.purgeDone
+	p.stopPurge = nil
+	p.purgeDone = nil
 }
@@ -1,65 +1,15 @@
 package main
 
 import (
-	"regexp"
 	"testing"
+	"time"
 
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/plugin/plugintest/mock"
 	"github.com/stretchr/testify/assert"
 )
 
-// -----------------------------------------------------------------------------
-// Tests - Utility functions.
-// -----------------------------------------------------------------------------
-
-// TestFindNamedSubstrings - Make sure our regex and FindNamedSubstrings work.
-func TestFindNamedSubstrings(t *testing.T) {
-	pat := regexp.MustCompile(commandRegex)
-
-	// Regular commands.
-	matches := FindNamedSubstrings(pat, "/quote")
-	command := matches["command"]
-	assert.EqualValues(t, command, "")
-	tail := matches["tail"]
-	assert.EqualValues(t, tail, "")
-
-	matches = FindNamedSubstrings(pat, "/quote 1")
-	command = matches["command"]
-	assert.EqualValues(t, command, "")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "1")
-
-	matches = FindNamedSubstrings(pat, "/quote add")
-	command = matches["command"]
-	assert.EqualValues(t, command, "add")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "")
-
-	matches = FindNamedSubstrings(pat, "/quote add Some genius quote.")
-	command = matches["command"]
-	assert.EqualValues(t, command, "add ")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "Some genius quote.")
-
-	// Admin commands.
-	matches = FindNamedSubstrings(pat, "/quote list")
-	command = matches["command"]
-	assert.EqualValues(t, command, "list")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "")
-
-	matches = FindNamedSubstrings(pat, "/quote delete")
-	command = matches["command"]
-	assert.EqualValues(t, command, "delete")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "")
-
-	matches = FindNamedSubstrings(pat, "/quote delete 1")
-	command = matches["command"]
-	assert.EqualValues(t, command, "delete ")
-	tail = matches["tail"]
-	assert.EqualValues(t, tail, "1")
-}
-
 // -----------------------------------------------------------------------------
 // Tests - Quotebot functions
 // -----------------------------------------------------------------------------
@@ -82,20 +32,6 @@ func TestIsAdmin(t *testing.T) {
 	assert.True(t, p.IsAdmin("userid"))
 }
 
-// TestLoadQuotes - Test the LoadQuotes function.
-func TestLoadQuotes(t *testing.T) {
-	p := initTestPlugin(t, "normal", "mock")
-	err := p.LoadQuotes()
-	assert.Nil(t, err)
-	assert.EqualValues(t, len(p.quotes), 0)
-
-	api := initAPI(t, "normal", "mock", []byte(`["quote 1", "quote 2"]`))
-	p.SetAPI(api)
-	err = p.LoadQuotes()
-	assert.Nil(t, err)
-	assert.EqualValues(t, len(p.quotes), 2)
-}
-
 // TestNewError - Test the NewError function.
 func TestNewError(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
@@ -106,6 +42,43 @@ func TestNewError(t *testing.T) {
 	assert.EqualValues(t, err.Where, "QuotebotPlugin.where")
 }
 
+// TestUpdateJSONKey - Changes start over from what's there now when someone
+// else got in first, and nothing is saved if there's nothing to change.
+func TestUpdateJSONKey(t *testing.T) {
+	api, kv := initKVAPI(t, "normal", "mock", nil)
+	p := &QuotebotPlugin{}
+	p.SetAPI(api)
+	kv.data["key"] = []byte(`["a"]`)
+
+	var values []string
+	tries := 0
+	err := p.updateJSONKey("key", &values, "values", func() bool {
+		tries++
+		if tries == 1 {
+			kv.data["key"] = []byte(`["a", "b"]`)
+		}
+		values = append(values, "c")
+
+		return true
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, tries, 2)
+	assert.EqualValues(t, string(kv.data["key"]), `["a","b","c"]`)
+
+	err = p.updateJSONKey("key", &values, "values", func() bool {
+		return false
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, string(kv.data["key"]), `["a","b","c"]`)
+
+	kv.data["key"] = []byte(`not json`)
+	err = p.updateJSONKey("key", &values, "values", func() bool {
+		return true
+	})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, err.Message, "Unable to load values.")
+}
+
 // TestNewResponse - Test the NewResponse function.
 func TestNewResponse(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
@@ -115,15 +88,97 @@ func TestNewResponse(t *testing.T) {
 	assert.EqualValues(t, resp.Text, "string")
 }
 
-// // TestPostRandom - Test the PostRandom function.
-// func TestPostRandom(t *testing.T) {
-// }
+// TestPostRandom - Test the PostRandom function.
+func TestPostRandom(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.setPostTarget("channelid", "teamid") // As if SetChannel picked the test channel.
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	api := p.API.(*plugintest.API)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	p.PostRandom()
+	api.AssertCalled(t, "CreatePost", &model.Post{UserId: p.userID, ChannelId: p.channelID, Message: "quote 1"})
 
-// TestSaveQuotes - Test the SaveQuotes function.
-// This test is weak. Not sure how to mock this to test it in a useful way,
-// it's a fairly trivial function...
-func TestSaveQuotes(t *testing.T) {
+	// Not again until the interval has passed.
+	p.PostRandom()
+	api.AssertNumberOfCalls(t, "CreatePost", 1)
+
+	// The channel's own quotes, if it has them.
+	configuration := p.getConfiguration().Clone()
+	configuration.postChannelQuotes = true
+	p.setConfiguration(configuration)
+	p.AddQuote(testCommandArgs(""), "--here war story 1")
+	p.lastPost = time.Time{}
+
+	p.PostRandom()
+	api.AssertCalled(t, "CreatePost", &model.Post{UserId: p.userID, ChannelId: p.channelID, Message: "war story 1"})
+}
+
+// TestRandomQuote - Test the RandomQuote function.
+func TestRandomQuote(t *testing.T) {
 	p := initTestPlugin(t, "normal", "mock")
 	assert.Nil(t, p.OnActivate())
-	assert.EqualValues(t, len(p.quotes), 0)
+
+	quote, err := p.RandomQuote(p.Store("teamid"))
+	assert.Nil(t, err)
+	assert.Nil(t, quote)
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.Store("teamid").Delete(1, "userid")
+
+	quote, err = p.RandomQuote(p.Store("teamid"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.Text, "quote 2")
+}
+
+// TestPurgeTrash - Test the PurgeTrash function.
+func TestPurgeTrash(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	p.Store("teamid").Delete(1, "userid")
+
+	// Too recent to purge.
+	p.PurgeTrash()
+	trash, err := p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 1)
+	infos, err := p.Snapshots()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(infos), 0)
+
+	// Old enough, so it's gone for good, after a snapshot.
+	trash[0].DeleteAt = 1
+	quote, _ := p.Store("teamid").Get(2)
+	p.Store("teamid").Replace(2, []Quote{*quote}, trash)
+	p.PurgeTrash()
+	trash, err = p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 0)
+	infos, err = p.Snapshots()
+	assert.Nil(t, err)
+	if assert.EqualValues(t, len(infos), 1) {
+		assert.EqualValues(t, infos[0].Reason, "purging the trash")
+		assert.EqualValues(t, infos[0].UserID, "")
+	}
+
+	// Keeping them forever.
+	configuration := p.getConfiguration().Clone()
+	configuration.TrashRetentionDays = "0"
+	p.setConfiguration(configuration)
+
+	p.Store("teamid").Delete(2, "userid")
+	trash, err = p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	trash[0].DeleteAt = 1
+	p.Store("teamid").Replace(2, nil, trash)
+	p.PurgeTrash()
+	trash, err = p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 1)
 }
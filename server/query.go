@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	queryNot    string = "-"
+	queryAuthor string = "@"
+	queryTag    string = "#"
+	querySince  string = "since:"
+	queryBefore string = "before:"
+
+	// "/quote from Gus M" picks a quote by someone whose name has spaces.
+	queryFrom string = "from"
+)
+
+// queryTermKind - What a query term looks at.
+type queryTermKind int
+
+const (
+	queryText   queryTermKind = iota // The quote's text contains it.
+	queryBy                          // Someone said the quote.
+	queryTagged                      // The quote has a tag.
+	queryAfter                       // The quote was added on or after a date.
+	queryUntil                       // The quote was added before a date.
+)
+
+var (
+	// The dates since: and before: understand, from the most to the least
+	// precise.
+	queryDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+)
+
+// queryTerm - One part of a query, like @gus or -#nsfw.
+type queryTerm struct {
+	kind   queryTermKind
+	value  string // The text, name or tag; names have no "@", and tags are normalized.
+	userID string // For names, the user they are here, if they are one.
+	date   string // For since: and before:, as written.
+	millis int64  // For since: and before:, the start of the date in milliseconds since the epoch.
+	negate bool   // Quotes must not match it.
+}
+
+// Query - Which quotes to pick, like @gus #work -#nsfw since:2024 "primes".
+// Quotes have to match every term.
+type Query struct {
+	terms []queryTerm
+}
+
+// -----------------------------------------------------------------------------
+// Parsing
+// -----------------------------------------------------------------------------
+
+// ParseQuery - Read a query from a command's tail.
+//
+// @name picks quotes someone said, #tag quotes with a tag, and since:date
+// and before:date quotes added on or after, or before, a date: a year like
+// 2024, a month like 2024-03 or a day like 2024-03-15, in UTC. Any other word
+// picks quotes containing it; put quotes around a phrase, or around a word
+// that shouldn't mean anything special, like "#1". A - in front of a word,
+// name or tag picks quotes that don't match it instead.
+func ParseQuery(tail string) (*Query, *TokenizeError) {
+	tokens, err := Tokenize(tail)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseQueryTokens(tokens)
+}
+
+// parseQueryTokens - Read a query from words that have already been split up.
+func parseQueryTokens(tokens []Token) (*Query, *TokenizeError) {
+	query := &Query{}
+	for idx := range tokens {
+		term, err := parseQueryTerm(tokens[idx])
+		if err != nil {
+			return nil, err
+		}
+		query.terms = append(query.terms, term)
+	}
+
+	return query, nil
+}
+
+// parseQueryTerm - Read one word of a query.
+func parseQueryTerm(token Token) (queryTerm, *TokenizeError) {
+	if token.Flag != "" {
+		return queryTerm{}, &TokenizeError{Column: token.Column,
+			Problem: fmt.Sprintf("Queries don't have a --%s flag. Put quotes around it to look for it in the quotes.", token.Flag)}
+	}
+	if token.Quoted {
+		return queryTerm{kind: queryText, value: token.Text}, nil
+	}
+
+	term := queryTerm{kind: queryText}
+	word := token.Text
+	if strings.HasPrefix(word, queryNot) && len(word) > len(queryNot) {
+		term.negate = true
+		word = strings.TrimPrefix(word, queryNot)
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasPrefix(word, queryAuthor):
+		term.kind = queryBy
+		term.value = strings.TrimPrefix(word, queryAuthor)
+		if term.value == "" {
+			return term, &TokenizeError{Column: token.Column, Problem: "Who? Put a name after the @, like @gus."}
+		}
+
+	case strings.HasPrefix(word, queryTag):
+		term.kind = queryTagged
+		term.value = NormalizeTag(word)
+		if term.value == "" {
+			return term, &TokenizeError{Column: token.Column,
+				Problem: fmt.Sprintf("%q isn't a tag. Tags start with a letter, and have letters, numbers, - and _.", word)}
+		}
+
+	case strings.HasPrefix(lower, querySince), strings.HasPrefix(lower, queryBefore):
+		term.kind = queryAfter
+		prefix := querySince
+		if strings.HasPrefix(lower, queryBefore) {
+			term.kind = queryUntil
+			prefix = queryBefore
+		}
+		if term.negate {
+			return term, &TokenizeError{Column: token.Column,
+				Problem: fmt.Sprintf("%s can't have a - in front of it; use since: or before: instead.", prefix)}
+		}
+
+		term.date = word[len(prefix):]
+		millis, ok := parseQueryDate(term.date)
+		if ok == false {
+			return term, &TokenizeError{Column: token.Column,
+				Problem: fmt.Sprintf("%q isn't a date. Use a year like %s2024, a month like %s2024-03, or a day like %s2024-03-15.",
+					term.date, prefix, prefix, prefix)}
+		}
+		term.millis = millis
+
+	default:
+		term.value = word
+	}
+
+	return term, nil
+}
+
+// parseQueryDate - The start of a year, month or day, in milliseconds since
+// the epoch.
+func parseQueryDate(date string) (int64, bool) {
+	for _, layout := range queryDateLayouts {
+		when, err := time.Parse(layout, date)
+		if err == nil {
+			return when.UnixNano() / int64(time.Millisecond), true
+		}
+	}
+
+	return 0, false
+}
+
+// personQuery - A query for the quotes someone said, by name or @username.
+func personQuery(name string) *Query {
+	return &Query{terms: []queryTerm{{kind: queryBy, value: strings.TrimPrefix(strings.TrimSpace(name), queryAuthor)}}}
+}
+
+// -----------------------------------------------------------------------------
+// Matching
+// -----------------------------------------------------------------------------
+
+// Empty - Does the query pick every quote?
+func (q *Query) Empty() bool {
+	return q == nil || len(q.terms) == 0
+}
+
+// Matches - Does the quote match every term of the query?
+func (q *Query) Matches(quote *Quote) bool {
+	if q == nil {
+		return true
+	}
+
+	for idx := range q.terms {
+		if q.terms[idx].matches(quote) == q.terms[idx].negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches - Does the quote match the term, ignoring whether it's negated?
+func (t *queryTerm) matches(quote *Quote) bool {
+	switch t.kind {
+	case queryBy:
+		return saidBy(quote, t.value) || saidByUser(quote, t.userID)
+	case queryTagged:
+		return quote.HasTag(t.value)
+	case queryAfter:
+		return quote.CreateAt != 0 && quote.CreateAt >= t.millis
+	case queryUntil:
+		return quote.CreateAt != 0 && quote.CreateAt < t.millis
+	}
+
+	return containsText(quote.Text, t.value)
+}
+
+// person - The name or @username, if the query only picks the quotes someone
+// said.
+func (q *Query) person() string {
+	if q == nil || len(q.terms) != 1 || q.terms[0].kind != queryBy || q.terms[0].negate {
+		return ""
+	}
+	if q.terms[0].userID != "" {
+		return queryAuthor + q.terms[0].value
+	}
+
+	return q.terms[0].value
+}
+
+// containsText - Does text contain part, ignoring case and fancy quotes and
+// dashes?
+func containsText(text string, part string) bool {
+	return strings.Contains(strings.ToLower(quoteTextReplacer.Replace(text)), strings.ToLower(quoteTextReplacer.Replace(part)))
+}
+
+// String - The query, written so ParseQuery reads it back the same.
+func (q *Query) String() string {
+	if q == nil {
+		return ""
+	}
+
+	words := make([]string, 0, len(q.terms))
+	for idx := range q.terms {
+		words = append(words, q.terms[idx].String())
+	}
+
+	return strings.Join(words, " ")
+}
+
+// String - The term, written so parseQueryTerm reads it back the same.
+func (t *queryTerm) String() string {
+	word := ""
+	switch t.kind {
+	case queryBy:
+		word = queryAuthor + t.value
+	case queryTagged:
+		word = queryTag + t.value
+	case queryAfter:
+		word = querySince + t.date
+	case queryUntil:
+		word = queryBefore + t.date
+	default:
+		// Negated text was never quoted. Other text is, if it has spaces or
+		// would mean something else without them.
+		word = t.value
+		if t.negate == false {
+			word = QuoteArgument(t.value)
+			lower := strings.ToLower(t.value)
+			if word == t.value && (strings.HasPrefix(word, queryNot) || strings.HasPrefix(word, queryAuthor) ||
+				strings.HasPrefix(word, queryTag) || strings.HasPrefix(lower, querySince) || strings.HasPrefix(lower, queryBefore)) {
+				word = `"` + word + `"`
+			}
+		}
+	}
+
+	if t.negate {
+		return queryNot + word
+	}
+
+	return word
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// commandQuery - Read a query from a command's tail, or "from" and someone's
+// name. If it can't be, the response says why.
+func (p *QuotebotPlugin) commandQuery(args *model.CommandArgs, tail string) (*Query, *model.CommandResponse) {
+	tokens, unreadable := p.commandTokens(args, tail)
+	if unreadable != nil {
+		return nil, unreadable
+	}
+
+	// Names can have spaces, so everything after "from" is one.
+	if len(tokens) > 0 && tokens[0].Quoted == false && strings.EqualFold(tokens[0].Text, queryFrom) {
+		words := make([]string, 0, len(tokens)-1)
+		for idx := range tokens[1:] {
+			words = append(words, tokens[1+idx].Text)
+		}
+		name := strings.Join(words, " ")
+		if strings.TrimPrefix(strings.TrimSpace(name), queryAuthor) == "" {
+			return nil, p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "From who? Put a name after from, like /quote from Gus.")
+		}
+
+		query := personQuery(name)
+		p.linkQueryUsers(query)
+		return query, nil
+	}
+
+	query, err := parseQueryTokens(tokens)
+	if err != nil {
+		return nil, p.unreadable(args, tail, err)
+	}
+	p.linkQueryUsers(query)
+
+	return query, nil
+}
+
+// linkQueryUsers - Look up the names in a query that are users here, so it
+// picks their quotes even if they've changed their username since.
+func (p *QuotebotPlugin) linkQueryUsers(query *Query) {
+	if query == nil {
+		return
+	}
+
+	for idx := range query.terms {
+		term := &query.terms[idx]
+		if term.kind != queryBy || strings.Contains(term.value, " ") { // Usernames don't have spaces.
+			continue
+		}
+
+		user, err := p.API.GetUserByUsername(strings.ToLower(term.value))
+		if err == nil && user != nil {
+			term.userID = user.Id
+		}
+	}
+}
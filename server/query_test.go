@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseQuery - Test the ParseQuery function.
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`@gus #Work -#nsfw since:2024 before:2024-03-15 "primes are" odd -even`)
+	assert.Nil(t, err)
+	assert.EqualValues(t, query.terms, []queryTerm{
+		{kind: queryBy, value: "gus"},
+		{kind: queryTagged, value: "work"},
+		{kind: queryTagged, value: "nsfw", negate: true},
+		{kind: queryAfter, date: "2024", millis: 1704067200000},
+		{kind: queryUntil, date: "2024-03-15", millis: 1710460800000},
+		{kind: queryText, value: "primes are"},
+		{kind: queryText, value: "odd"},
+		{kind: queryText, value: "even", negate: true},
+	})
+	assert.EqualValues(t, query.String(), `@gus #work -#nsfw since:2024 before:2024-03-15 "primes are" odd -even`)
+
+	// Quoted words don't mean anything special.
+	query, err = ParseQuery(`"#1" '@gus' "-x" "since:2024" - x-y`)
+	assert.Nil(t, err)
+	for idx := range query.terms {
+		assert.EqualValues(t, query.terms[idx].kind, queryText)
+		assert.False(t, query.terms[idx].negate)
+	}
+	again, err := ParseQuery(query.String())
+	assert.Nil(t, err)
+	assert.EqualValues(t, again, query)
+
+	query, err = ParseQuery("")
+	assert.Nil(t, err)
+	assert.True(t, query.Empty())
+
+	errors := map[string]TokenizeError{
+		`@`:                    {1, "Who? Put a name after the @, like @gus."},
+		`ok #3`:                {4, `"#3" isn't a tag. Tags start with a letter, and have letters, numbers, - and _.`},
+		`since:yesterday`:      {1, `"yesterday" isn't a date. Use a year like since:2024, a month like since:2024-03, or a day like since:2024-03-15.`},
+		`BEFORE:2024-13`:       {1, `"2024-13" isn't a date. Use a year like before:2024, a month like before:2024-03, or a day like before:2024-03-15.`},
+		`-since:2024`:          {1, "since: can't have a - in front of it; use since: or before: instead."},
+		`primes --sort=newest`: {8, "Queries don't have a --sort flag. Put quotes around it to look for it in the quotes."},
+		`"primes`:              {1, `This " is never closed.`},
+	}
+	for text, expected := range errors {
+		query, err := ParseQuery(text)
+		assert.Nil(t, query, text)
+		if assert.NotNil(t, err, text) {
+			assert.EqualValues(t, *err, expected, text)
+		}
+	}
+}
+
+// TestQueryMatches - Test the Query.Matches function.
+func TestQueryMatches(t *testing.T) {
+	quote := &Quote{
+		Text:     "It’s “prime” time. -- Gus",
+		Speakers: []Speaker{{Name: "gus", UserID: "gusid"}},
+		Tags:     []string{"work"},
+		CreateAt: 1710460800000, // 2024-03-15
+	}
+	old := &Quote{Text: "Before dates. -- Rob", Author: "Rob"}
+
+	tests := []struct {
+		query string
+		quote *Quote
+		match bool
+	}{
+		{``, quote, true},
+		{`@GUS`, quote, true},
+		{`@rob`, quote, false},
+		{`-@rob`, quote, true},
+		{`@rob`, old, true},
+		{`#work`, quote, true},
+		{`-#work`, quote, false},
+		{`#play`, quote, false},
+		{`since:2024-03-15`, quote, true},
+		{`since:2024-03-16`, quote, false},
+		{`before:2024-03-16`, quote, true},
+		{`before:2024-03`, quote, false},
+		{`since:2000`, old, false},
+		{`before:2100`, old, false},
+		{`"it's \"PRIME\""`, quote, true},
+		{`-prime`, quote, false},
+		{`-evens`, quote, true},
+		{`@gus #work since:2024 '"prime" time'`, quote, true},
+		{`@gus #work since:2024 "prime times"`, quote, false},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.query)
+		if assert.Nil(t, err, test.query) {
+			assert.EqualValues(t, query.Matches(test.quote), test.match, test.query)
+		}
+	}
+}
+
+// TestRandomMatchingQuote - Only matching quotes are picked.
+func TestRandomMatchingQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	store := NewMemoryQuoteStore()
+	store.Add(Quote{Text: "quote 1", Tags: []string{"work"}})
+	store.Add(Quote{Text: "quote 2"})
+
+	query, _ := ParseQuery("#work")
+	for idx := 0; idx < 10; idx++ {
+		quote, err := p.RandomMatchingQuote(store, query)
+		assert.Nil(t, err)
+		assert.EqualValues(t, quote.ID, 1)
+	}
+
+	query, _ = ParseQuery("#play")
+	quote, err := p.RandomMatchingQuote(store, query)
+	assert.Nil(t, err)
+	assert.Nil(t, quote)
+
+	quote, err = p.RandomMatchingQuote(store, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, quote)
+}
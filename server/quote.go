@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// Quote - A quotation, and everything we know about where it came from.
+type Quote struct {
+	ID        int    `json:"id"`         // Stable ID; 1-based for humans.
+	Text      string `json:"text"`       // The quotation itself.
+	Author    string `json:"author"`     // Who said it, if we know, for humans.
+	UserID    string `json:"user_id"`    // User ID of the person who added it.
+	CreateAt  int64  `json:"create_at"`  // When it was added, in milliseconds since the epoch.
+	ChannelID string `json:"channel_id"` // Channel it was added from.
+	TeamID    string `json:"team_id"`    // Team it was added from.
+	PostID    string `json:"post_id"`    // Post it was added from, if any.
+
+	Tags []string `json:"tags,omitempty"` // Lowercase, without the "#", sorted.
+
+	// Who said it, once we've looked.
+	Speakers     []Speaker `json:"speakers,omitempty"`
+	AuthorReview string    `json:"author_review,omitempty"` // Why an admin should check the speakers, if they should.
+	AuthorSetBy  string    `json:"author_set_by,omitempty"` // User ID of the admin who set the speakers by hand.
+
+	// Only set for quotes that have been edited.
+	EditAt    int64      `json:"edit_at,omitempty"`   // When it was last edited, in milliseconds since the epoch.
+	EditedBy  string     `json:"edited_by,omitempty"` // User ID of the person who last edited it.
+	Revisions []Revision `json:"revisions,omitempty"` // Earlier versions, oldest first.
+
+	// Only set for quotes in the trash.
+	DeleteAt  int64  `json:"delete_at,omitempty"`  // When it was deleted, in milliseconds since the epoch.
+	DeletedBy string `json:"deleted_by,omitempty"` // User ID of the person who deleted it.
+}
+
+// Revision - One version of a quote's text, and who wrote it when.
+type Revision struct {
+	Text     string `json:"text"`
+	UserID   string `json:"user_id"`   // User ID of the person who added or edited it.
+	CreateAt int64  `json:"create_at"` // In milliseconds since the epoch.
+}
+
+// NewQuote - Create a new quote from a command's arguments.
+func NewQuote(id int, text string, args *model.CommandArgs) Quote {
+	return Quote{
+		ID:        id,
+		Text:      text,
+		UserID:    args.UserId,
+		CreateAt:  model.GetMillis(),
+		ChannelID: args.ChannelId,
+		TeamID:    args.TeamId,
+		PostID:    args.RootId, // Set if someone is quoting from a thread.
+	}
+}
+
+// QuotesFromStrings - Convert a legacy list of quote strings into Quotes.
+//
+// We don't know anything about legacy quotes except their text, so that's
+// all we fill in.
+func QuotesFromStrings(legacy []string) []Quote {
+	quotes := make([]Quote, 0, len(legacy))
+	for idx := range legacy {
+		quotes = append(quotes, Quote{
+			ID:   idx + 1,
+			Text: legacy[idx],
+		})
+	}
+
+	return quotes
+}
+
+// Current - The quote's current version, as a Revision.
+func (q *Quote) Current() Revision {
+	if q.EditAt == 0 {
+		return Revision{Text: q.Text, UserID: q.UserID, CreateAt: q.CreateAt}
+	}
+
+	return Revision{Text: q.Text, UserID: q.EditedBy, CreateAt: q.EditAt}
+}
+
+// Versions - Every version of the quote, oldest first. The last one is the
+// current version.
+func (q *Quote) Versions() []Revision {
+	versions := make([]Revision, 0, len(q.Revisions)+1)
+	versions = append(versions, q.Revisions...)
+
+	return append(versions, q.Current())
+}
+
+// Revise - Change the quote's text, keeping the old text in its revisions.
+// Returns false if the text didn't change.
+func (q *Quote) Revise(text string, userID string) bool {
+	if text == q.Text {
+		return false
+	}
+
+	q.Revisions = append(q.Revisions, q.Current())
+	q.Text = text
+	q.EditAt = model.GetMillis()
+	q.EditedBy = userID
+
+	return true
+}
+
+// HasTag - Is the quote tagged with tag?
+func (q *Quote) HasTag(tag string) bool {
+	idx := sort.SearchStrings(q.Tags, tag)
+
+	return idx < len(q.Tags) && q.Tags[idx] == tag
+}
+
+// Retag - Add and remove the given tags. Returns false if the tags didn't
+// change.
+func (q *Quote) Retag(add []string, remove []string) bool {
+	tags := append([]string(nil), q.Tags...)
+	for idx := range add {
+		tags = addTag(tags, add[idx])
+	}
+	for idx := range remove {
+		tags = removeTag(tags, remove[idx])
+	}
+
+	if strings.Join(tags, " ") == strings.Join(q.Tags, " ") {
+		return false
+	}
+
+	q.Tags = tags
+	if len(q.Tags) == 0 {
+		q.Tags = nil
+	}
+
+	return true
+}
+
+// IsAttributed - Have we worked out who said the quote, or tried to?
+func (q *Quote) IsAttributed() bool {
+	return len(q.Speakers) > 0 || q.AuthorReview != "" || q.AuthorSetBy != ""
+}
+
+// SetSpeakers - Set who said the quote, and why an admin should check it if
+// they should. setBy is the admin who set them by hand, if one did.
+func (q *Quote) SetSpeakers(speakers []Speaker, review string, setBy string) {
+	q.Speakers = speakers
+	if len(q.Speakers) == 0 {
+		q.Speakers = nil
+	}
+	q.Author = FormatSpeakers(speakers)
+	q.AuthorReview = review
+	q.AuthorSetBy = setBy
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewQuote - Test the NewQuote function.
+func TestNewQuote(t *testing.T) {
+	args := testCommandArgs("/quote add quote 1")
+	args.RootId = "postid"
+
+	quote := NewQuote(3, "quote 1", args)
+	assert.EqualValues(t, quote.ID, 3)
+	assert.EqualValues(t, quote.Text, "quote 1")
+	assert.EqualValues(t, quote.Author, "")
+	assert.EqualValues(t, quote.UserID, "userid")
+	assert.EqualValues(t, quote.ChannelID, "channelid")
+	assert.EqualValues(t, quote.TeamID, "teamid")
+	assert.EqualValues(t, quote.PostID, "postid")
+}
+
+// TestQuotesFromStrings - Test the QuotesFromStrings function.
+func TestQuotesFromStrings(t *testing.T) {
+	quotes := QuotesFromStrings(nil)
+	assert.EqualValues(t, len(quotes), 0)
+
+	quotes = QuotesFromStrings([]string{"quote 1", "quote 2"})
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].ID, 1)
+	assert.EqualValues(t, quotes[0].Text, "quote 1")
+	assert.EqualValues(t, quotes[1].ID, 2)
+	assert.EqualValues(t, quotes[1].Text, "quote 2")
+}
+
+// TestQuoteRevise - Test the Quote Revise, Current and Versions functions.
+func TestQuoteRevise(t *testing.T) {
+	quote := NewQuote(1, "quote 1", testCommandArgs(""))
+	versions := quote.Versions()
+	assert.EqualValues(t, len(versions), 1)
+	assert.EqualValues(t, versions[0], Revision{Text: "quote 1", UserID: "userid", CreateAt: quote.CreateAt})
+
+	assert.False(t, quote.Revise("quote 1", "editor"))
+	assert.EqualValues(t, len(quote.Revisions), 0)
+
+	assert.True(t, quote.Revise("quote one", "editor"))
+	assert.EqualValues(t, quote.Text, "quote one")
+	assert.EqualValues(t, quote.UserID, "userid")
+	assert.EqualValues(t, quote.EditedBy, "editor")
+	assert.NotEqual(t, quote.EditAt, 0)
+
+	assert.True(t, quote.Revise("quote 1", "userid"))
+	versions = quote.Versions()
+	assert.EqualValues(t, len(versions), 3)
+	assert.EqualValues(t, versions[0].Text, "quote 1")
+	assert.EqualValues(t, versions[0].UserID, "userid")
+	assert.EqualValues(t, versions[1].Text, "quote one")
+	assert.EqualValues(t, versions[1].UserID, "editor")
+	assert.EqualValues(t, versions[2].Text, "quote 1")
+	assert.EqualValues(t, versions[2].UserID, "userid")
+	assert.EqualValues(t, versions[2], quote.Current())
+}
+
+// TestQuoteRetag - Test the Quote Retag and HasTag functions.
+func TestQuoteRetag(t *testing.T) {
+	quote := NewQuote(1, "quote 1", testCommandArgs(""))
+	assert.False(t, quote.HasTag("work"))
+	assert.False(t, quote.Retag(nil, []string{"work"}))
+
+	assert.True(t, quote.Retag([]string{"work", "gus"}, nil))
+	assert.EqualValues(t, quote.Tags, []string{"gus", "work"})
+	assert.True(t, quote.HasTag("work"))
+	assert.True(t, quote.HasTag("gus"))
+	assert.False(t, quote.HasTag("math"))
+
+	assert.False(t, quote.Retag([]string{"work"}, nil))
+
+	tags := quote.Tags
+	assert.True(t, quote.Retag([]string{"math"}, []string{"gus", "work"}))
+	assert.EqualValues(t, quote.Tags, []string{"math"})
+	assert.EqualValues(t, tags, []string{"gus", "work"}) // It doesn't change the old tags.
+
+	assert.True(t, quote.Retag(nil, []string{"math"}))
+	assert.Nil(t, quote.Tags)
+}
+
+// TestQuoteSetSpeakers - Test the Quote SetSpeakers and IsAttributed
+// functions.
+func TestQuoteSetSpeakers(t *testing.T) {
+	quote := NewQuote(1, "quote 1", testCommandArgs(""))
+	assert.False(t, quote.IsAttributed())
+
+	quote.SetSpeakers(nil, "No attribution found.", "")
+	assert.True(t, quote.IsAttributed())
+	assert.Nil(t, quote.Speakers)
+	assert.EqualValues(t, quote.Author, "")
+
+	quote.SetSpeakers([]Speaker{{Name: "Gus"}, {Name: "shane", UserID: "shaneid"}}, "", "adminid")
+	assert.True(t, quote.IsAttributed())
+	assert.EqualValues(t, quote.Author, "Gus, @shane")
+	assert.EqualValues(t, quote.AuthorReview, "")
+	assert.EqualValues(t, quote.AuthorSetBy, "adminid")
+}
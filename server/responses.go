@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store key for the responses. They're kept for everyone, like
+	// they were on the old Slack server.
+	responsesKey string = "responses"
+)
+
+// Response - Something to say when someone mentions a trigger, like the
+// Slackbot responses in responses.json.
+type Response struct {
+	Trigger  string `json:"trigger"`
+	Response string `json:"response"`
+}
+
+// sameResponse - Are a and b the same response, give or take case and
+// whitespace in the trigger?
+func sameResponse(a Response, b Response) bool {
+	return strings.EqualFold(strings.TrimSpace(a.Trigger), strings.TrimSpace(b.Trigger)) &&
+		strings.TrimSpace(a.Response) == strings.TrimSpace(b.Response)
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// loadResponses - Load the responses, and their raw value for
+// compare-and-set.
+func (p *QuotebotPlugin) loadResponses() ([]Response, []byte, *model.AppError) {
+	var responses []Response
+	raw, err := p.loadJSONKey(responsesKey, &responses, "responses")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return responses, raw, nil
+}
+
+// Responses - Every response, in the order they were added.
+func (p *QuotebotPlugin) Responses() ([]Response, *model.AppError) {
+	responses, _, err := p.loadResponses()
+
+	return responses, err
+}
+
+// AddResponses - Add the responses we don't have yet. Ones without a trigger
+// or anything to say are skipped. Returns how many were added.
+func (p *QuotebotPlugin) AddResponses(newResponses []Response) (int, *model.AppError) {
+	if len(newResponses) == 0 {
+		return 0, nil
+	}
+
+	var responses []Response
+	added := 0
+	err := p.updateJSONKey(responsesKey, &responses, "responses", func() bool {
+		added = 0
+		for _, response := range newResponses {
+			if strings.TrimSpace(response.Trigger) == "" || strings.TrimSpace(response.Response) == "" {
+				continue
+			}
+
+			known := false
+			for idx := range responses {
+				if sameResponse(responses[idx], response) {
+					known = true
+					break
+				}
+			}
+			if known == false {
+				responses = append(responses, response)
+				added++
+			}
+		}
+
+		return added > 0
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAddResponses - Test the AddResponses function.
+func TestAddResponses(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	responses, err := p.Responses()
+	assert.Nil(t, err)
+	assert.Nil(t, responses)
+
+	added, err := p.AddResponses([]Response{
+		{Trigger: "dunno", Response: "Me neither."},
+		{Trigger: "wip", Response: ""},
+		{Trigger: " ", Response: "Nobody asked."},
+		{Trigger: "Dunno ", Response: "Me neither."},
+		{Trigger: "dunno", Response: "Ask Gus."},
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, added, 2)
+
+	added, err = p.AddResponses([]Response{{Trigger: "DUNNO", Response: "Ask Gus."}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, added, 0)
+
+	responses, err = p.Responses()
+	assert.Nil(t, err)
+	assert.EqualValues(t, responses, []Response{
+		{Trigger: "dunno", Response: "Me neither."},
+		{Trigger: "dunno", Response: "Ask Gus."},
+	})
+}
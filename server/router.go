@@ -0,0 +1,403 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+// permission - Who can use a subcommand.
+type permission int
+
+const (
+	permissionAnyone permission = iota // Anyone.
+	permissionOwner                    // Admins, and whoever added the quote; the subcommand checks which quote.
+	permissionAdmin                    // Admins only.
+)
+
+const (
+	// I still haven't looked into i18n.
+	helpIntro string = "Quotebot remembers quotes you tell it about, and spits them out again when you ask it to."
+)
+
+var (
+	optionalPattern = regexp.MustCompile(`\[[^\]]*\]`) // Optional arguments in a usage's syntax.
+)
+
+// usage - One way to use a subcommand: its arguments, and what it does.
+//
+// Arguments are *in italics*; optional ones are [in brackets].
+type usage struct {
+	syntax string
+	help   string
+}
+
+// subcommand - A /quote subcommand, like "add" in /quote add, and everything
+// the help, usage errors and autocomplete need to know about it.
+type subcommand struct {
+	name          string   // "" for /quote on its own, or with a quote number.
+	aliases       []string // Other names for it.
+	permission    permission
+	usages        []usage
+	hidden        bool // Left out of the help and autocomplete.
+	changesQuotes bool // Can't be used while there's damage an admin hasn't checked.
+	exclusive     bool // Nothing else runs while it does.
+	run           func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError)
+}
+
+// -----------------------------------------------------------------------------
+// Subcommands
+// -----------------------------------------------------------------------------
+
+// subcommands - Every /quote subcommand, in the order the help lists them.
+func subcommands() []subcommand {
+	return []subcommand{
+		{
+			name: "",
+			usages: []usage{
+				{"", "Regurgitate a random quote."},
+				{"*x*", "Show quote number *x*."},
+				{"*query*", "Regurgitate a random quote matching *query*, like @gus #work -#nsfw since:2024 \"primes\": " +
+					"quotes gus said, tagged #work but not #nsfw, added since 2024, with \"primes\" in them. Dates can " +
+					"be years, months like 2024-03 or days like 2024-03-15; use before:*date* for quotes added before one."},
+				{"from *name*", "Regurgitate a random quote *name* said, even if their name has spaces, like /quote from Gus M."},
+				{"--here", "Regurgitate a random quote from this channel's own quotes. Add --here to the other " +
+					"commands to use this channel's quotes too, like /quote add --here *genius quote*. Only the " +
+					"channel's members can see them."},
+			},
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				if tail == "" {
+					return p.ShowRandom(args)
+				}
+
+				return p.ShowQuote(args, tail)
+			},
+		},
+		{
+			name:          "add",
+			usages:        []usage{{"*genius quote*", "Store *genius quote* for later. Don't forget to include an attribution! If it looks a lot like a quote Quotebot already knows, use /quote add --force *genius quote* to add it anyway. Start it with hashtags to tag it, like /quote add #work #gus *genius quote*."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).AddQuote,
+		},
+		{
+			name:          "author",
+			permission:    permissionAdmin,
+			usages:        []usage{{"*x* [*who said it*]", "Say who said quote number *x*, like /quote author 3 Gus and @shane. Just /quote author *x* shows who said it."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).AuthorQuote,
+		},
+		{
+			name:          "authors",
+			permission:    permissionAdmin,
+			usages:        []usage{{"", "List the quotes Quotebot isn't sure who said."}},
+			changesQuotes: true, // It works out who said quotes before listing them.
+			run:           (*QuotebotPlugin).ShowAuthors,
+		},
+		{
+			name:       "channel",
+			permission: permissionAdmin,
+			usages:     []usage{{"*x*", "Monitor channel *x* for activity and randomly show quotes there. Use /quote channel --here *x* to show *x*'s own quotes instead of the team's."}},
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				return p.SetChannel(tail, args.TeamId)
+			},
+		},
+		{
+			name:       "damage",
+			permission: permissionAdmin,
+			usages: []usage{
+				{"", "List the damaged quotes Quotebot found when it started. Quotebot won't change any quotes until you've checked them."},
+				{"ok", "Say you've checked the damaged quotes, so Quotebot can change quotes again."},
+			},
+			exclusive: true, // It changes whether anything else can change anything.
+			run:       (*QuotebotPlugin).ShowDamage,
+		},
+		{
+			name:   "debug", // TODO: DELETE ME WHEN DONE.
+			hidden: true,
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				p.PostRandom()
+				return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "PostRandom() is done."), nil
+			},
+		},
+		{
+			name:          "delete",
+			permission:    permissionAdmin,
+			usages:        []usage{{"*x*", "Move quote number *x* to the trash."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).DeleteQuote,
+		},
+		{
+			name:          "edit",
+			permission:    permissionOwner,
+			usages:        []usage{{"*x* *new text*", "Change quote number *x* to *new text*. Only admins and whoever added the quote can edit it."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).EditQuote,
+		},
+		{
+			name:       "export",
+			permission: permissionAdmin,
+			usages:     []usage{{"[*format*]", "Send yourself every quote, with everything Quotebot knows about them, as a json (the default), csv or md file."}},
+			run:        (*QuotebotPlugin).ExportQuotes,
+		},
+		{
+			name:    "help",
+			aliases: []string{"?"},
+			usages:  []usage{{"", "Show the help."}},
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				return p.ShowHelp(args.UserId)
+			},
+		},
+		{
+			name:   "history",
+			usages: []usage{{"*x*", "Show every version of quote number *x*."}},
+			run:    (*QuotebotPlugin).ShowHistory,
+		},
+		{
+			name:       "import",
+			permission: permissionAdmin,
+			usages: []usage{{"[*post link*]", "Add the quotes in the files attached to a post: JSON lists like quotes.json, " +
+				"exports, or text with one quote per line. Quotes Quotebot already knows are skipped, and an export " +
+				"imported into an empty collection comes back exactly. Responses, like the ones in responses.json, are " +
+				"kept too. Reply to the post with /quote import to leave out the link."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).ImportQuotes,
+		},
+		{
+			name:   "info",
+			usages: []usage{{"", "Show the number of quotes, the channel, and the interval."}},
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				return p.ShowInfo(args)
+			},
+		},
+		{
+			name:       "interval",
+			permission: permissionAdmin,
+			usages:     []usage{{"*x*", "The time between automatically posting quotes in a channel."}},
+			run: func(p *QuotebotPlugin, args *model.CommandArgs, tail string) (*model.CommandResponse, *model.AppError) {
+				return p.SetInterval(tail)
+			},
+		},
+		{
+			name: "list",
+			usages: []usage{{"[page *n*] [--author *who*] [--contains *words*] [--sort newest|oldest] [*query*]",
+				"List the quotes, a page at a time. --author lists the ones someone said, --contains the ones " +
+					"with *words* in them, *query* the ones matching it, and --sort newest shows the newest first. " +
+					"Put quotes around values with spaces, like --contains \"so long\"."}},
+			run: (*QuotebotPlugin).ListQuotes,
+		},
+		{
+			name:       "reindex",
+			permission: permissionAdmin,
+			usages:     []usage{{"", "Rebuild the search index, if searches are missing quotes or failing."}},
+			run:        (*QuotebotPlugin).ReindexQuotes,
+		},
+		{
+			name:          "restore",
+			permission:    permissionAdmin,
+			usages:        []usage{{"*x*", "Bring quote number *x* back from the trash."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).RestoreQuote,
+		},
+		{
+			name:          "revert",
+			permission:    permissionOwner,
+			usages:        []usage{{"*x* *version*", "Change quote number *x* back to an earlier version from its history."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).RevertQuote,
+		},
+		{
+			name:       "rollback",
+			permission: permissionAdmin,
+			usages:     []usage{{"*name*", "Put all the quotes and settings back the way they were in snapshot *name*."}},
+			exclusive:  true, // It changes everything.
+			run:        (*QuotebotPlugin).RollbackSnapshot,
+		},
+		{
+			name:    "search",
+			aliases: []string{"find"},
+			usages:  []usage{{"*some words*", "Show the quotes that best match *some words*, with their numbers."}},
+			run:     (*QuotebotPlugin).SearchQuotes,
+		},
+		{
+			name:       "snapshot",
+			permission: permissionAdmin,
+			usages:     []usage{{"[*name*]", "Save a copy of all the quotes and settings as snapshot *name*. Quotebot takes one itself before deleting a quote, purging the trash, restoring an export, moving the shared quotes to a team, or rolling back."}},
+			run:        (*QuotebotPlugin).SaveSnapshot,
+		},
+		{
+			name:       "snapshots",
+			permission: permissionAdmin,
+			usages:     []usage{{"", "List the snapshots."}},
+			run:        (*QuotebotPlugin).ShowSnapshots,
+		},
+		{
+			name:          "tag",
+			permission:    permissionOwner,
+			usages:        []usage{{"*x* [+*tag*] [-*tag*]", "Tag quote number *x* with one tag and untag it with another. Only admins and whoever added the quote can tag it. Just /quote tag *x* shows its tags."}},
+			changesQuotes: true,
+			run:           (*QuotebotPlugin).TagQuote,
+		},
+		{
+			name:   "tags",
+			usages: []usage{{"", "Show the tags, and how many quotes have each one."}},
+			run:    (*QuotebotPlugin).ShowTags,
+		},
+		{
+			name:       "trash",
+			permission: permissionAdmin,
+			usages:     []usage{{"", "List the quotes in the trash."}},
+			run:        (*QuotebotPlugin).ShowTrash,
+		},
+	}
+}
+
+// findSubcommand - The subcommand with the given name or alias, or nil if
+// there isn't one.
+func findSubcommand(name string) *subcommand {
+	name = strings.ToLower(name)
+	commands := subcommands()
+	for idx := range commands {
+		if commands[idx].name == name {
+			return &commands[idx]
+		}
+		for _, alias := range commands[idx].aliases {
+			if alias == name {
+				return &commands[idx]
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseCommand - Split a /quote command into its subcommand and the rest of
+// it, the tail. Anything that isn't a subcommand is the tail of /quote on its
+// own, like /quote 3. Returns nil if it isn't a /quote command at all.
+func parseCommand(command string) (*subcommand, string) {
+	command = strings.TrimSpace(command)
+	if len(command) < len(slashTrigger) || strings.EqualFold(command[:len(slashTrigger)], slashTrigger) == false {
+		return nil, ""
+	}
+	rest := command[len(slashTrigger):]
+	if rest != "" && unicode.IsSpace([]rune(rest)[0]) == false {
+		// Like /quotes.
+		return nil, ""
+	}
+	rest = strings.TrimSpace(rest)
+
+	name := rest
+	tail := ""
+	if idx := strings.IndexFunc(rest, unicode.IsSpace); idx >= 0 {
+		name = rest[:idx]
+		tail = strings.TrimSpace(rest[idx:])
+	}
+	if name != "" {
+		found := findSubcommand(name)
+		if found != nil {
+			return found, tail
+		}
+	}
+
+	return findSubcommand(""), rest
+}
+
+// invocation - How to use the subcommand one way, like "/quote edit *x* *new
+// text*".
+func (c *subcommand) invocation(u usage) string {
+	return strings.Join(strings.Fields(strings.Join([]string{slashTrigger, c.name, u.syntax}, " ")), " ")
+}
+
+// describe - A bullet list item for each way to use the subcommand.
+func (c *subcommand) describe() []string {
+	lines := make([]string, 0, len(c.usages))
+	for _, u := range c.usages {
+		lines = append(lines, fmt.Sprintf("* %s - %s", c.invocation(u), u.help))
+	}
+	for _, alias := range c.aliases {
+		lines[0] += fmt.Sprintf(" %s %s works too.", slashTrigger, alias)
+	}
+
+	return lines
+}
+
+// usageText - How to use the subcommand, for when someone gets it wrong.
+func (c *subcommand) usageText() string {
+	lines := c.describe()
+	if len(lines) == 1 {
+		return "Usage: " + strings.TrimPrefix(lines[0], "* ")
+	}
+
+	return "Usage:\n" + strings.Join(lines, "\n")
+}
+
+// needsArguments - Does every way of using the subcommand need an argument?
+func (c *subcommand) needsArguments() bool {
+	for _, u := range c.usages {
+		if strings.Contains(optionalPattern.ReplaceAllString(u.syntax, ""), "*") == false {
+			return false
+		}
+	}
+
+	return len(c.usages) > 0
+}
+
+// missingArguments - Does the subcommand need arguments that tail doesn't
+// have? Flags like --here don't count.
+func (c *subcommand) missingArguments(tail string) bool {
+	for _, word := range strings.Fields(tail) {
+		if strings.HasPrefix(word, "--") == false {
+			return false
+		}
+	}
+
+	return c.needsArguments()
+}
+
+// -----------------------------------------------------------------------------
+// Help
+// -----------------------------------------------------------------------------
+
+// helpText - The help for everyone: what Quotebot is, and the subcommands
+// anyone can use.
+func helpText() string {
+	lines := []string{helpIntro, "", "Commands:", ""}
+	for _, command := range subcommands() {
+		if command.hidden == false && command.permission != permissionAdmin {
+			lines = append(lines, command.describe()...)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// adminHelpText - The help for the subcommands only admins can use.
+func adminHelpText() string {
+	lines := []string{"Admin commands:", ""}
+	for _, command := range subcommands() {
+		if command.hidden == false && command.permission == permissionAdmin {
+			lines = append(lines, command.describe()...)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// autocompleteHint - The hint after /quote when it's autocompleted: the
+// subcommands anyone can use.
+func autocompleteHint() string {
+	hints := []string{"*x*", "*query*"}
+	for _, command := range subcommands() {
+		if command.name != "" && command.hidden == false && command.permission != permissionAdmin {
+			hints = append(hints, command.name)
+		}
+	}
+
+	return "[" + strings.Join(hints, " | ") + "]"
+}
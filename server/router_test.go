@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseCommand - Make sure commands find their subcommand and tail.
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		name    string
+		tail    string
+	}{
+		// Regular commands.
+		{"/quote", "", ""},
+		{"/quote 1", "", "1"},
+		{"/quote #work", "", "#work"},
+		{"/quote add", "add", ""},
+		{"/quote add Some genius quote.", "add", "Some genius quote."},
+		{"/QUOTE ADD  Some genius quote. ", "add", "Some genius quote."},
+		{"/quote tags", "tags", ""},
+		{"/quote tag 1 +work", "tag", "1 +work"},
+		{"/quote help", "help", ""},
+		{"/quote ?", "help", ""},
+		{"/quote find primes", "search", "primes"},
+		{"/quote added", "", "added"},
+
+		// Admin commands.
+		{"/quote list", "list", ""},
+		{"/quote delete", "delete", ""},
+		{"/quote delete 1", "delete", "1"},
+	}
+	for _, test := range tests {
+		command, tail := parseCommand(test.command)
+		if assert.NotNil(t, command, test.command) {
+			assert.EqualValues(t, command.name, test.name, test.command)
+			assert.EqualValues(t, tail, test.tail, test.command)
+		}
+	}
+
+	// Not for us.
+	command, _ := parseCommand("/quotes")
+	assert.Nil(t, command)
+	command, _ = parseCommand("/echo quote")
+	assert.Nil(t, command)
+}
+
+// TestSubcommands - Every subcommand has a name of its own, and says how to
+// use it.
+func TestSubcommands(t *testing.T) {
+	names := make(map[string]bool)
+	for _, command := range subcommands() {
+		for _, name := range append([]string{command.name}, command.aliases...) {
+			assert.False(t, names[name], name)
+			names[name] = true
+		}
+
+		assert.NotNil(t, command.run, command.name)
+		if command.hidden == false {
+			assert.NotEmpty(t, command.usages, command.name)
+		}
+	}
+}
+
+// TestMissingArguments - Commands that need arguments get their usage
+// instead.
+func TestMissingArguments(t *testing.T) {
+	assert.True(t, findSubcommand("delete").missingArguments(""))
+	assert.True(t, findSubcommand("delete").missingArguments("--here"))
+	assert.False(t, findSubcommand("delete").missingArguments("1"))
+	assert.False(t, findSubcommand("export").missingArguments(""))
+	assert.False(t, findSubcommand("damage").missingArguments(""))
+	assert.False(t, findSubcommand("").missingArguments(""))
+
+	assert.EqualValues(t, findSubcommand("delete").usageText(), "Usage: /quote delete *x* - Move quote number *x* to the trash.")
+	assert.True(t, strings.HasPrefix(findSubcommand("damage").usageText(), "Usage:\n* /quote damage - "))
+}
+
+// TestHelpText - The help is made from the subcommands.
+func TestHelpText(t *testing.T) {
+	help := helpText()
+	assert.True(t, strings.HasPrefix(help, helpIntro+"\n\nCommands:\n\n* /quote - "))
+	assert.True(t, strings.Contains(help, "\n* /quote add *genius quote* - "))
+	assert.False(t, strings.Contains(help, "/quote delete"))
+	assert.False(t, strings.Contains(help, "/quote debug"))
+	assert.True(t, strings.Contains(help, "\n* /quote help - Show the help. /quote ? works too.\n"))
+
+	adminHelp := adminHelpText()
+	assert.True(t, strings.HasPrefix(adminHelp, "Admin commands:\n\n* /quote author *x* [*who said it*] - "))
+	assert.True(t, strings.Contains(adminHelp, "\n* /quote delete *x* - "))
+	assert.False(t, strings.Contains(adminHelp, "/quote add"))
+
+	assert.EqualValues(t, autocompleteHint(), "[*x* | *query* | add | edit | help | history | info | list | revert | search | tag | tags]")
+}
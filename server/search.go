@@ -0,0 +1,215 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	searchResultLimit int = 10 // The most quotes a search shows.
+
+	// Search terms at least this long also match words they're the start of,
+	// so "prime" finds "primes".
+	searchPrefixMinLength int = 3
+
+	// How much a prefix match counts for, compared to matching a whole word.
+	searchPrefixWeight float64 = 0.5
+)
+
+// -----------------------------------------------------------------------------
+// Search
+// -----------------------------------------------------------------------------
+
+// SearchResult - A quote that matched a search, and how well.
+type SearchResult struct {
+	Quote   Quote
+	Matched int     // How many of the search terms it matched.
+	Score   float64 // How relevant it is; higher is better.
+	Words   int     // How many words the quote has.
+}
+
+// searchToken - A word in a quote, and where it is in the quote's text.
+type searchToken struct {
+	word  string // Lowercase, without punctuation.
+	start int    // Byte offsets of the word in the text.
+	end   int
+}
+
+// isWordJoiner - Is r punctuation that belongs inside a word, like the
+// apostrophe in "don't"?
+func isWordJoiner(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+// searchTokens - Split text into lowercase words, ignoring punctuation.
+func searchTokens(text string) []searchToken {
+	var tokens []searchToken
+	var word []rune
+	start := -1
+	end := 0
+	for idx, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = idx
+			}
+			word = append(word, unicode.ToLower(r))
+			end = idx + len(string(r))
+		case start >= 0 && isWordJoiner(r):
+			// Part of the word, but not something anyone searches for.
+		default:
+			if start >= 0 {
+				tokens = append(tokens, searchToken{word: string(word), start: start, end: end})
+			}
+			word = word[:0]
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{word: string(word), start: start, end: end})
+	}
+
+	return tokens
+}
+
+// SearchTerms - The distinct words in a search, lowercase and without
+// punctuation.
+func SearchTerms(search string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, token := range searchTokens(search) {
+		if seen[token.word] {
+			continue
+		}
+
+		seen[token.word] = true
+		terms = append(terms, token.word)
+	}
+
+	return terms
+}
+
+// termWeight - How well word matches term: 1 for the same word, less if term
+// is the start of it, 0 if it doesn't match at all.
+func termWeight(term string, word string) float64 {
+	if word == term {
+		return 1
+	}
+	if utf8.RuneCountInString(term) >= searchPrefixMinLength && strings.HasPrefix(word, term) {
+		return searchPrefixWeight
+	}
+
+	return 0
+}
+
+// matchedTerms - How many of terms match words in text.
+func matchedTerms(text string, terms []string) int {
+	tokens := searchTokens(text)
+	matched := 0
+	for _, term := range terms {
+		for _, token := range tokens {
+			if termWeight(term, token.word) > 0 {
+				matched++
+				break
+			}
+		}
+	}
+
+	return matched
+}
+
+// FindQuotes - Find the quotes matching terms, best first.
+//
+// Quotes matching more of the terms come first. After that, matches on rare
+// words count for more than matches on common ones, whole words count for
+// more than the starts of words, and shorter quotes win ties.
+func FindQuotes(quotes []Quote, terms []string) []SearchResult {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// How well each quote matches each term.
+	weights := make([][]float64, len(quotes))
+	words := make([]int, len(quotes))
+	found := make([]int, len(terms)) // How many quotes match each term.
+	for idx := range quotes {
+		tokens := searchTokens(quotes[idx].Text)
+		words[idx] = len(tokens)
+		weights[idx] = make([]float64, len(terms))
+		for termIdx, term := range terms {
+			for _, token := range tokens {
+				weights[idx][termIdx] = math.Max(weights[idx][termIdx], termWeight(term, token.word))
+			}
+			if weights[idx][termIdx] > 0 {
+				found[termIdx]++
+			}
+		}
+	}
+
+	var results []SearchResult
+	for idx := range quotes {
+		result := SearchResult{Quote: quotes[idx], Words: words[idx]}
+		for termIdx := range terms {
+			if weights[idx][termIdx] == 0 {
+				continue
+			}
+
+			rarity := math.Log(1 + float64(len(quotes))/float64(found[termIdx]))
+			result.Matched++
+			result.Score += weights[idx][termIdx] * rarity
+		}
+
+		if result.Matched > 0 {
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i int, j int) bool {
+		if results[i].Matched != results[j].Matched {
+			return results[i].Matched > results[j].Matched
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Words < results[j].Words
+	})
+
+	return results
+}
+
+// markdownEscaper - Backslash-escape the characters that change how text looks
+// in Markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`~`, `\~`,
+	`[`, `\[`,
+	`]`, `\]`,
+)
+
+// HighlightTerms - Put the words in text that match terms in bold. The text is
+// escaped first, so its own *s and _s can't get mixed up with the bold ones.
+func HighlightTerms(text string, terms []string) string {
+	highlighted := ""
+	last := 0
+	for _, token := range searchTokens(text) {
+		for _, term := range terms {
+			if termWeight(term, token.word) > 0 {
+				highlighted += markdownEscaper.Replace(text[last:token.start]) + "**" + markdownEscaper.Replace(text[token.start:token.end]) + "**"
+				last = token.end
+				break
+			}
+		}
+	}
+
+	return highlighted + markdownEscaper.Replace(text[last:])
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSearchTerms - Test the SearchTerms function.
+func TestSearchTerms(t *testing.T) {
+	assert.Nil(t, SearchTerms(""))
+	assert.Nil(t, SearchTerms(" ?! "))
+	assert.EqualValues(t, SearchTerms("Primes, PRIMES and primes!"), []string{"primes", "and"})
+	assert.EqualValues(t, SearchTerms("Don’t panic"), []string{"dont", "panic"})
+	assert.EqualValues(t, SearchTerms("'quoted'"), []string{"quoted"})
+}
+
+// TestFindQuotes - Test the FindQuotes function.
+func TestFindQuotes(t *testing.T) {
+	quotes := []Quote{
+		{ID: 1, Text: "There's lots of primes! - Gus"},
+		{ID: 2, Text: "I don't like primes, or lots of anything."},
+		{ID: 3, Text: "Nothing to see here."},
+		{ID: 4, Text: "Prime time."},
+		{ID: 5, Text: "Lots and lots and lots."},
+	}
+
+	assert.Nil(t, FindQuotes(quotes, nil))
+	assert.Nil(t, FindQuotes(quotes, SearchTerms("banana")))
+
+	// Matching more terms beats matching fewer.
+	results := FindQuotes(quotes, SearchTerms("LOTS of primes"))
+	assert.EqualValues(t, len(results), 3)
+	assert.EqualValues(t, results[0].Quote.ID, 1) // Shorter than 2.
+	assert.EqualValues(t, results[0].Matched, 3)
+	assert.EqualValues(t, results[1].Quote.ID, 2)
+	assert.EqualValues(t, results[2].Quote.ID, 5)
+	assert.EqualValues(t, results[2].Matched, 1)
+
+	// Rare words beat common ones.
+	results = FindQuotes(quotes, SearchTerms("lots nothing"))
+	assert.EqualValues(t, len(results), 4)
+	assert.EqualValues(t, results[0].Quote.ID, 3)
+
+	// Whole words beat the start of a word.
+	results = FindQuotes(quotes, SearchTerms("prime"))
+	assert.EqualValues(t, len(results), 3)
+	assert.EqualValues(t, results[0].Quote.ID, 4)
+
+	// Short terms only match whole words.
+	results = FindQuotes(quotes, SearchTerms("no"))
+	assert.Nil(t, results)
+
+	results = FindQuotes(quotes, SearchTerms("dont"))
+	assert.EqualValues(t, len(results), 1)
+	assert.EqualValues(t, results[0].Quote.ID, 2)
+}
+
+// TestHighlightTerms - Test the HighlightTerms function.
+func TestHighlightTerms(t *testing.T) {
+	assert.EqualValues(t, HighlightTerms("", []string{"primes"}), "")
+	assert.EqualValues(t, HighlightTerms("There's lots of primes! - Gus", nil), "There's lots of primes! - Gus")
+	assert.EqualValues(t, HighlightTerms("There's lots of primes! - Gus", SearchTerms("prime gus")),
+		"There's lots of **primes**! - **Gus**")
+	assert.EqualValues(t, HighlightTerms("I don’t know.", SearchTerms("dont")), "I **don’t** know.")
+
+	// Markdown in the quote stays as it was typed.
+	assert.EqualValues(t, HighlightTerms("It's *so* hot_dog ~~ [link] `code` \\o/", SearchTerms("so")),
+		"It's \\***so**\\* hot\\_dog \\~\\~ \\[link\\] \\`code\\` \\\\o/")
+	assert.EqualValues(t, HighlightTerms("**Primes** are odd", SearchTerms("odd")), "\\*\\*Primes\\*\\* are **odd**")
+}
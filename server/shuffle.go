@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store keys for each channel's shuffle bags, followed by the
+	// channel ID.
+	shuffleKeyPrefix string = "shuffle_"
+
+	// How many bags for queries a channel keeps; the ones used longest ago
+	// are thrown away first. Bags for all of a collection's quotes are
+	// always kept.
+	maxShuffleQueries int = 20
+)
+
+// shuffleBag - The order a channel sees some quotes in: a collection's, or
+// the ones matching a query. Every one comes up once before any of them come
+// up again.
+type shuffleBag struct {
+	Left   []int `json:"left"`              // IDs still to come this time around, in order.
+	Shown  []int `json:"shown"`             // IDs already shown this time around, the latest last.
+	UsedAt int64 `json:"used_at,omitempty"` // For query bags, when one was last picked, in milliseconds since the epoch.
+}
+
+// shuffleKey - The key-value store key for a channel's shuffle bags.
+func shuffleKey(channelID string) string {
+	return shuffleKeyPrefix + channelID
+}
+
+// shuffleBagName - The name of the bag for a collection's quotes matching the
+// query. Queries get bags of their own, so going through the ones that match
+// doesn't start the collection's bag over.
+func shuffleBagName(collection string, query *Query) string {
+	if query.Empty() {
+		return collection
+	}
+
+	return collection + " " + query.String()
+}
+
+// -----------------------------------------------------------------------------
+// Shuffle bags
+// -----------------------------------------------------------------------------
+
+// refresh - Bring the bag up to date with the quotes there are now. Deleted
+// quotes are dropped, and new ones go somewhere random in what's left, so
+// they come up this time around.
+func (b *shuffleBag) refresh(ids []int) {
+	current := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		current[id] = true
+	}
+
+	known := make(map[int]bool, len(b.Left)+len(b.Shown))
+	keep := func(bagIDs []int) []int {
+		kept := make([]int, 0, len(bagIDs))
+		for _, id := range bagIDs {
+			if current[id] && known[id] == false {
+				kept = append(kept, id)
+				known[id] = true
+			}
+		}
+
+		return kept
+	}
+	b.Left = keep(b.Left)
+	b.Shown = keep(b.Shown)
+
+	for _, id := range ids {
+		if known[id] {
+			continue
+		}
+
+		at := rand.Intn(len(b.Left) + 1)
+		b.Left = append(b.Left, 0)
+		copy(b.Left[at+1:], b.Left[at:])
+		b.Left[at] = id
+	}
+}
+
+// startOver - Put the quotes that have been shown back in the bag, shuffled.
+// The last one shown doesn't come up again right away if there's anything
+// else.
+func (b *shuffleBag) startOver() {
+	if len(b.Shown) == 0 {
+		return
+	}
+
+	last := b.Shown[len(b.Shown)-1]
+	shuffled := make([]int, len(b.Shown))
+	copy(shuffled, b.Shown)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	if len(shuffled) > 1 && shuffled[0] == last {
+		swap := 1 + rand.Intn(len(shuffled)-1)
+		shuffled[0], shuffled[swap] = shuffled[swap], shuffled[0]
+	}
+
+	b.Left = shuffled
+	b.Shown = nil
+}
+
+// next - Take the next ID out of the bag, starting over if they've all been
+// shown. Returns false if the bag is empty.
+func (b *shuffleBag) next() (int, bool) {
+	if len(b.Left) == 0 {
+		b.startOver()
+	}
+	if len(b.Left) == 0 {
+		return 0, false
+	}
+
+	id := b.Left[0]
+	b.Left = b.Left[1:]
+	b.Shown = append(b.Shown, id)
+
+	return id, true
+}
+
+// forgetOldQueries - Throw away the query bags used longest ago, so there are
+// at most maxShuffleQueries of them.
+func forgetOldQueries(bags map[string]shuffleBag) {
+	var queries []string
+	for name := range bags {
+		if bags[name].UsedAt != 0 {
+			queries = append(queries, name)
+		}
+	}
+	if len(queries) <= maxShuffleQueries {
+		return
+	}
+
+	sort.Slice(queries, func(i int, j int) bool {
+		return bags[queries[i]].UsedAt < bags[queries[j]].UsedAt
+	})
+	for _, name := range queries[:len(queries)-maxShuffleQueries] {
+		delete(bags, name)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// loadShuffleBags - Load a channel's shuffle bags, by name, and
+// their raw value for compare-and-set. Damaged bags are thrown away; they're
+// only there to keep quotes from repeating.
+func (p *QuotebotPlugin) loadShuffleBags(channelID string) (map[string]shuffleBag, []byte, *model.AppError) {
+	raw, err := p.API.KVGet(shuffleKey(channelID))
+	if err != nil {
+		return nil, nil, p.NewError("Unable to load the shuffled quotes.", "API.KVGet() failed.", "loadShuffleBags")
+	}
+
+	bags := make(map[string]shuffleBag)
+	if raw == nil {
+		return bags, nil, nil
+	}
+
+	loadErr := json.Unmarshal(raw, &bags)
+	if loadErr != nil {
+		p.API.LogWarn("Starting the shuffled quotes over.", "error", fmt.Sprintf("json.Unmarshal(%q) failed.", raw))
+		bags = make(map[string]shuffleBag)
+	}
+
+	return bags, raw, nil
+}
+
+// ShuffledQuote - Pick the next quote matching the query from the channel's
+// shuffle bag for the store and query, or nil if there aren't any. Every
+// matching quote comes up once before any of them come up again, even across
+// restarts.
+//
+// Stores that aren't one of our collections have no bag, so their quotes are
+// just picked at random.
+func (p *QuotebotPlugin) ShuffledQuote(channelID string, store QuoteStore, query *Query) (*Quote, *model.AppError) {
+	name, ok := p.collectionName(store)
+	if ok == false || channelID == "" {
+		return p.RandomMatchingQuote(store, query)
+	}
+
+	for try := 0; try < maxCompareAndSetTries; try++ {
+		bags, oldRaw, err := p.loadShuffleBags(channelID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only load every quote if we have to look inside them.
+		var ids []int
+		quotes := make(map[int]*Quote)
+		if query.Empty() {
+			ids, err = store.IDs()
+		} else {
+			var list []Quote
+			list, err = store.List()
+			for idx := range list {
+				if query.Matches(&list[idx]) {
+					ids = append(ids, list[idx].ID)
+					quotes[list[idx].ID] = &list[idx]
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bagName := shuffleBagName(name, query)
+		bag := bags[bagName]
+		bag.refresh(ids)
+		id, found := bag.next()
+		if found == false {
+			return nil, nil
+		}
+		if query.Empty() == false {
+			bag.UsedAt = model.GetMillis()
+		}
+		bags[bagName] = bag
+		forgetOldQueries(bags)
+
+		newRaw, jsonErr := json.Marshal(bags)
+		if jsonErr != nil {
+			return nil, p.NewError("Unable to save the shuffled quotes.", fmt.Sprintf("json.Marshal(%v) failed.", bags), "ShuffledQuote")
+		}
+		saved, err := p.API.KVCompareAndSet(shuffleKey(channelID), oldRaw, newRaw)
+		if err != nil {
+			return nil, err
+		}
+		if saved == false {
+			continue
+		}
+
+		if quotes[id] != nil {
+			return quotes[id], nil
+		}
+		quote, err := store.Get(id)
+		if err != nil || quote != nil {
+			return quote, err
+		}
+		// Deleted since we looked; try the next one.
+	}
+
+	return nil, p.NewError("Unable to save the shuffled quotes.", "Too many concurrent changes to the shuffled quotes.", "ShuffledQuote")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestShuffleBag - Every ID comes up once before any come up again.
+func TestShuffleBag(t *testing.T) {
+	bag := shuffleBag{}
+	bag.refresh([]int{1, 2, 3, 4, 5})
+	seen := make(map[int]bool)
+	last := 0
+	for idx := 0; idx < 5; idx++ {
+		id, ok := bag.next()
+		assert.True(t, ok)
+		assert.False(t, seen[id], "%d came up twice", id)
+		seen[id] = true
+		last = id
+	}
+	assert.EqualValues(t, len(bag.Left), 0)
+
+	// Starting over doesn't repeat the last one right away.
+	id, ok := bag.next()
+	assert.True(t, ok)
+	assert.NotEqual(t, id, last)
+	assert.EqualValues(t, len(bag.Left), 4)
+
+	// Deleted IDs are dropped, and new ones come up this time around.
+	bag.refresh([]int{1, 2, 3, 4, 6})
+	assert.EqualValues(t, len(bag.Left)+len(bag.Shown), 5)
+	seen = make(map[int]bool)
+	for len(bag.Left) > 0 {
+		id, _ = bag.next()
+		seen[id] = true
+	}
+	assert.True(t, seen[6])
+	assert.NotContains(t, bag.Shown, 5)
+
+	bag = shuffleBag{}
+	_, ok = bag.next()
+	assert.False(t, ok)
+}
+
+// TestForgetOldQueries - Only the newest query bags are kept.
+func TestForgetOldQueries(t *testing.T) {
+	bags := map[string]shuffleBag{"team_teamid": {Left: []int{1}}}
+	for idx := 1; idx <= maxShuffleQueries+2; idx++ {
+		bags[fmt.Sprintf("team_teamid #tag%d", idx)] = shuffleBag{UsedAt: int64(idx)}
+	}
+
+	forgetOldQueries(bags)
+	assert.EqualValues(t, len(bags), maxShuffleQueries+1)
+	assert.Contains(t, bags, "team_teamid")
+	assert.NotContains(t, bags, "team_teamid #tag1")
+	assert.NotContains(t, bags, "team_teamid #tag2")
+	assert.Contains(t, bags, "team_teamid #tag3")
+}
+
+// TestShuffledQuote - Shuffle bags are kept for each channel and survive
+// restarts.
+func TestShuffledQuote(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+	assert.Nil(t, p.OnActivate())
+	store := NewMemoryQuoteStore()
+	setTestStore(p, "teamid", store)
+	for idx := 1; idx <= 4; idx++ {
+		store.Add(Quote{Text: fmt.Sprintf("quote %d", idx)})
+	}
+
+	seen := make(map[int]bool)
+	for idx := 0; idx < 2; idx++ {
+		quote, err := p.ShuffledQuote("channelid", store, nil)
+		assert.Nil(t, err)
+		assert.False(t, seen[quote.ID], "%d came up twice", quote.ID)
+		seen[quote.ID] = true
+	}
+
+	// Another channel has its own bag.
+	other, err := p.ShuffledQuote("otherchannelid", store, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, other)
+
+	// After a restart, the channel picks up where it left off, including the
+	// quote added since.
+	store.Add(Quote{Text: "quote 5"})
+	restarted := initTestPlugin(t, "normal", "mock")
+	restarted.SetAPI(p.API)
+	setTestStore(restarted, "teamid", store)
+	for idx := 0; idx < 3; idx++ {
+		quote, err := restarted.ShuffledQuote("channelid", store, nil)
+		assert.Nil(t, err)
+		assert.False(t, seen[quote.ID], "%d came up twice", quote.ID)
+		seen[quote.ID] = true
+	}
+	assert.EqualValues(t, len(seen), 5)
+
+	// Queries only pick from the quotes that match.
+	query, _ := ParseQuery(`"quote 3"`)
+	for idx := 0; idx < 3; idx++ {
+		quote, err := restarted.ShuffledQuote("channelid", store, query)
+		assert.Nil(t, err)
+		assert.EqualValues(t, quote.Text, "quote 3")
+	}
+
+	// Going round a query's quotes doesn't start the channel's bag over: the
+	// old quotes have all been shown, so only the new ones are left in it.
+	for idx := 1; idx <= 5; idx++ {
+		store.Add(Quote{Text: fmt.Sprintf("fresh %d", idx)})
+	}
+	seen = make(map[int]bool)
+	first, _ := ParseQuery(`"quote 1"`)
+	for idx := 0; idx < 5; idx++ {
+		quote, err := restarted.ShuffledQuote("channelid", store, nil)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(quote.Text, "fresh "), quote.Text)
+		assert.False(t, seen[quote.ID], "%d came up twice", quote.ID)
+		seen[quote.ID] = true
+
+		for pick := 0; pick < 2; pick++ {
+			quote, err = restarted.ShuffledQuote("channelid", store, first)
+			assert.Nil(t, err)
+			assert.EqualValues(t, quote.Text, "quote 1")
+		}
+	}
+
+	// Stores that aren't collections are just random.
+	loose := NewMemoryQuoteStore()
+	loose.Add(Quote{Text: "loose"})
+	quote, err := p.ShuffledQuote("channelid", loose, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.Text, "loose")
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store keys for snapshots. Each snapshot's settings live under
+	// snapshotKeyPrefix and its name, its values in chunks under that plus
+	// "/" and the chunk number, and snapshotsKey lists them. Snapshots don't
+	// include each other.
+	snapshotKeyPrefix string = "snapshot_"
+	snapshotsKey      string = "snapshots"
+
+	snapshotNameMaxLength int = 32          // Keys can only be 50 characters long.
+	snapshotListSize      int = 1000        // Keys per page when listing the key-value store.
+	snapshotChunkSize     int = 1024 * 1024 // Roughly how many bytes of values go in each chunk.
+
+	// Automatic snapshots, taken before destructive commands, are named
+	// automaticSnapshotPrefix, when they were taken, and a random number. We
+	// only keep the newest maxAutomaticSnapshots of them.
+	automaticSnapshotPrefix string = "auto-"
+	maxAutomaticSnapshots   int    = 10
+)
+
+var (
+	// A snapshot's name: lowercase letters, numbers, ".", "-" and "_".
+	snapshotNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+)
+
+// SnapshotInfo - What's in the list of snapshots about one of them.
+type SnapshotInfo struct {
+	Name     string `json:"name"`
+	CreateAt int64  `json:"create_at"`        // In milliseconds since the epoch.
+	UserID   string `json:"user_id"`          // User ID of the admin who took it, or whose command did; empty if Quotebot took it by itself.
+	Reason   string `json:"reason,omitempty"` // For automatic snapshots, what was about to happen.
+	Keys     int    `json:"keys"`             // How many key-value store keys it has.
+}
+
+// snapshot - What's under a snapshot's own key: the settings commands change,
+// and how to find the rest. The rest is every value in the key-value store
+// except the snapshots, the damaged values and the word indexes, in chunks of
+// about snapshotChunkSize bytes, so no one value grows with the quotes.
+type snapshot struct {
+	Settings      snapshotSettings `json:"settings"`
+	SchemaVersion int              `json:"schema_version"` // The schema version of its values.
+	Chunks        int              `json:"chunks"`         // How many chunks its values are in.
+
+	// Snapshots from older versions of Quotebot have their values right here
+	// instead of in chunks, word indexes and all.
+	Data map[string][]byte `json:"data,omitempty"`
+}
+
+// snapshotSettings - The settings /quote channel and /quote interval change,
+// which aren't in the key-value store.
+type snapshotSettings struct {
+	PostDelta         float64 `json:"post_delta"`
+	PostChannel       string  `json:"post_channel"`
+	PostChannelQuotes bool    `json:"post_channel_quotes"`
+	ChannelID         string  `json:"channel_id"`
+	TeamID            string  `json:"team_id"`
+}
+
+// isSnapshotKey - Is key one of the snapshot keys, which snapshots leave
+// alone?
+func isSnapshotKey(key string) bool {
+	return key == snapshotsKey || strings.HasPrefix(key, snapshotKeyPrefix)
+}
+
+// snapshotChunkKey - The key-value store key for one of a snapshot's chunks.
+func snapshotChunkKey(name string, chunk int) string {
+	return fmt.Sprintf("%s%s/%d", snapshotKeyPrefix, name, chunk)
+}
+
+// NormalizeSnapshotName - Turn " Before-Import " into "before-import".
+// Returns "" if it isn't a valid name.
+func NormalizeSnapshotName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) > snapshotNameMaxLength || snapshotNamePattern.MatchString(name) == false {
+		return ""
+	}
+
+	return name
+}
+
+// -----------------------------------------------------------------------------
+// Quotebot functions
+// -----------------------------------------------------------------------------
+
+// kvKeys - Every key in the key-value store, except the snapshots and the
+// damaged values.
+func (p *QuotebotPlugin) kvKeys() ([]string, *model.AppError) {
+	var keys []string
+	for page := 0; ; page++ {
+		pageKeys, err := p.API.KVList(page, snapshotListSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range pageKeys {
+			if isSnapshotKey(key) == false && isDamageKey(key) == false {
+				keys = append(keys, key)
+			}
+		}
+		if len(pageKeys) < snapshotListSize {
+			return keys, nil
+		}
+	}
+}
+
+// loadSnapshots - Load the list of snapshots, oldest first, and its raw value
+// for compare-and-set.
+func (p *QuotebotPlugin) loadSnapshots() ([]SnapshotInfo, []byte, *model.AppError) {
+	var infos []SnapshotInfo
+	raw, err := p.loadJSONKey(snapshotsKey, &infos, "snapshots")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return infos, raw, nil
+}
+
+// updateSnapshots - Change the list of snapshots with compare-and-set,
+// retrying if someone else changed it first. The update function returns the
+// new list.
+func (p *QuotebotPlugin) updateSnapshots(update func([]SnapshotInfo) []SnapshotInfo) *model.AppError {
+	var infos []SnapshotInfo
+	return p.updateJSONKey(snapshotsKey, &infos, "snapshots", func() bool {
+		infos = update(infos)
+
+		return true
+	})
+}
+
+// Snapshots - Every snapshot, oldest first.
+func (p *QuotebotPlugin) Snapshots() ([]SnapshotInfo, *model.AppError) {
+	infos, _, err := p.loadSnapshots()
+
+	return infos, err
+}
+
+// FindSnapshot - The snapshot with the given name, or nil if there isn't one.
+func (p *QuotebotPlugin) FindSnapshot(name string) (*SnapshotInfo, *model.AppError) {
+	infos, err := p.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range infos {
+		if infos[idx].Name == name {
+			return &infos[idx], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Snapshot - Save a copy of everything under name, which has to be a valid
+// name that isn't used yet. reason says why, for automatic snapshots.
+func (p *QuotebotPlugin) Snapshot(name string, userID string, reason string) (*SnapshotInfo, *model.AppError) {
+	if NormalizeSnapshotName(name) != name {
+		return nil, p.NewError("Unable to take a snapshot.", fmt.Sprintf("%q isn't a snapshot name.", name), "Snapshot")
+	}
+	existing, err := p.FindSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, p.NewError("Unable to take a snapshot.", fmt.Sprintf("There's already a snapshot called %q.", name), "Snapshot")
+	}
+
+	keys, err := p.kvKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	configuration := p.getConfiguration()
+	channelID, teamID := p.postTarget()
+	contents := snapshot{
+		Settings: snapshotSettings{
+			PostDelta:         configuration.postDelta,
+			PostChannel:       configuration.postChannel,
+			PostChannelQuotes: configuration.postChannelQuotes,
+			ChannelID:         channelID,
+			TeamID:            teamID,
+		},
+	}
+
+	saved := 0
+	chunk := make(map[string][]byte)
+	size := 0
+	saveChunk := func() *model.AppError {
+		raw, jsonErr := json.Marshal(chunk)
+		if jsonErr != nil {
+			return p.NewError("Unable to take a snapshot.", "json.Marshal() failed.", "Snapshot")
+		}
+		err := p.API.KVSet(snapshotChunkKey(name, contents.Chunks), raw)
+		if err != nil {
+			return err
+		}
+
+		contents.Chunks++
+		saved += len(chunk)
+		chunk = make(map[string][]byte)
+		size = 0
+
+		return nil
+	}
+	for _, key := range keys {
+		if isWordIndexKey(key) {
+			continue
+		}
+
+		value, err := p.API.KVGet(key)
+		if err == nil && key == schemaVersionKey {
+			contents.SchemaVersion, _ = parseSchemaVersion(value)
+		}
+		if err == nil && value != nil {
+			chunk[key] = value
+			size += len(key) + len(value)
+			if size >= snapshotChunkSize {
+				err = saveChunk()
+			}
+		}
+		if err != nil {
+			p.deleteSnapshotChunks(name, contents.Chunks)
+			return nil, err
+		}
+	}
+	if len(chunk) > 0 {
+		err = saveChunk()
+		if err != nil {
+			p.deleteSnapshotChunks(name, contents.Chunks)
+			return nil, err
+		}
+	}
+
+	raw, jsonErr := json.Marshal(contents)
+	if jsonErr != nil {
+		p.deleteSnapshotChunks(name, contents.Chunks)
+		return nil, p.NewError("Unable to take a snapshot.", "json.Marshal() failed.", "Snapshot")
+	}
+	err = p.API.KVSet(snapshotKeyPrefix+name, raw)
+	if err != nil {
+		p.deleteSnapshotChunks(name, contents.Chunks)
+		return nil, err
+	}
+
+	info := SnapshotInfo{
+		Name:     name,
+		CreateAt: model.GetMillis(),
+		UserID:   userID,
+		Reason:   reason,
+		Keys:     saved,
+	}
+
+	// Only the newest automatic snapshots are kept.
+	var expired []string
+	err = p.updateSnapshots(func(infos []SnapshotInfo) []SnapshotInfo {
+		infos = append(infos, info)
+
+		automatic := 0
+		for idx := range infos {
+			if strings.HasPrefix(infos[idx].Name, automaticSnapshotPrefix) {
+				automatic++
+			}
+		}
+
+		expired = nil
+		kept := make([]SnapshotInfo, 0, len(infos))
+		for idx := range infos {
+			if strings.HasPrefix(infos[idx].Name, automaticSnapshotPrefix) && automatic > maxAutomaticSnapshots {
+				expired = append(expired, infos[idx].Name)
+				automatic--
+				continue
+			}
+
+			kept = append(kept, infos[idx])
+		}
+
+		return kept
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range expired {
+		err = p.deleteSnapshot(name)
+		if err != nil {
+			p.API.LogWarn("Unable to delete an old snapshot.", "name", name, "error", err.Error())
+		}
+	}
+
+	return &info, nil
+}
+
+// deleteSnapshotChunks - Delete the first count of a snapshot's chunks. Used
+// to clean up after a snapshot that couldn't be finished, so failures are
+// only logged.
+func (p *QuotebotPlugin) deleteSnapshotChunks(name string, count int) {
+	for chunk := 0; chunk < count; chunk++ {
+		err := p.API.KVDelete(snapshotChunkKey(name, chunk))
+		if err != nil {
+			p.API.LogWarn("Unable to delete part of a snapshot.", "key", snapshotChunkKey(name, chunk))
+		}
+	}
+}
+
+// deleteSnapshot - Delete a snapshot's values and settings. It should already
+// be out of the list of snapshots.
+func (p *QuotebotPlugin) deleteSnapshot(name string) *model.AppError {
+	contents, err := p.loadSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	if contents != nil {
+		p.deleteSnapshotChunks(name, contents.Chunks)
+	}
+
+	return p.API.KVDelete(snapshotKeyPrefix + name)
+}
+
+// loadSnapshot - Load what's under a snapshot's own key, or nil if there
+// isn't anything.
+func (p *QuotebotPlugin) loadSnapshot(name string) (*snapshot, *model.AppError) {
+	raw, err := p.API.KVGet(snapshotKeyPrefix + name)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var contents snapshot
+	jsonErr := json.Unmarshal(raw, &contents)
+	if jsonErr != nil {
+		return nil, p.NewError("Unable to load a snapshot.", fmt.Sprintf("Snapshot %q is damaged.", name), "loadSnapshot")
+	}
+	if contents.Data != nil {
+		// From before the schema version was kept with the settings.
+		version, convErr := parseSchemaVersion(contents.Data[schemaVersionKey])
+		if convErr != nil {
+			return nil, p.NewError("Unable to load a snapshot.", fmt.Sprintf("Snapshot %q has a damaged schema version.", name), "loadSnapshot")
+		}
+		contents.SchemaVersion = version
+	}
+
+	return &contents, nil
+}
+
+// snapshotValues - Call each with every key and value in a snapshot, a chunk
+// at a time, stopping at the first error.
+func (p *QuotebotPlugin) snapshotValues(name string, contents *snapshot, each func(key string, value []byte) *model.AppError) *model.AppError {
+	for key, value := range contents.Data {
+		err := each(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for idx := 0; idx < contents.Chunks; idx++ {
+		raw, err := p.API.KVGet(snapshotChunkKey(name, idx))
+		if err != nil {
+			return err
+		}
+
+		var chunk map[string][]byte
+		jsonErr := json.Unmarshal(raw, &chunk)
+		if raw == nil || jsonErr != nil {
+			return p.NewError("Unable to load a snapshot.", fmt.Sprintf("Part %d of snapshot %q is missing or damaged.", idx, name), "snapshotValues")
+		}
+		for key, value := range chunk {
+			err = each(key, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// automaticSnapshot - Take a snapshot before doing something destructive.
+// reason says what, like "deleting quote 3".
+func (p *QuotebotPlugin) automaticSnapshot(userID string, reason string) (*SnapshotInfo, *model.AppError) {
+	// The random part keeps snapshots taken at the same moment apart.
+	name := fmt.Sprintf("%s%d-%04d", automaticSnapshotPrefix, model.GetMillis(), rand.Intn(10000))
+
+	return p.Snapshot(name, userID, reason)
+}
+
+// restoreValues - Put the key-value store back the way it was in a snapshot.
+// Values that weren't in it are deleted, and so are the word index markers, so
+// the next search rebuilds each index. The caller must hold stateLock for
+// writing.
+func (p *QuotebotPlugin) restoreValues(name string, contents *snapshot) *model.AppError {
+	keys, err := p.kvKeys()
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[string]bool)
+	err = p.snapshotValues(name, contents, func(key string, value []byte) *model.AppError {
+		// Older snapshots have word indexes; they're rebuilt instead.
+		if isWordIndexKey(key) {
+			return nil
+		}
+
+		restored[key] = true
+		return p.API.KVSet(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if restored[key] {
+			continue
+		}
+		// Deleting the marker is enough to have the search rebuild the word
+		// index, which throws the old one away.
+		if isWordIndexKey(key) && strings.HasSuffix(key, wordIndexedKey) == false {
+			continue
+		}
+
+		err = p.API.KVDelete(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback - Put everything back the way it was in the named snapshot, and
+// bring it up to date if it's from an older version of Quotebot. Takes an
+// automatic snapshot first, so the rollback can be undone; returns it.
+//
+// The key-value store can't change several keys at once, so the caller must
+// hold stateLock for writing to keep our other commands out of the way while
+// the keys change. If it fails part way through, everything is put back from
+// the automatic snapshot, so the quotes aren't left half way between the two.
+func (p *QuotebotPlugin) Rollback(name string, userID string) (*SnapshotInfo, *model.AppError) {
+	info, err := p.FindSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, p.NewError("Unable to roll back.", fmt.Sprintf("There isn't a snapshot called %q.", name), "Rollback")
+	}
+
+	contents, err := p.loadSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, p.NewError("Unable to roll back.", fmt.Sprintf("Snapshot %q is missing.", name), "Rollback")
+	}
+	err = p.checkSchemaVersion(contents.SchemaVersion, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	undo, err := p.automaticSnapshot(userID, "rolling back to "+name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.API.LogInfo("Rolling back to a snapshot.", "name", name)
+	err = p.restoreValues(name, contents)
+
+	// Start the collections over, in case they remember anything.
+	p.closeCollections()
+
+	if err != nil {
+		p.API.LogError("Unable to roll back, putting everything back.", "error", err.Error())
+
+		current, undoErr := p.loadSnapshot(undo.Name)
+		if undoErr == nil && current == nil {
+			undoErr = p.NewError("Unable to roll back.", fmt.Sprintf("Snapshot %q is missing.", undo.Name), "Rollback")
+		}
+		if undoErr == nil {
+			undoErr = p.restoreValues(undo.Name, current)
+		}
+		if undoErr != nil {
+			p.API.LogError("Unable to put everything back after a failed rollback.", "error", undoErr.Error())
+			return nil, p.NewError("Unable to roll back.",
+				fmt.Sprintf("Rolling back to %q failed part way through, and so did putting everything back. Roll back to %q to try again.", name, undo.Name), "Rollback")
+		}
+
+		return nil, err
+	}
+
+	configuration := p.getConfiguration().Clone()
+	configuration.postDelta = contents.Settings.PostDelta
+	configuration.postChannel = contents.Settings.PostChannel
+	configuration.postChannelQuotes = contents.Settings.PostChannelQuotes
+	p.setConfiguration(configuration)
+	p.setPostTarget(contents.Settings.ChannelID, contents.Settings.TeamID)
+
+	// Snapshots from before an upgrade need the migrations since.
+	err = p.Migrate(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return undo, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalizeSnapshotName - Test the NormalizeSnapshotName function.
+func TestNormalizeSnapshotName(t *testing.T) {
+	assert.EqualValues(t, NormalizeSnapshotName(" Before-Import "), "before-import")
+	assert.EqualValues(t, NormalizeSnapshotName("2019-10-18.1_a"), "2019-10-18.1_a")
+
+	assert.EqualValues(t, NormalizeSnapshotName(""), "")
+	assert.EqualValues(t, NormalizeSnapshotName("-x"), "")
+	assert.EqualValues(t, NormalizeSnapshotName("two words"), "")
+	assert.EqualValues(t, NormalizeSnapshotName(strings.Repeat("x", snapshotNameMaxLength+1)), "")
+}
+
+// TestSnapshotRollback - Test the Snapshot and Rollback functions.
+func TestSnapshotRollback(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.AddQuote(testCommandArgs(""), "--here quote 2")
+	p.SetInterval("30")
+
+	info, err := p.Snapshot("before", "userid", "")
+	assert.Nil(t, err)
+	assert.EqualValues(t, info.Name, "before")
+	assert.EqualValues(t, info.UserID, "userid")
+	assert.True(t, info.Keys > 0)
+
+	// The values are in chunks, without the word index.
+	p.Store("teamid").Find([]string{"quote"}, 1)
+	contents, err := p.loadSnapshot("before")
+	assert.Nil(t, err)
+	assert.EqualValues(t, contents.Chunks, 1)
+	assert.Nil(t, contents.Data)
+	keys := 0
+	err = p.snapshotValues("before", contents, func(key string, value []byte) *model.AppError {
+		assert.False(t, isWordIndexKey(key), key)
+		keys++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, keys, info.Keys)
+
+	_, err = p.Snapshot("before", "userid", "")
+	assert.NotNil(t, err)
+	_, err = p.Snapshot("Not a name", "userid", "")
+	assert.NotNil(t, err)
+
+	// Change everything.
+	p.AddQuote(testCommandArgs(""), "quote 3")
+	p.EditQuote(testCommandArgs(""), "1 quote one")
+	p.Store("teamid").Delete(1, "userid")
+	p.AddQuote(testCommandArgs(""), "--here quote 4")
+	p.AddResponses([]Response{{Trigger: "dunno", Response: "Me neither."}})
+	p.SetInterval("60")
+
+	undo, err := p.Rollback("before", "userid")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(undo.Name, automaticSnapshotPrefix))
+	assert.EqualValues(t, undo.Reason, "rolling back to before")
+
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 1)
+	assert.EqualValues(t, quotes[0].Text, "quote 1")
+	lastID, err := p.Store("teamid").LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 1)
+	trash, err := p.Store("teamid").Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 0)
+	here, err := p.collection(channelCollection("channelid")).List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(here), 1)
+	responses, err := p.Responses()
+	assert.Nil(t, err)
+	assert.Nil(t, responses)
+	assert.EqualValues(t, p.getConfiguration().postDelta, 30)
+
+	// Searching still works after the word index went back in time.
+	found, err := p.Store("teamid").Find([]string{"quote"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(found), 1)
+
+	// And the rollback can be undone.
+	_, err = p.Rollback(undo.Name, "userid")
+	assert.Nil(t, err)
+	quotes = testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 1)
+	assert.EqualValues(t, quotes[0].Text, "quote 3")
+	assert.EqualValues(t, p.getConfiguration().postDelta, 60)
+
+	_, err = p.Rollback("nope", "userid")
+	assert.NotNil(t, err)
+}
+
+// TestAutomaticSnapshots - Only the newest automatic snapshots are kept.
+func TestAutomaticSnapshots(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	_, err := p.Snapshot("mine", "userid", "")
+	assert.Nil(t, err)
+
+	var names []string
+	for idx := 0; idx < maxAutomaticSnapshots+2; idx++ {
+		info, err := p.automaticSnapshot("userid", "testing")
+		assert.Nil(t, err)
+		names = append(names, info.Name)
+	}
+
+	infos, err := p.Snapshots()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(infos), maxAutomaticSnapshots+1)
+	assert.EqualValues(t, infos[0].Name, "mine")
+	assert.EqualValues(t, infos[1].Name, names[2])
+
+	raw, _ := p.API.KVGet(snapshotKeyPrefix + names[0])
+	assert.Nil(t, raw)
+	raw, _ = p.API.KVGet(snapshotChunkKey(names[0], 0))
+	assert.Nil(t, raw)
+	raw, _ = p.API.KVGet(snapshotKeyPrefix + names[2])
+	assert.NotNil(t, raw)
+	raw, _ = p.API.KVGet(snapshotChunkKey(names[2], 0))
+	assert.NotNil(t, raw)
+}
+
+// TestRollbackOldSnapshot - Snapshots with their values in one piece, word
+// indexes and all, still roll back.
+func TestRollbackOldSnapshot(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+
+	data := make(map[string][]byte)
+	keys, err := p.kvKeys()
+	assert.Nil(t, err)
+	for _, key := range keys {
+		data[key], _ = p.API.KVGet(key)
+	}
+	data["team_teamid_"+wordKey("stale")] = []byte("[1]")
+	raw, _ := json.Marshal(snapshot{Data: data})
+	p.API.KVSet(snapshotKeyPrefix+"old", raw)
+	p.updateSnapshots(func(infos []SnapshotInfo) []SnapshotInfo {
+		return append(infos, SnapshotInfo{Name: "old"})
+	})
+
+	p.AddQuote(testCommandArgs(""), "quote 2")
+	_, err = p.Rollback("old", "userid")
+	assert.Nil(t, err)
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 1)
+	raw, _ = p.API.KVGet("team_teamid_" + wordKey("stale"))
+	assert.Nil(t, raw)
+	found, err := p.Store("teamid").Find([]string{"quote"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(found), 1)
+}
+
+// TestRollbackFailure - A rollback that fails part way through puts
+// everything back the way it was.
+func TestRollbackFailure(t *testing.T) {
+	api, kv := initKVAPI(t, "system", "mock", nil)
+	p := &QuotebotPlugin{}
+	p.SetAPI(api)
+	t.Cleanup(func() {
+		p.OnDeactivate()
+	})
+	assert.Nil(t, p.OnActivate())
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	_, err := p.Snapshot("before", "userid", "")
+	assert.Nil(t, err)
+	p.EditQuote(testCommandArgs(""), "1 quote one")
+	p.AddQuote(testCommandArgs(""), "quote 2")
+
+	// The first write of quote 1 fails; putting it back works.
+	failed := false
+	kv.Lock()
+	kv.fail = func(key string) bool {
+		if key == "team_teamid_"+quoteKey(1) && failed == false {
+			failed = true
+			return true
+		}
+
+		return false
+	}
+	kv.Unlock()
+
+	_, err = p.Rollback("before", "userid")
+	assert.NotNil(t, err)
+	assert.True(t, failed)
+	quotes := testQuotes(t, p)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].Text, "quote one")
+	assert.EqualValues(t, quotes[1].Text, "quote 2")
+
+	// If putting it back fails too, it says how to try again.
+	kv.Lock()
+	kv.fail = func(key string) bool {
+		return key == "team_teamid_"+quoteKey(1)
+	}
+	kv.Unlock()
+	_, err = p.Rollback("before", "userid")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.DetailedError, "Roll back to \"auto-")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// QuoteStore - Somewhere to keep quotes.
+//
+// Mattermost calls our hooks concurrently, so implementations must be safe to
+// use from several goroutines at once. Quote IDs are handed out by the store
+// and are never reused, even if the quote that had it is deleted.
+//
+// KVQuoteStore is the real thing, MemoryQuoteStore is for tests, and
+// FileQuoteStore is for offline tooling and development, with the
+// QuoteDirectory setting.
+type QuoteStore interface {
+	// Add - Add a quote, giving it the next ID. Returns the quote as it was
+	// saved.
+	Add(quote Quote) (Quote, *model.AppError)
+
+	// Count - The number of quotes on file.
+	Count() (int, *model.AppError)
+
+	// Delete - Move the quote with the given ID to the trash, noting who
+	// deleted it. Returns false if there wasn't one to delete.
+	Delete(id int, userID string) (bool, *model.AppError)
+
+	// Find - Every quote with words matching at least minMatches of the search
+	// terms, in ID order. A term matches a word if it's the same word or, if
+	// it's at least searchPrefixMinLength letters long, the start of it.
+	// Quotes in the trash don't count.
+	Find(terms []string, minMatches int) ([]Quote, *model.AppError)
+
+	// Get - Get the quote with the given ID, or nil if there isn't one. Quotes
+	// in the trash don't count.
+	Get(id int) (*Quote, *model.AppError)
+
+	// IDs - The IDs of every quote, in order.
+	IDs() ([]int, *model.AppError)
+
+	// LastID - The last quote ID handed out. Quotes with IDs up to this one
+	// either exist or were deleted.
+	LastID() (int, *model.AppError)
+
+	// List - Every quote, in ID order.
+	List() ([]Quote, *model.AppError)
+
+	// Purge - Permanently delete quotes that went in the trash before the
+	// given time, in milliseconds since the epoch. Returns how many were
+	// purged.
+	Purge(before int64) (int, *model.AppError)
+
+	// Reindex - Rebuild anything the store keeps to make Find fast, after
+	// it's been damaged. Returns how many quotes were indexed.
+	Reindex() (int, *model.AppError)
+
+	// Replace - Throw away everything in the store and put quotes and trash
+	// in its place, IDs and all, as if lastID was the last ID handed out.
+	// Used to bring back a copy of the store exactly.
+	Replace(lastID int, quotes []Quote, trash []Quote) *model.AppError
+
+	// Restore - Take the quote with the given ID out of the trash. Returns
+	// false if it wasn't in the trash.
+	Restore(id int) (bool, *model.AppError)
+
+	// Trash - Every quote in the trash, in ID order.
+	Trash() ([]Quote, *model.AppError)
+
+	// Update - Change the quote with the given ID. The update function is
+	// given a copy of the quote to change, and returns false if there's
+	// nothing to change; it may be called more than once if someone else
+	// changes the quote at the same time. Returns false if nothing changed,
+	// or if there wasn't a quote to change. Quotes in the trash don't count.
+	Update(id int, update func(quote *Quote) bool) (bool, *model.AppError)
+}
+
+// sortedReplacement - Check that quotes and trash could have come from a store
+// whose last ID is lastID, and sort them into ID order for QuoteStore.Replace.
+// Every ID has to be between 1 and lastID and used once, and only the quotes
+// in the trash can be deleted.
+func sortedReplacement(lastID int, quotes []Quote, trash []Quote) ([]Quote, []Quote, error) {
+	seen := make(map[int]bool)
+	for _, list := range [][]Quote{quotes, trash} {
+		for idx := range list {
+			id := list[idx].ID
+			if id < 1 || id > lastID {
+				return nil, nil, fmt.Errorf("quote %d is outside 1 to %d", id, lastID)
+			}
+			if seen[id] {
+				return nil, nil, fmt.Errorf("quote %d is there twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	for idx := range quotes {
+		if quotes[idx].DeleteAt != 0 {
+			return nil, nil, fmt.Errorf("quote %d was deleted but isn't in the trash", quotes[idx].ID)
+		}
+	}
+	for idx := range trash {
+		if trash[idx].DeleteAt == 0 {
+			return nil, nil, fmt.Errorf("quote %d is in the trash but wasn't deleted", trash[idx].ID)
+		}
+	}
+
+	sortedQuotes := append([]Quote(nil), quotes...)
+	sort.Slice(sortedQuotes, func(i int, j int) bool {
+		return sortedQuotes[i].ID < sortedQuotes[j].ID
+	})
+	sortedTrash := append([]Quote(nil), trash...)
+	sort.Slice(sortedTrash, func(i int, j int) bool {
+		return sortedTrash[i].ID < sortedTrash[j].ID
+	})
+
+	return sortedQuotes, sortedTrash, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// FileQuoteStore - Keeps the quotes in a local JSON file, for offline tooling
+// and development.
+//
+// The whole file is loaded when the store is created, and rewritten after
+// every change.
+type FileQuoteStore struct {
+	*MemoryQuoteStore
+
+	path string
+}
+
+// quoteFile - What's in a FileQuoteStore's file.
+type quoteFile struct {
+	LastID int     `json:"last_id"`
+	Quotes []Quote `json:"quotes"`
+	Trash  []Quote `json:"trash"`
+}
+
+// NewFileQuoteStore - Create a FileQuoteStore using the file at path. The file
+// is created when the first quote is added if it doesn't exist yet.
+func NewFileQuoteStore(path string) (*FileQuoteStore, *model.AppError) {
+	s := &FileQuoteStore{
+		MemoryQuoteStore: NewMemoryQuoteStore(),
+		path:             path,
+	}
+	s.MemoryQuoteStore.changed = s.save
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, s.newError("Unable to load quotes.", err.Error(), "NewFileQuoteStore")
+	}
+
+	var contents quoteFile
+	err = json.Unmarshal(raw, &contents)
+	if err != nil {
+		return nil, s.newError("Unable to load quotes.", fmt.Sprintf("json.Unmarshal(%q) failed.", path), "NewFileQuoteStore")
+	}
+
+	s.quotes = contents.Quotes
+	s.trash = contents.Trash
+	s.lastID = contents.LastID
+
+	return s, nil
+}
+
+// newError - Create a new error object.
+func (s *FileQuoteStore) newError(message string, details string, where string) *model.AppError {
+	return &model.AppError{
+		Message:       message,
+		DetailedError: details,
+		Where:         "FileQuoteStore." + where,
+	}
+}
+
+// save - Write everything out. Called with the MemoryQuoteStore's lock held.
+//
+// We write to a temporary file and rename it over the real one, so a crash
+// part way through doesn't leave half a file behind.
+func (s *FileQuoteStore) save() *model.AppError {
+	contents := quoteFile{
+		LastID: s.lastID,
+		Quotes: s.quotes,
+		Trash:  s.trash,
+	}
+	if contents.Quotes == nil {
+		contents.Quotes = []Quote{}
+	}
+	if contents.Trash == nil {
+		contents.Trash = []Quote{}
+	}
+
+	raw, err := json.MarshalIndent(contents, "", "    ")
+	if err != nil {
+		return s.newError("Unable to save quotes.", fmt.Sprintf("json.MarshalIndent(%v) failed.", contents), "save")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return s.newError("Unable to save quotes.", err.Error(), "save")
+	}
+
+	_, err = temp.Write(raw)
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return s.newError("Unable to save quotes.", err.Error(), "save")
+	}
+
+	return nil
+}
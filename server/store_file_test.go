@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - FileQuoteStore functions
+// -----------------------------------------------------------------------------
+
+// TestFileQuoteStore - Run the common QuoteStore tests, then make sure it all
+// comes back from the file.
+func TestFileQuoteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotebot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "quotes.json")
+	store, appErr := NewFileQuoteStore(path)
+	assert.Nil(t, appErr)
+	testQuoteStore(t, store)
+
+	store, appErr = NewFileQuoteStore(path)
+	assert.Nil(t, appErr)
+	count, appErr := store.Count()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, count, 22)
+	lastID, appErr := store.LastID()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, lastID, 26)
+	quote, appErr := store.Get(3)
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, quote.Text, "quote three")
+
+	store.Delete(3, "userid")
+	store, appErr = NewFileQuoteStore(path)
+	assert.Nil(t, appErr)
+	trash, appErr := store.Trash()
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, len(trash), 3)
+	assert.EqualValues(t, trash[0].ID, 3)
+	assert.EqualValues(t, trash[0].DeletedBy, "userid")
+
+	// Only the real file is left behind.
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(files), 1)
+
+	// Garbage in, error out.
+	err = ioutil.WriteFile(path, []byte("not json"), 0600)
+	assert.Nil(t, err)
+	_, appErr = NewFileQuoteStore(path)
+	assert.NotNil(t, appErr)
+}
+
+// TestFileQuoteStoreUnsaved - Changes that can't be written out don't stick.
+func TestFileQuoteStoreUnsaved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotebot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store, appErr := NewFileQuoteStore(filepath.Join(dir, "quotes.json"))
+	assert.Nil(t, appErr)
+	for _, text := range []string{"quote one", "quote two", "quote three"} {
+		_, appErr = store.Add(Quote{Text: text})
+		assert.Nil(t, appErr)
+	}
+	_, appErr = store.Delete(3, "userid")
+	assert.Nil(t, appErr)
+
+	// Nowhere to write the file any more.
+	assert.Nil(t, os.RemoveAll(dir))
+
+	_, appErr = store.Add(Quote{Text: "quote four"})
+	assert.NotNil(t, appErr)
+	deleted, appErr := store.Delete(1, "userid")
+	assert.NotNil(t, appErr)
+	assert.False(t, deleted)
+	restored, appErr := store.Restore(3)
+	assert.NotNil(t, appErr)
+	assert.False(t, restored)
+	updated, appErr := store.Update(2, func(quote *Quote) bool {
+		quote.Text = "changed"
+		return true
+	})
+	assert.NotNil(t, appErr)
+	assert.False(t, updated)
+	_, appErr = store.Purge(model.GetMillis() + 1)
+	assert.NotNil(t, appErr)
+	appErr = store.Replace(10, []Quote{{ID: 10, Text: "replaced"}}, nil)
+	assert.NotNil(t, appErr)
+
+	lastID, _ := store.LastID()
+	assert.EqualValues(t, lastID, 3)
+	quotes, _ := store.List()
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].Text, "quote one")
+	assert.EqualValues(t, quotes[1].Text, "quote two")
+	trash, _ := store.Trash()
+	assert.EqualValues(t, len(trash), 1)
+	assert.EqualValues(t, trash[0].ID, 3)
+	assert.EqualValues(t, trash[0].DeletedBy, "userid")
+}
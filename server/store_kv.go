@@ -0,0 +1,789 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store keys. Each quote lives under its own key, and the IDs of
+	// the live quotes are kept in index pages of quoteIndexPageSize IDs each;
+	// quote N is listed in index page (N-1)/quoteIndexPageSize.
+	quotesKey          string = "quotes" // Legacy: every quote in one value.
+	lastQuoteIDKey     string = "last_quote_id"
+	quoteKeyPrefix     string = "quote_"
+	quoteIndexPrefix   string = "quote_index_"
+	quoteIndexPageSize int    = 500
+	quoteTrashKey      string = "quote_trash" // IDs of the quotes in the trash.
+
+	// How many times we retry a compare-and-set that lost a race before we
+	// give up.
+	maxCompareAndSetTries int = 10
+)
+
+// KVQuoteStore - Keeps the quotes in the plugin's key-value store.
+//
+// The lock keeps this server's hooks out of each other's way, and
+// compare-and-set on the shared keys keeps the other servers in a cluster out
+// of ours.
+type KVQuoteStore struct {
+	api    plugin.API
+	prefix string // Prepended to every key, so collections don't collide.
+	lock   sync.RWMutex
+}
+
+// NewKVQuoteStore - Create a KVQuoteStore for the named collection using the
+// given plugin API. The shared collection's keys aren't prefixed, so it
+// picks up the quotes saved before there were collections.
+func NewKVQuoteStore(api plugin.API, collection string) *KVQuoteStore {
+	prefix := ""
+	if collection != sharedCollection {
+		prefix = collection + "_"
+	}
+
+	return &KVQuoteStore{
+		api:    api,
+		prefix: prefix,
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions.
+// -----------------------------------------------------------------------------
+
+// quoteKey - The key-value store key for a quote.
+func quoteKey(id int) string {
+	return quoteKeyPrefix + strconv.Itoa(id)
+}
+
+// quoteIndexKey - The key-value store key for an index page.
+func quoteIndexKey(page int) string {
+	return quoteIndexPrefix + strconv.Itoa(page)
+}
+
+// quoteIndexPage - The index page that lists the given quote ID.
+func quoteIndexPage(id int) int {
+	return (id - 1) / quoteIndexPageSize
+}
+
+// key - The key-value store key for one of this collection's values.
+func (s *KVQuoteStore) key(name string) string {
+	return s.prefix + name
+}
+
+// newError - Create a new error object.
+func (s *KVQuoteStore) newError(message string, details string, where string) *model.AppError {
+	return &model.AppError{
+		Message:       message,
+		DetailedError: details,
+		Where:         "KVQuoteStore." + where,
+	}
+}
+
+// loadLastID - Load the last quote ID we handed out, and its raw value for
+// compare-and-set.
+func (s *KVQuoteStore) loadLastID() (int, []byte, *model.AppError) {
+	raw, err := s.api.KVGet(s.key(lastQuoteIDKey))
+	if err != nil {
+		return 0, nil, s.newError("Unable to load quotes.", "API.KVGet() failed.", "loadLastID")
+	}
+	if raw == nil {
+		return 0, nil, nil
+	}
+
+	lastID, convErr := strconv.Atoi(string(raw))
+	if convErr != nil {
+		return 0, nil, s.newError("Unable to load quotes.", fmt.Sprintf("strconv.Atoi(%q) failed.", raw), "loadLastID")
+	}
+
+	return lastID, raw, nil
+}
+
+// nextID - Hand out the ID for the next quote.
+//
+// IDs are never reused, even if the quote that had it is deleted.
+func (s *KVQuoteStore) nextID() (int, *model.AppError) {
+	for try := 0; try < maxCompareAndSetTries; try++ {
+		lastID, raw, err := s.loadLastID()
+		if err != nil {
+			return 0, err
+		}
+
+		nextID := lastID + 1
+		ok, err := s.api.KVCompareAndSet(s.key(lastQuoteIDKey), raw, []byte(strconv.Itoa(nextID)))
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return nextID, nil
+		}
+	}
+
+	return 0, s.newError("Unable to add quote.", "Too many concurrent changes to the last ID.", "nextID")
+}
+
+// insertID - Insert an ID into a list of IDs, keeping it in order.
+func insertID(ids []int, id int) []int {
+	idx := sort.SearchInts(ids, id)
+
+	ids = append(ids, 0)
+	copy(ids[idx+1:], ids[idx:])
+	ids[idx] = id
+
+	return ids
+}
+
+// removeID - Remove an ID from a list of IDs. Returns false if it wasn't there.
+func removeID(ids []int, id int) ([]int, bool) {
+	for idx := range ids {
+		if ids[idx] == id {
+			return append(ids[:idx], ids[idx+1:]...), true
+		}
+	}
+
+	return ids, false
+}
+
+// loadIDList - Load a list of IDs (an index page or the trash), and its raw
+// value for compare-and-set.
+func (s *KVQuoteStore) loadIDList(key string) ([]int, []byte, *model.AppError) {
+	raw, err := s.api.KVGet(key)
+	if err != nil {
+		return nil, nil, s.newError("Unable to load quotes.", "API.KVGet() failed.", "loadIDList")
+	}
+	if raw == nil {
+		return nil, nil, nil
+	}
+
+	var ids []int
+	loadErr := json.Unmarshal(raw, &ids)
+	if loadErr != nil {
+		return nil, nil, s.newError("Unable to load quotes.", fmt.Sprintf("json.Unmarshal(%q) failed.", raw), "loadIDList")
+	}
+
+	return ids, raw, nil
+}
+
+// updateIDList - Change a list of IDs with compare-and-set, retrying if
+// someone else changed it first.
+//
+// The update function returns the new list of IDs, and false if there's
+// nothing to change. Returns whether the list was changed.
+func (s *KVQuoteStore) updateIDList(key string, update func([]int) ([]int, bool)) (bool, *model.AppError) {
+	for try := 0; try < maxCompareAndSetTries; try++ {
+		ids, oldRaw, err := s.loadIDList(key)
+		if err != nil {
+			return false, err
+		}
+
+		ids, changed := update(ids)
+		if changed == false {
+			return false, nil
+		}
+
+		newRaw, jsonErr := json.Marshal(ids)
+		if jsonErr != nil {
+			return false, s.newError("Unable to save quotes.", fmt.Sprintf("json.Marshal(%v) failed.", ids), "updateIDList")
+		}
+
+		ok, err := s.api.KVCompareAndSet(key, oldRaw, newRaw)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, s.newError("Unable to save quotes.", fmt.Sprintf("Too many concurrent changes to %q.", key), "updateIDList")
+}
+
+// setIDList - Save a list of IDs, whatever was there before. An empty list
+// is deleted.
+func (s *KVQuoteStore) setIDList(key string, ids []int) *model.AppError {
+	if len(ids) == 0 {
+		return s.api.KVDelete(key)
+	}
+
+	raw, err := json.Marshal(ids)
+	if err != nil {
+		return s.newError("Unable to save quotes.", fmt.Sprintf("json.Marshal(%v) failed.", ids), "setIDList")
+	}
+
+	return s.api.KVSet(key, raw)
+}
+
+// loadQuote - Load a quote, or nil if there isn't one with that ID.
+func (s *KVQuoteStore) loadQuote(id int) (*Quote, *model.AppError) {
+	quote, _, err := s.loadQuoteRaw(id)
+
+	return quote, err
+}
+
+// loadQuoteRaw - Load a quote, or nil if there isn't one with that ID, and its
+// raw value for compare-and-set.
+func (s *KVQuoteStore) loadQuoteRaw(id int) (*Quote, []byte, *model.AppError) {
+	raw, err := s.api.KVGet(s.key(quoteKey(id)))
+	if err != nil {
+		return nil, nil, s.newError("Unable to load quote.", "API.KVGet() failed.", "loadQuoteRaw")
+	}
+	if raw == nil {
+		return nil, nil, nil
+	}
+
+	var quote Quote
+	loadErr := json.Unmarshal(raw, &quote)
+	if loadErr != nil {
+		return nil, nil, s.newError("Unable to load quote.", fmt.Sprintf("json.Unmarshal(%q) failed.", raw), "loadQuoteRaw")
+	}
+
+	return &quote, raw, nil
+}
+
+// saveQuote - Save a quote under its own key.
+func (s *KVQuoteStore) saveQuote(quote Quote) *model.AppError {
+	raw, err := json.Marshal(quote)
+	if err != nil {
+		return s.newError("Unable to save quote.", fmt.Sprintf("json.Marshal(%v) failed.", quote), "saveQuote")
+	}
+
+	return s.api.KVSet(s.key(quoteKey(quote.ID)), raw)
+}
+
+// loadQuotes - Load the quotes with the given IDs. The caller must hold the
+// lock.
+func (s *KVQuoteStore) loadQuotes(ids []int) ([]Quote, *model.AppError) {
+	quotes := make([]Quote, 0, len(ids))
+	for idx := range ids {
+		quote, err := s.loadQuote(ids[idx])
+		if err != nil {
+			return nil, err
+		}
+		if quote == nil {
+			s.api.LogWarn("Listed quote is missing.", "id", ids[idx])
+			continue
+		}
+
+		quotes = append(quotes, *quote)
+	}
+
+	return quotes, nil
+}
+
+// ids - The IDs of every quote, in order. The caller must hold the lock.
+func (s *KVQuoteStore) ids() ([]int, *model.AppError) {
+	lastID, _, err := s.loadLastID()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for page := 0; page*quoteIndexPageSize < lastID; page++ {
+		pageIDs, _, err := s.loadIDList(s.key(quoteIndexKey(page)))
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, pageIDs...)
+	}
+
+	return ids, nil
+}
+
+// -----------------------------------------------------------------------------
+// QuoteStore interface
+// -----------------------------------------------------------------------------
+
+// Add - Add a quote, giving it the next ID. Returns the quote as it was saved.
+func (s *KVQuoteStore) Add(quote Quote) (Quote, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id, err := s.nextID()
+	if err != nil {
+		return quote, err
+	}
+
+	// Save the quote before it's listed, so nobody finds an ID without a quote.
+	quote.ID = id
+	err = s.saveQuote(quote)
+	if err != nil {
+		return quote, err
+	}
+
+	_, err = s.updateIDList(s.key(quoteIndexKey(quoteIndexPage(id))), func(ids []int) ([]int, bool) {
+		return insertID(ids, id), true
+	})
+	if err != nil {
+		return quote, err
+	}
+
+	s.indexWords(id, "", quote.Text)
+
+	return quote, nil
+}
+
+// Count - The number of quotes on file.
+func (s *KVQuoteStore) Count() (int, *model.AppError) {
+	ids, err := s.IDs()
+
+	return len(ids), err
+}
+
+// Delete - Move the quote with the given ID to the trash. Returns false if
+// there wasn't one to delete.
+func (s *KVQuoteStore) Delete(id int, userID string) (bool, *model.AppError) {
+	if id < 1 {
+		return false, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Unlist it first, so nobody finds an ID without a quote.
+	found, err := s.updateIDList(s.key(quoteIndexKey(quoteIndexPage(id))), func(ids []int) ([]int, bool) {
+		return removeID(ids, id)
+	})
+	if err != nil || found == false {
+		return false, err
+	}
+
+	quote, err := s.loadQuote(id)
+	if err != nil {
+		return false, err
+	}
+	if quote == nil {
+		// Listed, but missing; there's nothing to put in the trash.
+		s.api.LogWarn("Quote listed in the index is missing.", "id", id)
+		return true, nil
+	}
+
+	quote.DeleteAt = model.GetMillis()
+	quote.DeletedBy = userID
+	err = s.saveQuote(*quote)
+	if err != nil {
+		return false, err
+	}
+
+	s.indexWords(id, quote.Text, "")
+
+	_, err = s.updateIDList(s.key(quoteTrashKey), func(ids []int) ([]int, bool) {
+		return insertID(ids, id), true
+	})
+
+	return err == nil, err
+}
+
+// Find - Every quote with words matching at least minMatches of the search
+// terms, in ID order. The word index is built the first time it's needed.
+func (s *KVQuoteStore) Find(terms []string, minMatches int) ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	indexed, err := s.isIndexed()
+	if err == nil && indexed {
+		defer s.lock.RUnlock()
+		return s.find(terms, minMatches)
+	}
+	s.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Someone else might have built it while we waited for the lock.
+	indexed, err = s.isIndexed()
+	if err != nil {
+		return nil, err
+	}
+	if indexed == false {
+		_, err = s.reindex()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.find(terms, minMatches)
+}
+
+// Get - Get the quote with the given ID, or nil if there isn't one.
+func (s *KVQuoteStore) Get(id int) (*Quote, *model.AppError) {
+	if id < 1 {
+		return nil, nil
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	quote, err := s.loadQuote(id)
+	if err != nil || quote == nil || quote.DeleteAt != 0 {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+// IDs - The IDs of every quote, in order.
+func (s *KVQuoteStore) IDs() ([]int, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.ids()
+}
+
+// LastID - The last quote ID handed out. Quotes with IDs up to this one either
+// exist or were deleted.
+func (s *KVQuoteStore) LastID() (int, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	lastID, _, err := s.loadLastID()
+
+	return lastID, err
+}
+
+// List - Every quote, in ID order.
+func (s *KVQuoteStore) List() ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.loadQuotes(ids)
+}
+
+// Purge - Permanently delete quotes that went in the trash before the given
+// time.
+func (s *KVQuoteStore) Purge(before int64) (int, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids, _, err := s.loadIDList(s.key(quoteTrashKey))
+	if err != nil {
+		return 0, err
+	}
+
+	expired := make(map[int]bool)
+	for idx := range ids {
+		quote, err := s.loadQuote(ids[idx])
+		if err != nil {
+			return 0, err
+		}
+		if quote == nil || quote.DeleteAt < before {
+			expired[ids[idx]] = true
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	// Take them out of the trash, then get rid of them.
+	_, err = s.updateIDList(s.key(quoteTrashKey), func(ids []int) ([]int, bool) {
+		kept := make([]int, 0, len(ids))
+		for idx := range ids {
+			if expired[ids[idx]] == false {
+				kept = append(kept, ids[idx])
+			}
+		}
+
+		return kept, len(kept) != len(ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for id := range expired {
+		err = s.api.KVDelete(s.key(quoteKey(id)))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+// Reindex - Throw away the word index and build it again from the quotes.
+// Returns how many quotes were indexed.
+func (s *KVQuoteStore) Reindex() (int, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.reindex()
+}
+
+// Replace - Throw away everything in the store and put quotes and trash in
+// its place.
+//
+// This isn't one change; quotes added on another server while it runs can be
+// lost, and if it fails part way through the store is left half replaced.
+// Run it again to finish the job.
+func (s *KVQuoteStore) Replace(lastID int, quotes []Quote, trash []Quote) *model.AppError {
+	quotes, trash, sortErr := sortedReplacement(lastID, quotes, trash)
+	if sortErr != nil {
+		return s.newError("Unable to replace quotes.", sortErr.Error(), "Replace")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	oldLastID, _, err := s.loadLastID()
+	if err != nil {
+		return err
+	}
+
+	// The word index is rebuilt the next time someone searches.
+	err = s.api.KVDelete(s.key(wordIndexedKey))
+	if err != nil {
+		return err
+	}
+
+	// Out with the old...
+	kept := make(map[int]bool)
+	for _, quote := range append(quotes, trash...) {
+		kept[quote.ID] = true
+	}
+	for id := 1; id <= oldLastID; id++ {
+		if kept[id] == false {
+			err = s.api.KVDelete(s.key(quoteKey(id)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// ...and in with the new.
+	pages := make(map[int][]int)
+	for page := 0; page*quoteIndexPageSize < oldLastID || page*quoteIndexPageSize < lastID; page++ {
+		pages[page] = []int{}
+	}
+	for idx := range quotes {
+		err = s.saveQuote(quotes[idx])
+		if err != nil {
+			return err
+		}
+
+		page := quoteIndexPage(quotes[idx].ID)
+		pages[page] = append(pages[page], quotes[idx].ID)
+	}
+
+	var trashIDs []int
+	for idx := range trash {
+		err = s.saveQuote(trash[idx])
+		if err != nil {
+			return err
+		}
+
+		trashIDs = append(trashIDs, trash[idx].ID)
+	}
+
+	for page, ids := range pages {
+		err = s.setIDList(s.key(quoteIndexKey(page)), ids)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.setIDList(s.key(quoteTrashKey), trashIDs)
+	if err != nil {
+		return err
+	}
+
+	return s.api.KVSet(s.key(lastQuoteIDKey), []byte(strconv.Itoa(lastID)))
+}
+
+// Restore - Take the quote with the given ID out of the trash. Returns false
+// if it wasn't in the trash.
+func (s *KVQuoteStore) Restore(id int) (bool, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	found, err := s.updateIDList(s.key(quoteTrashKey), func(ids []int) ([]int, bool) {
+		return removeID(ids, id)
+	})
+	if err != nil || found == false {
+		return false, err
+	}
+
+	quote, err := s.loadQuote(id)
+	if err != nil {
+		return false, err
+	}
+	if quote == nil {
+		s.api.LogWarn("Quote listed in the trash is missing.", "id", id)
+		return false, nil
+	}
+
+	quote.DeleteAt = 0
+	quote.DeletedBy = ""
+	err = s.saveQuote(*quote)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.updateIDList(s.key(quoteIndexKey(quoteIndexPage(id))), func(ids []int) ([]int, bool) {
+		return insertID(ids, id), true
+	})
+	if err != nil {
+		return false, err
+	}
+
+	s.indexWords(id, "", quote.Text)
+
+	return true, nil
+}
+
+// Trash - Every quote in the trash, in ID order.
+func (s *KVQuoteStore) Trash() ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids, _, err := s.loadIDList(s.key(quoteTrashKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.loadQuotes(ids)
+}
+
+// Update - Change the quote with the given ID with compare-and-set, retrying
+// if someone else changed it first. Returns false if nothing changed.
+func (s *KVQuoteStore) Update(id int, update func(quote *Quote) bool) (bool, *model.AppError) {
+	if id < 1 {
+		return false, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for try := 0; try < maxCompareAndSetTries; try++ {
+		quote, oldRaw, err := s.loadQuoteRaw(id)
+		if err != nil || quote == nil || quote.DeleteAt != 0 {
+			return false, err
+		}
+
+		oldText := quote.Text
+		if update(quote) == false {
+			return false, nil
+		}
+
+		newRaw, jsonErr := json.Marshal(quote)
+		if jsonErr != nil {
+			return false, s.newError("Unable to save quote.", fmt.Sprintf("json.Marshal(%v) failed.", quote), "Update")
+		}
+
+		ok, err := s.api.KVCompareAndSet(s.key(quoteKey(id)), oldRaw, newRaw)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			s.indexWords(id, oldText, quote.Text)
+			return true, nil
+		}
+	}
+
+	return false, s.newError("Unable to save quote.", fmt.Sprintf("Too many concurrent changes to quote %d.", id), "Update")
+}
+
+// -----------------------------------------------------------------------------
+// KVQuoteStore functions
+// -----------------------------------------------------------------------------
+
+// Migrate - Move quotes stored in the legacy "quotes" value into their own
+// keys.
+//
+// The legacy value is either a list of Quotes, or (from even older versions)
+// a list of strings. It's only removed once everything else is written, so an
+// interrupted migration just runs again next time.
+func (s *KVQuoteStore) Migrate() *model.AppError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	raw, err := s.api.KVGet(s.key(quotesKey))
+	if err != nil {
+		return s.newError("Unable to migrate quotes.", "API.KVGet() failed.", "Migrate")
+	}
+	if raw == nil {
+		// Nothing to migrate.
+		return nil
+	}
+
+	var quotes []Quote
+	loadErr := json.Unmarshal(raw, &quotes)
+	if loadErr != nil {
+		var legacy []string
+		legacyErr := json.Unmarshal(raw, &legacy)
+		if legacyErr != nil {
+			return s.newError("Unable to migrate quotes.", fmt.Sprintf("json.Unmarshal(%q) failed.", raw), "Migrate")
+		}
+
+		quotes = QuotesFromStrings(legacy)
+	}
+
+	s.api.LogInfo("Migrating quotes to per-quote storage.", "count", len(quotes))
+
+	// Quotes saved before we kept track of the last ID start counting from
+	// the highest ID on file.
+	lastID, _, err := s.loadLastID()
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[int][]int)
+	for idx := range quotes {
+		err = s.saveQuote(quotes[idx])
+		if err != nil {
+			return err
+		}
+
+		id := quotes[idx].ID
+		pages[quoteIndexPage(id)] = append(pages[quoteIndexPage(id)], id)
+		if id > lastID {
+			lastID = id
+		}
+	}
+
+	for page, ids := range pages {
+		sort.Ints(ids)
+		raw, jsonErr := json.Marshal(ids)
+		if jsonErr != nil {
+			return s.newError("Unable to migrate quotes.", fmt.Sprintf("json.Marshal(%v) failed.", ids), "Migrate")
+		}
+
+		err = s.api.KVSet(s.key(quoteIndexKey(page)), raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.api.KVSet(s.key(lastQuoteIDKey), []byte(strconv.Itoa(lastID)))
+	if err != nil {
+		return err
+	}
+
+	// The migrated quotes aren't in the word index yet, so have it rebuilt
+	// the next time someone searches.
+	indexed, err := s.isIndexed()
+	if err != nil {
+		return err
+	}
+	if indexed {
+		err = s.api.KVDelete(s.key(wordIndexedKey))
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.api.KVDelete(s.key(quotesKey))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	// Key-value store keys for the word index. Every word in a live quote,
+	// and the start of every word down to searchPrefixMinLength letters, has
+	// a key listing the IDs of the quotes with that word in them.
+	//
+	// Keys can only be 50 characters long, so the words are hashed; a
+	// collision just means Find looks at a few quotes it didn't need to.
+	wordIndexPrefix   string = "word_"
+	wordIndexedKey    string = "indexed_words" // Set once the word index has been built.
+	wordIndexListSize int    = 1000            // Keys per page when listing the old index.
+)
+
+var (
+	// Any collection's word index keys, with or without its prefix.
+	wordIndexKeyPattern = regexp.MustCompile(`(^|_)(` + wordIndexPrefix + `[0-9a-f]{8}|` + wordIndexedKey + `)$`)
+)
+
+// -----------------------------------------------------------------------------
+// Word index
+// -----------------------------------------------------------------------------
+
+// isWordIndexKey - Is key part of a collection's word index? The index can be
+// rebuilt from the quotes, so snapshots leave it out.
+func isWordIndexKey(key string) bool {
+	return wordIndexKeyPattern.MatchString(key)
+}
+
+// wordKey - The key-value store key (without the collection's prefix) for a
+// word in the word index.
+func wordKey(word string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(word))
+
+	return fmt.Sprintf("%s%08x", wordIndexPrefix, hash.Sum32())
+}
+
+// wordKeys - The word index keys for text: one for each word, and one for
+// the start of each word down to searchPrefixMinLength letters.
+func wordKeys(text string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, token := range searchTokens(text) {
+		keys[wordKey(token.word)] = true
+
+		word := []rune(token.word)
+		for length := searchPrefixMinLength; length < len(word); length++ {
+			keys[wordKey(string(word[:length]))] = true
+		}
+	}
+
+	return keys
+}
+
+// indexWords - Add a quote to the word index entries for newText, and take it
+// out of the ones for oldText that newText doesn't need. The caller must hold
+// the lock.
+//
+// If the index hasn't been built yet there's nothing to update; it'll have
+// this quote when it's built. If it can't be updated it's marked as needing a
+// rebuild, so the next search rebuilds it rather than missing quotes.
+func (s *KVQuoteStore) indexWords(id int, oldText string, newText string) {
+	indexed, err := s.isIndexed()
+	if err != nil || indexed == false {
+		return
+	}
+
+	oldKeys := wordKeys(oldText)
+	newKeys := wordKeys(newText)
+
+	for key := range oldKeys {
+		if newKeys[key] == false && err == nil {
+			_, err = s.updateIDList(s.key(key), func(ids []int) ([]int, bool) {
+				return removeID(ids, id)
+			})
+		}
+	}
+	for key := range newKeys {
+		if oldKeys[key] == false && err == nil {
+			_, err = s.updateIDList(s.key(key), func(ids []int) ([]int, bool) {
+				idx := sort.SearchInts(ids, id)
+				if idx < len(ids) && ids[idx] == id {
+					return ids, false
+				}
+
+				return insertID(ids, id), true
+			})
+		}
+	}
+
+	if err != nil {
+		s.api.LogWarn("Unable to update the word index, it'll be rebuilt.", "id", id, "error", err.Error())
+		s.api.KVDelete(s.key(wordIndexedKey))
+	}
+}
+
+// isIndexed - Has the word index been built?
+func (s *KVQuoteStore) isIndexed() (bool, *model.AppError) {
+	raw, err := s.api.KVGet(s.key(wordIndexedKey))
+	if err != nil {
+		return false, s.newError("Unable to load the word index.", "API.KVGet() failed.", "isIndexed")
+	}
+
+	return raw != nil, nil
+}
+
+// reindex - Throw away the word index and build it again from the quotes. The
+// caller must hold the lock.
+func (s *KVQuoteStore) reindex() (int, *model.AppError) {
+	err := s.api.KVDelete(s.key(wordIndexedKey))
+	if err != nil {
+		return 0, err
+	}
+
+	// Collect the old keys before deleting any, so the pages don't shift
+	// under us.
+	prefix := s.key(wordIndexPrefix)
+	var oldKeys []string
+	for page := 0; ; page++ {
+		keys, err := s.api.KVList(page, wordIndexListSize)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				oldKeys = append(oldKeys, key)
+			}
+		}
+		if len(keys) < wordIndexListSize {
+			break
+		}
+	}
+	for _, key := range oldKeys {
+		err = s.api.KVDelete(key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+	quotes, err := s.loadQuotes(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	// Quotes are in ID order, so each key's IDs are too.
+	index := make(map[string][]int)
+	for idx := range quotes {
+		for key := range wordKeys(quotes[idx].Text) {
+			index[key] = append(index[key], quotes[idx].ID)
+		}
+	}
+	for key, ids := range index {
+		raw, jsonErr := json.Marshal(ids)
+		if jsonErr != nil {
+			return 0, s.newError("Unable to save the word index.", fmt.Sprintf("json.Marshal(%v) failed.", ids), "reindex")
+		}
+
+		err = s.api.KVSet(s.key(key), raw)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = s.api.KVSet(s.key(wordIndexedKey), []byte("1"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(quotes), nil
+}
+
+// find - Find quotes using the word index. The caller must hold the lock.
+func (s *KVQuoteStore) find(terms []string, minMatches int) ([]Quote, *model.AppError) {
+	if minMatches < 1 {
+		ids, err := s.ids()
+		if err != nil {
+			return nil, err
+		}
+
+		return s.loadQuotes(ids)
+	}
+
+	matches := make(map[int]int)
+	for _, term := range terms {
+		ids, _, err := s.loadIDList(s.key(wordKey(term)))
+		if err != nil {
+			return nil, s.newError("Unable to load the word index.", "An admin can fix it with /quote reindex.", "find")
+		}
+
+		for _, id := range ids {
+			matches[id]++
+		}
+	}
+
+	var ids []int
+	for id, count := range matches {
+		if count >= minMatches {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	quotes, err := s.loadQuotes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash collisions and quotes that changed since they were indexed can
+	// sneak in; only keep the ones that really match.
+	found := make([]Quote, 0, len(quotes))
+	for idx := range quotes {
+		if quotes[idx].DeleteAt == 0 && matchedTerms(quotes[idx].Text, terms) >= minMatches {
+			found = append(found, quotes[idx])
+		}
+	}
+
+	return found, nil
+}
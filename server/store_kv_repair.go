@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Repairs
+// -----------------------------------------------------------------------------
+
+// quoteKeyIDs - The IDs of every quote with a key in keys, live or in the
+// trash, in order. Keys that aren't our quotes are ignored.
+func (s *KVQuoteStore) quoteKeyIDs(keys []string) []int {
+	prefix := s.key(quoteKeyPrefix)
+
+	var ids []int
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) == false {
+			continue
+		}
+
+		// Index pages, the trash and so on share the prefix.
+		id, convErr := strconv.Atoi(strings.TrimPrefix(key, prefix))
+		if convErr == nil && id > 0 && key == s.key(quoteKey(id)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// Repair - Look for values we can't load, and repair them. keys has to have
+// every key the collection uses; anything else in it is ignored, so the
+// caller can list the key-value store once for every collection.
+//
+// Damaged quotes keep whatever can be salvaged of them, or are removed if
+// there's nothing left. Damaged lists (the index pages, the trash and the
+// last ID) are worked out again from the quotes. quarantine is called with
+// the original before anything is changed; if it fails, nothing is.
+func (s *KVQuoteStore) Repair(keys []string, quarantine func(key string, raw []byte, problem string) *model.AppError) *model.AppError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	changed := false
+
+	// Quotes from older versions that haven't been migrated yet.
+	legacy, err := s.api.KVGet(s.key(quotesKey))
+	if err != nil {
+		return s.newError("Unable to check quotes.", "API.KVGet() failed.", "Repair")
+	}
+	if legacy != nil {
+		var quotes []Quote
+		var texts []string
+		if json.Unmarshal(legacy, &quotes) != nil && json.Unmarshal(legacy, &texts) != nil {
+			quotes = salvageQuotes(legacy)
+			err = quarantine(s.key(quotesKey), legacy, fmt.Sprintf("The old list of quotes was damaged; salvaged %d quotes from it.", len(quotes)))
+			if err != nil {
+				return err
+			}
+
+			if len(quotes) == 0 {
+				err = s.api.KVDelete(s.key(quotesKey))
+			} else {
+				raw, jsonErr := json.Marshal(quotes)
+				if jsonErr != nil {
+					return s.newError("Unable to repair quotes.", fmt.Sprintf("json.Marshal(%v) failed.", quotes), "Repair")
+				}
+				err = s.api.KVSet(s.key(quotesKey), raw)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The quotes themselves.
+	ids := s.quoteKeyIDs(keys)
+
+	var live []int
+	var trash []int
+	var removed []int
+	maxID := 0
+	for _, id := range ids {
+		raw, err := s.api.KVGet(s.key(quoteKey(id)))
+		if err != nil {
+			return s.newError("Unable to check quotes.", "API.KVGet() failed.", "Repair")
+		}
+		if raw == nil {
+			continue
+		}
+
+		var quote Quote
+		if json.Unmarshal(raw, &quote) != nil {
+			salvaged := salvageQuote(raw)
+			if salvaged == nil {
+				err = quarantine(s.key(quoteKey(id)), raw, fmt.Sprintf("Quote %d was damaged beyond repair, and removed.", id))
+				if err != nil {
+					return err
+				}
+				err = s.api.KVDelete(s.key(quoteKey(id)))
+				if err != nil {
+					return err
+				}
+
+				removed = append(removed, id)
+				changed = true
+				continue
+			}
+
+			err = quarantine(s.key(quoteKey(id)), raw, fmt.Sprintf("Quote %d was damaged; kept what was left of it.", id))
+			if err != nil {
+				return err
+			}
+			quote = *salvaged
+			quote.ID = id
+			err = s.saveQuote(quote)
+			if err != nil {
+				return err
+			}
+
+			changed = true
+		}
+
+		if quote.DeleteAt == 0 {
+			live = append(live, id)
+		} else {
+			trash = append(trash, id)
+		}
+		if id > maxID {
+			maxID = id
+		}
+	}
+
+	// The last ID, which mustn't go backwards or we'd hand out IDs twice.
+	raw, err := s.api.KVGet(s.key(lastQuoteIDKey))
+	if err != nil {
+		return s.newError("Unable to check quotes.", "API.KVGet() failed.", "Repair")
+	}
+	lastID, convErr := strconv.Atoi(string(raw))
+	if raw != nil && convErr != nil {
+		err = quarantine(s.key(lastQuoteIDKey), raw, fmt.Sprintf("The last quote number was damaged; set it to %d, the highest one we have.", maxID))
+		if err != nil {
+			return err
+		}
+		lastID = 0
+	}
+	if lastID < maxID || (raw != nil && convErr != nil) {
+		err = s.api.KVSet(s.key(lastQuoteIDKey), []byte(strconv.Itoa(maxID)))
+		if err != nil {
+			return err
+		}
+		lastID = maxID
+	}
+
+	// The index pages and the trash. A damaged list is worked out again from
+	// the quotes; quotes we had to remove are taken out of the rest.
+	lists := map[string][]int{s.key(quoteTrashKey): trash}
+	for page := 0; page*quoteIndexPageSize < lastID; page++ {
+		var pageIDs []int
+		for _, id := range live {
+			if quoteIndexPage(id) == page {
+				pageIDs = append(pageIDs, id)
+			}
+		}
+		lists[s.key(quoteIndexKey(page))] = pageIDs
+	}
+	for key, ids := range lists {
+		raw, err := s.api.KVGet(key)
+		if err != nil {
+			return s.newError("Unable to check quotes.", "API.KVGet() failed.", "Repair")
+		}
+		if raw == nil {
+			continue
+		}
+
+		var listed []int
+		if json.Unmarshal(raw, &listed) != nil {
+			err = quarantine(key, raw, fmt.Sprintf("The list %q was damaged; made it again from the quotes.", key))
+			if err != nil {
+				return err
+			}
+			err = s.setIDList(key, ids)
+			if err != nil {
+				return err
+			}
+
+			changed = true
+			continue
+		}
+
+		for _, id := range removed {
+			_, err = s.updateIDList(key, func(ids []int) ([]int, bool) {
+				return removeID(ids, id)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The word index doesn't know about the repairs, so have it rebuilt the
+	// next time someone searches.
+	if changed {
+		indexed, err := s.isIndexed()
+		if err != nil {
+			return err
+		}
+		if indexed {
+			return s.api.KVDelete(s.key(wordIndexedKey))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost-server/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - KVQuoteStore functions
+// -----------------------------------------------------------------------------
+
+// TestKVQuoteStore - Run the common QuoteStore tests.
+func TestKVQuoteStore(t *testing.T) {
+	testQuoteStore(t, NewKVQuoteStore(initAPI(t, "normal", "mock", nil), sharedCollection))
+	testQuoteStore(t, NewKVQuoteStore(initAPI(t, "normal", "mock", nil), teamCollection("teamid")))
+}
+
+// TestKVQuoteStoreCollections - Collections keep their quotes to themselves.
+func TestKVQuoteStoreCollections(t *testing.T) {
+	api := initAPI(t, "normal", "mock", nil)
+	shared := NewKVQuoteStore(api, sharedCollection)
+	team := NewKVQuoteStore(api, teamCollection("teamid"))
+
+	shared.Add(Quote{Text: "shared quote"})
+	team.Add(Quote{Text: "team quote 1"})
+	team.Add(Quote{Text: "team quote 2"})
+
+	raw, _ := api.KVGet(quoteKey(1))
+	assert.Contains(t, string(raw), "shared quote")
+	raw, _ = api.KVGet("team_teamid_" + quoteKey(1))
+	assert.Contains(t, string(raw), "team quote 1")
+	raw, _ = api.KVGet("team_teamid_" + lastQuoteIDKey)
+	assert.EqualValues(t, string(raw), "2")
+
+	count, err := shared.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 1)
+	count, err = team.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 2)
+}
+
+// TestKVQuoteStoreWordIndex - Test the word index's key-value layout, and
+// rebuilding it.
+func TestKVQuoteStoreWordIndex(t *testing.T) {
+	api := initAPI(t, "normal", "mock", nil)
+	store := NewKVQuoteStore(api, sharedCollection)
+	team := NewKVQuoteStore(api, teamCollection("teamid"))
+
+	// It isn't built until someone searches.
+	store.Add(Quote{Text: "Lots of primes."})
+	store.Add(Quote{Text: "Prime time."})
+	team.Add(Quote{Text: "Team primes."})
+	raw, _ := api.KVGet(wordIndexedKey)
+	assert.Nil(t, raw)
+	raw, _ = api.KVGet(wordKey("prime"))
+	assert.Nil(t, raw)
+
+	quotes, err := store.Find([]string{"prime"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+	raw, _ = api.KVGet(wordIndexedKey)
+	assert.NotNil(t, raw)
+	raw, _ = api.KVGet(wordKey("prime"))
+	assert.EqualValues(t, string(raw), `[1,2]`)
+	raw, _ = api.KVGet(wordKey("primes"))
+	assert.EqualValues(t, string(raw), `[1]`)
+	raw, _ = api.KVGet(wordKey("pri"))
+	assert.EqualValues(t, string(raw), `[1,2]`)
+	raw, _ = api.KVGet(wordKey("pr"))
+	assert.Nil(t, raw)
+	raw, _ = api.KVGet(wordKey("of"))
+	assert.EqualValues(t, string(raw), `[1]`)
+
+	// Then it's kept up to date.
+	store.Add(Quote{Text: "Primetime."})
+	store.Delete(1, "userid")
+	raw, _ = api.KVGet(wordKey("prime"))
+	assert.EqualValues(t, string(raw), `[2,3]`)
+	raw, _ = api.KVGet(wordKey("primes"))
+	assert.EqualValues(t, string(raw), `[]`)
+
+	// Damage gets fixed by rebuilding it, without touching other collections.
+	team.Find([]string{"team"}, 1)
+	api.KVSet(wordKey("prime"), []byte("garbage"))
+	api.KVSet(wordKey("primes"), []byte(`[1]`))
+	_, err = store.Find([]string{"prime"}, 1)
+	assert.NotNil(t, err)
+
+	count, err := store.Reindex()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 2)
+	raw, _ = api.KVGet(wordKey("prime"))
+	assert.EqualValues(t, string(raw), `[2,3]`)
+	raw, _ = api.KVGet(wordKey("primes"))
+	assert.Nil(t, raw)
+	raw, _ = api.KVGet("team_teamid_" + wordKey("primes"))
+	assert.EqualValues(t, string(raw), `[1]`)
+
+	quotes, err = store.Find([]string{"prime"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+
+	// Migrating quotes means it has to be rebuilt.
+	api.KVSet(quotesKey, []byte(`["Prime suspect."]`))
+	assert.Nil(t, store.Migrate())
+	raw, _ = api.KVGet(wordIndexedKey)
+	assert.Nil(t, raw)
+
+	// Snapshots can tell the index apart from everything else.
+	assert.True(t, isWordIndexKey(wordKey("prime")))
+	assert.True(t, isWordIndexKey("team_teamid_"+wordKey("prime")))
+	assert.True(t, isWordIndexKey("channel_channelid_"+wordIndexedKey))
+	assert.False(t, isWordIndexKey("team_teamid_"+quoteKey(1)))
+	assert.False(t, isWordIndexKey("team_teamid_"+lastQuoteIDKey))
+}
+
+// TestKVQuoteStoreAdd - Test the key-value layout of added and deleted quotes.
+func TestKVQuoteStoreAdd(t *testing.T) {
+	api := initAPI(t, "normal", "mock", nil)
+	store := NewKVQuoteStore(api, sharedCollection)
+
+	quote, err := store.Add(Quote{Text: "quote 1"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 1)
+	quote, err = store.Add(Quote{Text: "quote 2"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 2)
+
+	raw, _ := api.KVGet(quoteIndexKey(0))
+	assert.EqualValues(t, string(raw), `[1,2]`)
+	raw, _ = api.KVGet(quoteKey(2))
+	assert.Contains(t, string(raw), `"text":"quote 2"`)
+	raw, _ = api.KVGet(lastQuoteIDKey)
+	assert.EqualValues(t, string(raw), "2")
+
+	deleted, err := store.Delete(1, "userid")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	deleted, err = store.Delete(1, "userid")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	deleted, err = store.Delete(0, "userid")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+
+	// Deleted quotes stay put, but move from the index to the trash.
+	raw, _ = api.KVGet(quoteIndexKey(0))
+	assert.EqualValues(t, string(raw), `[2]`)
+	raw, _ = api.KVGet(quoteTrashKey)
+	assert.EqualValues(t, string(raw), `[1]`)
+	raw, _ = api.KVGet(quoteKey(1))
+	assert.Contains(t, string(raw), `"deleted_by":"userid"`)
+
+	restored, err := store.Restore(1)
+	assert.Nil(t, err)
+	assert.True(t, restored)
+	raw, _ = api.KVGet(quoteIndexKey(0))
+	assert.EqualValues(t, string(raw), `[1,2]`)
+	raw, _ = api.KVGet(quoteTrashKey)
+	assert.EqualValues(t, string(raw), `[]`)
+	raw, _ = api.KVGet(quoteKey(1))
+	assert.NotContains(t, string(raw), `"deleted_by"`)
+
+	// Purged quotes are gone for good.
+	store.Delete(1, "userid")
+	purged, err := store.Purge(model.GetMillis() + 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, purged, 1)
+	raw, _ = api.KVGet(quoteTrashKey)
+	assert.EqualValues(t, string(raw), `[]`)
+	raw, _ = api.KVGet(quoteKey(1))
+	assert.Nil(t, raw)
+
+	// IDs aren't reused.
+	quote, err = store.Add(Quote{Text: "quote 3"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 3)
+
+	found, err := store.Get(1)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote 3")
+
+	count, err := store.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 2)
+	lastID, err := store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 3)
+}
+
+// TestKVQuoteStoreCompareAndSet - Test that lost compare-and-set races are
+// retried.
+func TestKVQuoteStoreCompareAndSet(t *testing.T) {
+	api, kv := initKVAPI(t, "normal", "mock", nil)
+	store := NewKVQuoteStore(api, sharedCollection)
+
+	// Another server sneaks in a quote between our read and our write.
+	api.KVSet(lastQuoteIDKey, []byte("1"))
+	api.KVSet(quoteIndexKey(0), []byte(`[1]`))
+	kv.race = func(key string) {
+		if key == lastQuoteIDKey {
+			kv.data[lastQuoteIDKey] = []byte("2")
+			kv.race = nil
+		}
+	}
+
+	quote, err := store.Add(Quote{Text: "quote 3"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 3)
+
+	raw, _ := api.KVGet(quoteIndexKey(0))
+	assert.EqualValues(t, string(raw), `[1,3]`)
+
+	// Another server edits the quote between our read and our write.
+	kv.race = func(key string) {
+		if key == quoteKey(3) {
+			kv.data[key] = []byte(`{"id":3,"text":"quote three"}`)
+			kv.race = nil
+		}
+	}
+
+	tries := 0
+	updated, err := store.Update(3, func(quote *Quote) bool {
+		tries++
+		return quote.Revise(quote.Text+"!", "userid")
+	})
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	assert.EqualValues(t, tries, 2)
+
+	found, err := store.Get(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote three!")
+	assert.EqualValues(t, found.Revisions[0].Text, "quote three")
+}
+
+// TestKVQuoteStoreList - Test listing quotes.
+func TestKVQuoteStoreList(t *testing.T) {
+	api := initAPI(t, "normal", "mock", nil)
+	store := NewKVQuoteStore(api, sharedCollection)
+
+	quotes, err := store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 0)
+
+	// A gap where quote 2 was deleted.
+	api.KVSet(lastQuoteIDKey, []byte("3"))
+	api.KVSet(quoteIndexKey(0), []byte(`[1,3]`))
+	api.KVSet(quoteKey(1), []byte(`{"id":1,"text":"quote 1","author":"Someone","user_id":"userid"}`))
+	api.KVSet(quoteKey(3), []byte(`{"id":3,"text":"quote 3"}`))
+
+	quotes, err = store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].Author, "Someone")
+	assert.EqualValues(t, quotes[1].ID, 3)
+
+	// Index pages are read all the way up to the last ID.
+	api.KVSet(lastQuoteIDKey, []byte("501"))
+	api.KVSet(quoteIndexKey(1), []byte(`[501]`))
+	api.KVSet(quoteKey(501), []byte(`{"id":501,"text":"quote 501"}`))
+
+	ids, err := store.IDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, ids, []int{1, 3, 501})
+
+	api.KVSet(quoteIndexKey(0), []byte(`{"not": "an index"}`))
+	_, err = store.List()
+	assert.NotNil(t, err)
+}
+
+// TestKVQuoteStoreMigrate - Test migrating the legacy "quotes" value.
+func TestKVQuoteStoreMigrate(t *testing.T) {
+	api := initAPI(t, "normal", "mock", nil)
+	store := NewKVQuoteStore(api, sharedCollection)
+	assert.Nil(t, store.Migrate())
+	api.AssertNotCalled(t, "KVDelete", mock.Anything)
+
+	// Legacy strings get migrated.
+	api = initAPI(t, "normal", "mock", []byte(`["quote 1", "quote 2"]`))
+	store = NewKVQuoteStore(api, sharedCollection)
+	assert.Nil(t, store.Migrate())
+	quotes, err := store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[1].ID, 2)
+	assert.EqualValues(t, quotes[1].Text, "quote 2")
+	api.AssertCalled(t, "KVSet", quoteKey(2), []byte(`{"id":2,"text":"quote 2","author":"","user_id":"","create_at":0,"channel_id":"","team_id":"","post_id":""}`))
+	api.AssertCalled(t, "KVSet", quoteIndexKey(0), []byte(`[1,2]`))
+	api.AssertCalled(t, "KVSet", lastQuoteIDKey, []byte("2"))
+	api.AssertCalled(t, "KVDelete", quotesKey)
+
+	// So do legacy Quotes, but only once.
+	api = initAPI(t, "normal", "mock", []byte(`[{"id":1,"text":"quote 1","author":"Someone","user_id":"userid"}]`))
+	store = NewKVQuoteStore(api, sharedCollection)
+	assert.Nil(t, store.Migrate())
+	assert.Nil(t, store.Migrate())
+	quotes, err = store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 1)
+	assert.EqualValues(t, quotes[0].Author, "Someone")
+	api.AssertNumberOfCalls(t, "KVDelete", 1)
+
+	// The last ID survives even if the quotes that used it don't.
+	api = initAPI(t, "normal", "mock", []byte(`[{"id":2,"text":"quote 2"}]`))
+	api.KVSet(lastQuoteIDKey, []byte("5"))
+	store = NewKVQuoteStore(api, sharedCollection)
+	assert.Nil(t, store.Migrate())
+	quote, err := store.Add(Quote{Text: "quote 6"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 6)
+
+	api = initAPI(t, "normal", "mock", []byte(`{"not": "quotes"}`))
+	store = NewKVQuoteStore(api, sharedCollection)
+	assert.NotNil(t, store.Migrate())
+	api.AssertNotCalled(t, "KVDelete", mock.Anything)
+}
+
+// TestKVQuoteStoreConcurrency - Hammer the store with concurrent commands. Run
+// this with -race.
+func TestKVQuoteStoreConcurrency(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+
+	const numQuotes = 50
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < numQuotes; idx++ {
+		wg.Add(3)
+		go func(idx int) {
+			defer wg.Done()
+			resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs(fmt.Sprintf("/quote add quote %d", idx)))
+			assert.Nil(t, err)
+			assert.NotNil(t, resp)
+		}(idx)
+		go func() {
+			defer wg.Done()
+			_, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote"))
+			assert.Nil(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs("/quote list"))
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	ids, err := p.Store("teamid").IDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(ids), numQuotes)
+	for idx := range ids {
+		assert.EqualValues(t, ids[idx], idx+1)
+	}
+
+	// Delete every other one while adding more.
+	for idx := 1; idx <= numQuotes; idx += 2 {
+		wg.Add(2)
+		go func(idx int) {
+			defer wg.Done()
+			resp, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs(fmt.Sprintf("/quote delete %d", idx)))
+			assert.Nil(t, err)
+			assert.NotNil(t, resp)
+		}(idx)
+		go func(idx int) {
+			defer wg.Done()
+			_, err := p.ExecuteCommand(&plugin.Context{}, testCommandArgs(fmt.Sprintf("/quote add another quote %d", idx)))
+			assert.Nil(t, err)
+		}(idx)
+	}
+	wg.Wait()
+
+	count, err := p.Store("teamid").Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, numQuotes)
+	lastID, err := p.Store("teamid").LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, numQuotes+numQuotes/2)
+}
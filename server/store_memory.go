@@ -0,0 +1,330 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// MemoryQuoteStore - Keeps the quotes in memory. Handy for tests.
+type MemoryQuoteStore struct {
+	lock   sync.RWMutex
+	quotes []Quote // In ID order.
+	trash  []Quote // In ID order.
+	lastID int
+
+	// If set, called with the lock held after every change.
+	changed func() *model.AppError
+}
+
+// NewMemoryQuoteStore - Create an empty MemoryQuoteStore.
+func NewMemoryQuoteStore() *MemoryQuoteStore {
+	return &MemoryQuoteStore{}
+}
+
+// findQuote - Find the index of the quote with the given ID in quotes, or -1
+// if there isn't one.
+func findQuote(quotes []Quote, id int) int {
+	for idx := range quotes {
+		if quotes[idx].ID == id {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// insertQuote - Insert a quote into a list of quotes, keeping it in ID order.
+func insertQuote(quotes []Quote, quote Quote) []Quote {
+	idx := sort.Search(len(quotes), func(idx int) bool {
+		return quotes[idx].ID > quote.ID
+	})
+
+	quotes = append(quotes, Quote{})
+	copy(quotes[idx+1:], quotes[idx:])
+	quotes[idx] = quote
+
+	return quotes
+}
+
+// memoryState - Everything a change can touch, so a change that can't be saved
+// can be put back.
+type memoryState struct {
+	quotes []Quote
+	trash  []Quote
+	lastID int
+}
+
+// state - Copy everything a change can touch. The caller must hold the lock.
+func (s *MemoryQuoteStore) state() memoryState {
+	return memoryState{
+		quotes: append([]Quote(nil), s.quotes...),
+		trash:  append([]Quote(nil), s.trash...),
+		lastID: s.lastID,
+	}
+}
+
+// change - Let whoever's interested know something changed. If they can't
+// keep up (a FileQuoteStore that can't write its file), everything goes back
+// to the way it was before, so we don't say we have quotes that weren't saved.
+// The caller must hold the lock.
+func (s *MemoryQuoteStore) change(old memoryState) *model.AppError {
+	if s.changed == nil {
+		return nil
+	}
+
+	err := s.changed()
+	if err != nil {
+		s.quotes = old.quotes
+		s.trash = old.trash
+		s.lastID = old.lastID
+	}
+
+	return err
+}
+
+// -----------------------------------------------------------------------------
+// QuoteStore interface
+// -----------------------------------------------------------------------------
+
+// Add - Add a quote, giving it the next ID. Returns the quote as it was saved.
+func (s *MemoryQuoteStore) Add(quote Quote) (Quote, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	old := s.state()
+	s.lastID++
+	quote.ID = s.lastID
+	s.quotes = append(s.quotes, quote)
+
+	err := s.change(old)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return quote, nil
+}
+
+// Count - The number of quotes on file.
+func (s *MemoryQuoteStore) Count() (int, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.quotes), nil
+}
+
+// Delete - Move the quote with the given ID to the trash. Returns false if
+// there wasn't one to delete.
+func (s *MemoryQuoteStore) Delete(id int, userID string) (bool, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	idx := findQuote(s.quotes, id)
+	if idx < 0 {
+		return false, nil
+	}
+
+	old := s.state()
+	quote := s.quotes[idx]
+	quote.DeleteAt = model.GetMillis()
+	quote.DeletedBy = userID
+
+	s.quotes = append(s.quotes[:idx], s.quotes[idx+1:]...)
+	s.trash = insertQuote(s.trash, quote)
+
+	err := s.change(old)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Find - Every quote with words matching at least minMatches of the search
+// terms, in ID order.
+func (s *MemoryQuoteStore) Find(terms []string, minMatches int) ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var quotes []Quote
+	for idx := range s.quotes {
+		if matchedTerms(s.quotes[idx].Text, terms) >= minMatches {
+			quotes = append(quotes, s.quotes[idx])
+		}
+	}
+
+	return quotes, nil
+}
+
+// Get - Get the quote with the given ID, or nil if there isn't one.
+func (s *MemoryQuoteStore) Get(id int) (*Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	idx := findQuote(s.quotes, id)
+	if idx < 0 {
+		return nil, nil
+	}
+
+	quote := s.quotes[idx]
+
+	return &quote, nil
+}
+
+// IDs - The IDs of every quote, in order.
+func (s *MemoryQuoteStore) IDs() ([]int, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids := make([]int, 0, len(s.quotes))
+	for idx := range s.quotes {
+		ids = append(ids, s.quotes[idx].ID)
+	}
+
+	return ids, nil
+}
+
+// LastID - The last quote ID handed out.
+func (s *MemoryQuoteStore) LastID() (int, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.lastID, nil
+}
+
+// List - Every quote, in ID order.
+func (s *MemoryQuoteStore) List() ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	quotes := make([]Quote, len(s.quotes))
+	copy(quotes, s.quotes)
+
+	return quotes, nil
+}
+
+// Purge - Permanently delete quotes that went in the trash before the given
+// time.
+func (s *MemoryQuoteStore) Purge(before int64) (int, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	kept := make([]Quote, 0, len(s.trash))
+	for idx := range s.trash {
+		if s.trash[idx].DeleteAt >= before {
+			kept = append(kept, s.trash[idx])
+		}
+	}
+
+	purged := len(s.trash) - len(kept)
+	if purged == 0 {
+		return 0, nil
+	}
+
+	old := s.state()
+	s.trash = kept
+
+	err := s.change(old)
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// Reindex - There's no index to rebuild; Find looks at every quote.
+func (s *MemoryQuoteStore) Reindex() (int, *model.AppError) {
+	return s.Count()
+}
+
+// Replace - Throw away everything in the store and put quotes and trash in
+// its place.
+func (s *MemoryQuoteStore) Replace(lastID int, quotes []Quote, trash []Quote) *model.AppError {
+	quotes, trash, err := sortedReplacement(lastID, quotes, trash)
+	if err != nil {
+		return &model.AppError{
+			Message:       "Unable to replace quotes.",
+			DetailedError: err.Error(),
+			Where:         "MemoryQuoteStore.Replace",
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	old := s.state()
+	s.quotes = quotes
+	s.trash = trash
+	s.lastID = lastID
+
+	return s.change(old)
+}
+
+// Restore - Take the quote with the given ID out of the trash. Returns false
+// if it wasn't in the trash.
+func (s *MemoryQuoteStore) Restore(id int) (bool, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	idx := findQuote(s.trash, id)
+	if idx < 0 {
+		return false, nil
+	}
+
+	old := s.state()
+	quote := s.trash[idx]
+	quote.DeleteAt = 0
+	quote.DeletedBy = ""
+
+	s.trash = append(s.trash[:idx], s.trash[idx+1:]...)
+	s.quotes = insertQuote(s.quotes, quote)
+
+	err := s.change(old)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Trash - Every quote in the trash, in ID order.
+func (s *MemoryQuoteStore) Trash() ([]Quote, *model.AppError) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	quotes := make([]Quote, len(s.trash))
+	copy(quotes, s.trash)
+
+	return quotes, nil
+}
+
+// Update - Change the quote with the given ID. Returns false if nothing
+// changed.
+func (s *MemoryQuoteStore) Update(id int, update func(quote *Quote) bool) (bool, *model.AppError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	idx := findQuote(s.quotes, id)
+	if idx < 0 {
+		return false, nil
+	}
+
+	quote := s.quotes[idx]
+	quote.Revisions = append([]Revision(nil), quote.Revisions...)
+	quote.Tags = append([]string(nil), quote.Tags...)
+	quote.Speakers = append([]Speaker(nil), quote.Speakers...)
+	if update(&quote) == false {
+		return false, nil
+	}
+
+	old := s.state()
+	s.quotes[idx] = quote
+
+	err := s.change(old)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
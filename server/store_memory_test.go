@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - MemoryQuoteStore functions
+// -----------------------------------------------------------------------------
+
+// TestMemoryQuoteStore - Run the common QuoteStore tests.
+func TestMemoryQuoteStore(t *testing.T) {
+	testQuoteStore(t, NewMemoryQuoteStore())
+}
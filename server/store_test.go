@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Test support utilities
+// -----------------------------------------------------------------------------
+
+// testQuoteStore - Tests every QuoteStore implementation has to pass. The store
+// has to start out empty.
+func testQuoteStore(t *testing.T, store QuoteStore) {
+	count, err := store.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 0)
+	lastID, err := store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 0)
+	quotes, err := store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 0)
+
+	quote, err := store.Add(Quote{ID: 42, Text: "quote 1", UserID: "userid"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 1) // The store picks the ID.
+	quote, err = store.Add(Quote{Text: "quote 2"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 2)
+
+	found, err := store.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote 1")
+	assert.EqualValues(t, found.UserID, "userid")
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	// Deleted IDs aren't reused.
+	deleted, err := store.Delete(1, "userid")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	deleted, err = store.Delete(1, "userid")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	deleted, err = store.Delete(0, "userid")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+
+	quote, err = store.Add(Quote{Text: "quote 3"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 3)
+
+	found, err = store.Get(1)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	ids, err := store.IDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, ids, []int{2, 3})
+	quotes, err = store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 2)
+	assert.EqualValues(t, quotes[0].Text, "quote 2")
+	assert.EqualValues(t, quotes[1].Text, "quote 3")
+	count, err = store.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 2)
+	lastID, err = store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 3)
+
+	// Changing what we got back doesn't change what's stored.
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	found.Text = "changed"
+	quotes[0].Text = "changed"
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote 3")
+	found, err = store.Get(2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote 2")
+
+	// The trash.
+	trash, err := store.Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 1)
+	assert.EqualValues(t, trash[0].ID, 1)
+	assert.EqualValues(t, trash[0].Text, "quote 1")
+	assert.EqualValues(t, trash[0].DeletedBy, "userid")
+	assert.NotEqual(t, trash[0].DeleteAt, 0)
+
+	restored, err := store.Restore(2)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+	restored, err = store.Restore(1)
+	assert.Nil(t, err)
+	assert.True(t, restored)
+	restored, err = store.Restore(1)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+
+	found, err = store.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote 1")
+	assert.EqualValues(t, found.DeleteAt, 0)
+	assert.EqualValues(t, found.DeletedBy, "")
+	ids, err = store.IDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, ids, []int{1, 2, 3})
+	trash, err = store.Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 0)
+
+	// Purging only gets rid of quotes that have been in the trash long enough.
+	store.Delete(1, "userid")
+	store.Delete(2, "userid")
+	trash, err = store.Trash()
+	assert.Nil(t, err)
+	purged, err := store.Purge(trash[0].DeleteAt)
+	assert.Nil(t, err)
+	assert.EqualValues(t, purged, 0)
+	purged, err = store.Purge(trash[1].DeleteAt + 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, purged, 2)
+	trash, err = store.Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(trash), 0)
+	restored, err = store.Restore(1)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+
+	store.Restore(2) // Too late.
+	quote, err = store.Add(Quote{Text: "quote 4"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 4)
+
+	// Updates.
+	updated, err := store.Update(3, func(quote *Quote) bool {
+		return quote.Revise("quote three", "editor")
+	})
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Text, "quote three")
+	assert.EqualValues(t, found.EditedBy, "editor")
+	assert.EqualValues(t, len(found.Revisions), 1)
+	assert.EqualValues(t, found.Revisions[0].Text, "quote 3")
+
+	updated, err = store.Update(3, func(quote *Quote) bool {
+		return quote.Revise("quote three", "editor")
+	})
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = store.Update(1, func(quote *Quote) bool {
+		return quote.Revise("quote one", "editor")
+	})
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	// Changing the copy we were given doesn't change the store.
+	store.Update(3, func(quote *Quote) bool {
+		quote.Revisions[0].Text = "changed"
+		return false
+	})
+	found, err = store.Get(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, found.Revisions[0].Text, "quote 3")
+
+	store.Delete(3, "userid")
+	updated, err = store.Update(3, func(quote *Quote) bool {
+		return quote.Revise("quote 3", "editor")
+	})
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	store.Restore(3)
+
+	// Concurrent changes don't lose anything. Run this with -race.
+	var wg sync.WaitGroup
+	for idx := 0; idx < 20; idx++ {
+		wg.Add(2)
+		go func(idx int) {
+			defer wg.Done()
+			_, err := store.Add(Quote{Text: fmt.Sprintf("quote %d", idx)})
+			assert.Nil(t, err)
+		}(idx)
+		go func() {
+			defer wg.Done()
+			_, err := store.List()
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	count, err = store.Count()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 22)
+	lastID, err = store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, lastID, 24)
+
+	// Finding quotes by their words.
+	testQuoteStoreFind(t, store)
+	count, err = store.Reindex()
+	assert.Nil(t, err)
+	assert.EqualValues(t, count, 22)
+	testQuoteStoreFind(t, store)
+
+	// Replacing everything, and putting it back exactly.
+	testQuoteStoreReplace(t, store)
+}
+
+// testQuoteStoreReplace - Tests for QuoteStore.Replace. The store is left the
+// way it was.
+func testQuoteStoreReplace(t *testing.T, store QuoteStore) {
+	quotes, err := store.List()
+	assert.Nil(t, err)
+	trash, err := store.Trash()
+	assert.Nil(t, err)
+	lastID, err := store.LastID()
+	assert.Nil(t, err)
+
+	err = store.Replace(3, []Quote{{ID: 3, Text: "quote 3"}, {ID: 1, Text: "quote 1"}}, []Quote{{ID: 2, Text: "quote 2", DeleteAt: 1}})
+	assert.Nil(t, err)
+	replaced, err := store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replaced, []Quote{{ID: 1, Text: "quote 1"}, {ID: 3, Text: "quote 3"}})
+	replacedTrash, err := store.Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replacedTrash, []Quote{{ID: 2, Text: "quote 2", DeleteAt: 1}})
+	replacedID, err := store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replacedID, 3)
+	found, err := store.Find([]string{"quote"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(found), 2)
+	quote, err := store.Add(Quote{Text: "quote 4"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, quote.ID, 4)
+
+	// Things that can't have come from a store.
+	err = store.Replace(3, []Quote{{ID: 4, Text: "quote 4"}}, nil)
+	assert.NotNil(t, err)
+	err = store.Replace(3, []Quote{{ID: 1, Text: "quote 1"}}, []Quote{{ID: 1, Text: "quote 1", DeleteAt: 1}})
+	assert.NotNil(t, err)
+	err = store.Replace(3, []Quote{{ID: 1, Text: "quote 1", DeleteAt: 1}}, nil)
+	assert.NotNil(t, err)
+	err = store.Replace(3, nil, []Quote{{ID: 1, Text: "quote 1"}})
+	assert.NotNil(t, err)
+
+	err = store.Replace(lastID, quotes, trash)
+	assert.Nil(t, err)
+	replaced, err = store.List()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replaced, quotes)
+	replacedTrash, err = store.Trash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replacedTrash, trash)
+	replacedID, err = store.LastID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, replacedID, lastID)
+	found, err = store.Find([]string{"three"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(found), 1)
+}
+
+// testQuoteStoreFind - Tests for QuoteStore.Find, which has to keep up with
+// changes to the quotes. The store has to have testQuoteStore's quotes in it.
+func testQuoteStoreFind(t *testing.T, store QuoteStore) {
+	quotes, err := store.Find([]string{"three"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 1)
+	assert.EqualValues(t, quotes[0].ID, 3)
+
+	quotes, err = store.Find([]string{"quo"}, 1) // The start of a word.
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 22)
+	quotes, err = store.Find([]string{"qu"}, 1) // Too short to be the start of a word.
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 0)
+
+	quotes, err = store.Find([]string{"quote", "4", "three"}, 2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 3)
+	assert.EqualValues(t, quotes[0].ID, 3)
+	assert.EqualValues(t, quotes[1].ID, 4)
+	assert.EqualValues(t, quotes[2].Text, "quote 4")
+
+	// Adding, changing and deleting quotes.
+	quote, err := store.Add(Quote{Text: "A brand new quote."})
+	assert.Nil(t, err)
+	quotes, err = store.Find([]string{"brand"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 1)
+	assert.EqualValues(t, quotes[0].ID, quote.ID)
+
+	store.Update(quote.ID, func(quote *Quote) bool {
+		return quote.Revise("An old quote.", "editor")
+	})
+	quotes, err = store.Find([]string{"brand"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 0)
+	quotes, err = store.Find([]string{"old"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 1)
+
+	store.Delete(quote.ID, "userid")
+	quotes, err = store.Find([]string{"old"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 0)
+
+	store.Restore(quote.ID)
+	quotes, err = store.Find([]string{"old"}, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(quotes), 1)
+
+	store.Delete(quote.ID, "userid")
+}
+
+// -----------------------------------------------------------------------------
+// Tests - concurrency
+// -----------------------------------------------------------------------------
+
+// TestPostRandomConcurrency - Changing the channel and rolling back while
+// quotes are posted at random don't get in each other's way. Run this with
+// -race.
+func TestPostRandomConcurrency(t *testing.T) {
+	p := initTestPlugin(t, "system", "mock")
+	assert.Nil(t, p.OnActivate())
+	api := p.API.(*plugintest.API)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, (*model.AppError)(nil))
+	configuration := p.getConfiguration().Clone()
+	configuration.postDelta = 0 // Post every time.
+	p.setConfiguration(configuration)
+	p.AddQuote(testCommandArgs(""), "quote 1")
+	p.SetChannel("~town-square", "teamid")
+	_, err := p.Snapshot("before", "userid", "")
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			p.PostRandom()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := p.ExecuteCommand(nil, testCommandArgs("/quote channel ~town-square"))
+			assert.Nil(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := p.ExecuteCommand(nil, testCommandArgs("/quote rollback before"))
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	channelID, teamID := p.postTarget()
+	assert.EqualValues(t, channelID, "some ID string")
+	assert.EqualValues(t, teamID, "teamid")
+}
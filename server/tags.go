@@ -0,0 +1,103 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+var (
+	// A tag's name: letters, numbers, "-" and "_", starting with a letter so
+	// "#3" still means quote number 3.
+	tagPattern = regexp.MustCompile(`^\p{L}[\p{L}\p{N}_-]*$`)
+)
+
+// -----------------------------------------------------------------------------
+// Tags
+// -----------------------------------------------------------------------------
+
+// NormalizeTag - Turn "#Work" or "work" into "work". Returns "" if it isn't a
+// valid tag.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimPrefix(tag, "#")
+	if tagPattern.MatchString(tag) == false {
+		return ""
+	}
+
+	return strings.ToLower(tag)
+}
+
+// ParseTags - Take the hashtags off the start of text, so "#work #gus Hi!"
+// is tagged "work" and "gus" and says "Hi!". Hashtags after the text starts
+// are part of the text.
+func ParseTags(text string) ([]string, string) {
+	var tags []string
+	rest := strings.TrimLeftFunc(text, unicode.IsSpace)
+	for strings.HasPrefix(rest, "#") {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+
+		tag := NormalizeTag(rest[:end])
+		if tag == "" {
+			break
+		}
+
+		tags = addTag(tags, tag)
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+	}
+
+	return tags, rest
+}
+
+// FormatTags - Format tags for humans, like "#gus #work".
+func FormatTags(tags []string) string {
+	formatted := make([]string, 0, len(tags))
+	for idx := range tags {
+		formatted = append(formatted, "#"+tags[idx])
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// CountTags - How many of quotes have each tag.
+func CountTags(quotes []Quote) map[string]int {
+	counts := make(map[string]int)
+	for idx := range quotes {
+		for _, tag := range quotes[idx].Tags {
+			counts[tag]++
+		}
+	}
+
+	return counts
+}
+
+// addTag - Add tag to the sorted list of tags, if it isn't there already.
+func addTag(tags []string, tag string) []string {
+	idx := sort.SearchStrings(tags, tag)
+	if idx < len(tags) && tags[idx] == tag {
+		return tags
+	}
+
+	tags = append(tags, "")
+	copy(tags[idx+1:], tags[idx:])
+	tags[idx] = tag
+
+	return tags
+}
+
+// removeTag - Remove tag from the sorted list of tags, if it's there.
+func removeTag(tags []string, tag string) []string {
+	idx := sort.SearchStrings(tags, tag)
+	if idx == len(tags) || tags[idx] != tag {
+		return tags
+	}
+
+	return append(tags[:idx], tags[idx+1:]...)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalizeTag - Test the NormalizeTag function.
+func TestNormalizeTag(t *testing.T) {
+	assert.EqualValues(t, NormalizeTag("work"), "work")
+	assert.EqualValues(t, NormalizeTag("#Work"), "work")
+	assert.EqualValues(t, NormalizeTag("#dad-jokes_2"), "dad-jokes_2")
+	assert.EqualValues(t, NormalizeTag("#café"), "café")
+
+	assert.EqualValues(t, NormalizeTag(""), "")
+	assert.EqualValues(t, NormalizeTag("#"), "")
+	assert.EqualValues(t, NormalizeTag("#3"), "")
+	assert.EqualValues(t, NormalizeTag("#work!"), "")
+}
+
+// TestParseTags - Test the ParseTags function.
+func TestParseTags(t *testing.T) {
+	tags, rest := ParseTags("")
+	assert.Nil(t, tags)
+	assert.EqualValues(t, rest, "")
+
+	tags, rest = ParseTags("There's lots of primes! - Gus")
+	assert.Nil(t, tags)
+	assert.EqualValues(t, rest, "There's lots of primes! - Gus")
+
+	tags, rest = ParseTags(" #work #Gus  #work There's lots of primes! #math - Gus")
+	assert.EqualValues(t, tags, []string{"gus", "work"})
+	assert.EqualValues(t, rest, "There's lots of primes! #math - Gus")
+
+	tags, rest = ParseTags("#work #1 fan")
+	assert.EqualValues(t, tags, []string{"work"})
+	assert.EqualValues(t, rest, "#1 fan")
+}
+
+// TestFormatTags - Test the FormatTags function.
+func TestFormatTags(t *testing.T) {
+	assert.EqualValues(t, FormatTags(nil), "")
+	assert.EqualValues(t, FormatTags([]string{"gus", "work"}), "#gus #work")
+}
+
+// TestCountTags - Test the CountTags function.
+func TestCountTags(t *testing.T) {
+	assert.EqualValues(t, len(CountTags(nil)), 0)
+
+	counts := CountTags([]Quote{
+		{ID: 1, Tags: []string{"gus", "work"}},
+		{ID: 2},
+		{ID: 3, Tags: []string{"work"}},
+	})
+	assert.EqualValues(t, counts, map[string]int{"gus": 1, "work": 2})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Constants
+// -----------------------------------------------------------------------------
+
+const (
+	flagPrefix  string = "--"
+	endOfFlags  string = "--" // Everything after it is an argument, even if it looks like a flag.
+	escapeRune  rune   = '\\'
+	flagValueOp rune   = '='
+
+	// Quote marks, including the smart quotes chat clients like to swap in.
+	doubleQuotes string = "\"“”„"
+	singleQuotes string = "'‘’"
+)
+
+var (
+	// A flag's name: letters, numbers and "-".
+	flagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// Token - One word of a command's tail.
+type Token struct {
+	Text     string // The word, with its quote marks and escapes taken out.
+	Flag     string // For --flag or --flag=value, the flag's name in lowercase; "" for anything else.
+	Value    string // For --flag=value, the value.
+	HasValue bool   // Was there an =value?
+	Quoted   bool   // Was any of it quoted or escaped?
+	Column   int    // Where the word starts, counting from 1.
+}
+
+// TokenizeError - Why a command's tail couldn't be split into words, and
+// where.
+type TokenizeError struct {
+	Column  int    // Where the problem is, counting from 1.
+	Problem string // What the problem is.
+}
+
+// Error - Describe the problem, with its column.
+func (e *TokenizeError) Error() string {
+	return fmt.Sprintf("Column %d: %s", e.Column, e.Problem)
+}
+
+// -----------------------------------------------------------------------------
+// Tokenizing
+// -----------------------------------------------------------------------------
+
+// Tokenize - Split a command's tail into words, like a shell would.
+//
+// Words are separated by spaces. "Double quotes" and 'single quotes' keep a
+// word's spaces, and so do smart quotes pasted from a chat client. Quote
+// marks only start a quote at the start of a word, or of a flag's value, so
+// apostrophes like don't are left alone; for the same reason, a single quote
+// only ends a quote at the end of a word. A \ keeps the next character as it
+// is, except inside single quotes.
+//
+// Words starting with -- are flags, --name or --name=value. A -- on its own
+// means there are no more flags, so later words are arguments even if they
+// start with --.
+func Tokenize(tail string) ([]Token, *TokenizeError) {
+	runes := []rune(tail)
+	var tokens []Token
+	flags := true
+
+	for idx := 0; idx < len(runes); {
+		if unicode.IsSpace(runes[idx]) {
+			idx++
+			continue
+		}
+
+		start := idx
+		isFlag := flags && strings.HasPrefix(string(runes[idx:]), flagPrefix)
+		text, equals, quoted, next, err := readWord(runes, idx, isFlag)
+		if err != nil {
+			return nil, err
+		}
+		idx = next
+
+		if isFlag == false {
+			tokens = append(tokens, Token{Text: text, Quoted: quoted, Column: start + 1})
+			continue
+		}
+		if string(runes[start:next]) == endOfFlags {
+			flags = false
+			continue
+		}
+
+		token := Token{Text: text, Quoted: quoted, Column: start + 1}
+		name := text
+		if equals >= 0 {
+			name = string([]rune(text)[:equals])
+			token.Value = string([]rune(text)[equals+1:])
+			token.HasValue = true
+		}
+		token.Flag = strings.ToLower(strings.TrimPrefix(name, flagPrefix))
+		if flagNamePattern.MatchString(token.Flag) == false {
+			return nil, &TokenizeError{Column: start + 1,
+				Problem: fmt.Sprintf("%q isn't a flag; flags look like --name or --name=value. Put a -- before it if it isn't meant to be one.", name)}
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// readWord - Read the word starting at runes[start], up to the first space
+// that isn't quoted or escaped. Returns the word without its quote marks and
+// escapes, where in it a flag's first = is (or -1), whether any of it was
+// quoted or escaped, and where the next word might start.
+func readWord(runes []rune, start int, isFlag bool) (string, int, bool, int, *TokenizeError) {
+	var word []rune
+	equals := -1
+	quoted := false
+	idx := start
+
+	for idx < len(runes) && unicode.IsSpace(runes[idx]) == false {
+		r := runes[idx]
+
+		// Quotes can start the word, or a flag's value.
+		canQuote := idx == start || (isFlag && equals >= 0 && equals == len(word)-1 && runes[idx-1] == flagValueOp)
+		switch {
+		case r == escapeRune:
+			if idx+1 >= len(runes) {
+				return "", 0, false, 0, &TokenizeError{Column: idx + 1, Problem: "There's nothing after this \\ for it to keep."}
+			}
+			word = append(word, runes[idx+1])
+			quoted = true
+			idx += 2
+
+		case canQuote && strings.ContainsRune(doubleQuotes, r):
+			text, next, err := readDoubleQuoted(runes, idx)
+			if err != nil {
+				return "", 0, false, 0, err
+			}
+			word = append(word, text...)
+			quoted = true
+			idx = next
+
+		case canQuote && strings.ContainsRune(singleQuotes, r):
+			text, next, err := readSingleQuoted(runes, idx)
+			if err != nil {
+				return "", 0, false, 0, err
+			}
+			word = append(word, text...)
+			quoted = true
+			idx = next
+
+		default:
+			if isFlag && equals < 0 && r == flagValueOp {
+				equals = len(word)
+			}
+			word = append(word, r)
+			idx++
+		}
+	}
+
+	return string(word), equals, quoted, idx, nil
+}
+
+// readDoubleQuoted - Read the double-quoted text starting at runes[open], the
+// opening quote mark. Returns the text and where to carry on after the
+// closing quote mark.
+func readDoubleQuoted(runes []rune, open int) ([]rune, int, *TokenizeError) {
+	var text []rune
+	for idx := open + 1; idx < len(runes); idx++ {
+		r := runes[idx]
+		switch {
+		case strings.ContainsRune(doubleQuotes, r):
+			return text, idx + 1, nil
+
+		case r == escapeRune:
+			if idx+1 >= len(runes) {
+				return nil, 0, &TokenizeError{Column: idx + 1, Problem: "There's nothing after this \\ for it to keep."}
+			}
+			idx++
+			text = append(text, runes[idx])
+
+		default:
+			text = append(text, r)
+		}
+	}
+
+	return nil, 0, &TokenizeError{Column: open + 1, Problem: fmt.Sprintf("This %c is never closed.", runes[open])}
+}
+
+// readSingleQuoted - Read the single-quoted text starting at runes[open], the
+// opening quote mark. Only a quote mark at the end of a word closes it, so
+// 'don't' works. Returns the text and where to carry on after the closing
+// quote mark.
+func readSingleQuoted(runes []rune, open int) ([]rune, int, *TokenizeError) {
+	var text []rune
+	for idx := open + 1; idx < len(runes); idx++ {
+		r := runes[idx]
+		if strings.ContainsRune(singleQuotes, r) && (idx+1 == len(runes) || unicode.IsSpace(runes[idx+1])) {
+			return text, idx + 1, nil
+		}
+		text = append(text, r)
+	}
+
+	return nil, 0, &TokenizeError{Column: open + 1, Problem: fmt.Sprintf("This %c is never closed.", runes[open])}
+}
+
+// QuoteArgument - Quote text so Tokenize reads it back as one word, if it
+// needs to be.
+func QuoteArgument(text string) string {
+	if text != "" && strings.HasPrefix(text, flagPrefix) == false &&
+		strings.IndexFunc(text, func(r rune) bool {
+			return unicode.IsSpace(r) || r == escapeRune || strings.ContainsRune(doubleQuotes+singleQuotes, r)
+		}) < 0 {
+		return text
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "“", `\“`, "”", `\”`, "„", `\„`).Replace(text) + `"`
+}
+
+// commandTokens - Split a command's tail into words. If it can't be, the
+// response shows the command with where the problem is marked.
+func (p *QuotebotPlugin) commandTokens(args *model.CommandArgs, tail string) ([]Token, *model.CommandResponse) {
+	tokens, err := Tokenize(tail)
+	if err != nil {
+		return nil, p.unreadable(args, tail, err)
+	}
+
+	return tokens, nil
+}
+
+// unreadable - A response showing the command with where the problem with
+// its tail is marked.
+func (p *QuotebotPlugin) unreadable(args *model.CommandArgs, tail string, err *TokenizeError) *model.CommandResponse {
+	// Count columns in the whole command, since that's what was typed. The
+	// tail is usually the end of it.
+	command := strings.TrimRightFunc(args.Command, unicode.IsSpace)
+	column := err.Column
+	if strings.HasSuffix(command, tail) {
+		column += utf8.RuneCountInString(command) - utf8.RuneCountInString(tail)
+	} else {
+		command = tail
+	}
+
+	return p.NewResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		fmt.Sprintf("Quotebot couldn't read that. Column %d: %s\n```\n%s\n%s^\n```",
+			column, err.Problem, command, strings.Repeat(" ", column-1)))
+}
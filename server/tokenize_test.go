@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTokenize - Test the Tokenize function.
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		tail   string
+		tokens []Token
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"3 +work", []Token{{Text: "3", Column: 1}, {Text: "+work", Column: 3}}},
+		{`  "first trigger"   'second one'`, []Token{{Text: "first trigger", Quoted: true, Column: 3}, {Text: "second one", Quoted: true, Column: 21}}},
+		{`“smart quotes” ‘from chat’`, []Token{{Text: "smart quotes", Quoted: true, Column: 1}, {Text: "from chat", Quoted: true, Column: 16}}},
+		{`„low“ ”both closing”`, []Token{{Text: "low", Quoted: true, Column: 1}, {Text: "both closing", Quoted: true, Column: 7}}},
+		{`don't 'don't stop' it's`, []Token{{Text: "don't", Column: 1}, {Text: "don't stop", Quoted: true, Column: 7}, {Text: "it's", Column: 20}}},
+		{`"say \"hi\"" 'no \escapes' back\ slash \'tis`, []Token{{Text: `say "hi"`, Quoted: true, Column: 1}, {Text: `no \escapes`, Quoted: true, Column: 14}, {Text: "back slash", Quoted: true, Column: 28}, {Text: "'tis", Quoted: true, Column: 40}}},
+		{`"glued"on ""`, []Token{{Text: "gluedon", Quoted: true, Column: 1}, {Text: "", Quoted: true, Column: 11}}},
+		{`--here --Author="Gus M" --sort=newest --empty= x`, []Token{
+			{Text: "--here", Flag: "here", Column: 1},
+			{Text: "--Author=Gus M", Flag: "author", Value: "Gus M", HasValue: true, Quoted: true, Column: 8},
+			{Text: "--sort=newest", Flag: "sort", Value: "newest", HasValue: true, Column: 25},
+			{Text: "--empty=", Flag: "empty", Value: "", HasValue: true, Column: 39},
+			{Text: "x", Column: 48},
+		}},
+		{`--contains='a = b' "--not-a-flag"`, []Token{
+			{Text: "--contains=a = b", Flag: "contains", Value: "a = b", HasValue: true, Quoted: true, Column: 1},
+			{Text: "--not-a-flag", Quoted: true, Column: 20},
+		}},
+		{`--here -- --force -- "x"`, []Token{
+			{Text: "--here", Flag: "here", Column: 1},
+			{Text: "--force", Column: 11},
+			{Text: "--", Column: 19},
+			{Text: "x", Quoted: true, Column: 22},
+		}},
+		{`a --b`, []Token{{Text: "a", Column: 1}, {Text: "--b", Flag: "b", Column: 3}}},
+	}
+	for _, test := range tests {
+		tokens, err := Tokenize(test.tail)
+		assert.Nil(t, err, test.tail)
+		assert.EqualValues(t, tokens, test.tokens, test.tail)
+	}
+
+	errors := []struct {
+		tail   string
+		column int
+	}{
+		{`"never closed`, 1},
+		{`ok “never closed`, 4},
+		{`--author="never closed`, 10},
+		{`'never closed`, 1},
+		{`'not closed'either`, 1},
+		{`trailing \`, 10},
+		{`"trailing \`, 11},
+		{`--=x`, 1},
+		{`---x`, 1},
+		{`ok --b@d`, 4},
+	}
+	for _, test := range errors {
+		tokens, err := Tokenize(test.tail)
+		assert.Nil(t, tokens, test.tail)
+		if assert.NotNil(t, err, test.tail) {
+			assert.EqualValues(t, err.Column, test.column, test.tail)
+		}
+	}
+
+	_, err := Tokenize(`list "oops`)
+	assert.EqualValues(t, err.Error(), `Column 6: This " is never closed.`)
+}
+
+// TestCommandTokens - Problems are marked in the whole command.
+func TestCommandTokens(t *testing.T) {
+	p := initTestPlugin(t, "normal", "mock")
+
+	tokens, resp := p.commandTokens(testCommandArgs(`/quote list "Gus"`), `"Gus"`)
+	assert.Nil(t, resp)
+	assert.EqualValues(t, tokens, []Token{{Text: "Gus", Quoted: true, Column: 1}})
+
+	tokens, resp = p.commandTokens(testCommandArgs(`/quote list “Gus `), `“Gus`)
+	assert.Nil(t, tokens)
+	assert.EqualValues(t, resp.Text, "Quotebot couldn't read that. Column 13: This “ is never closed.\n```\n/quote list “Gus\n            ^\n```")
+
+	// If the tail was changed, only it is shown.
+	_, resp = p.commandTokens(testCommandArgs(`/quote list --x --here "Gus`), `--x "Gus`)
+	assert.EqualValues(t, resp.Text, "Quotebot couldn't read that. Column 5: This \" is never closed.\n```\n--x \"Gus\n    ^\n```")
+}
+
+// TestQuoteArgument - Quoted arguments are read back as they were.
+func TestQuoteArgument(t *testing.T) {
+	assert.EqualValues(t, QuoteArgument("Gus"), "Gus")
+	assert.EqualValues(t, QuoteArgument("so long"), `"so long"`)
+	assert.EqualValues(t, QuoteArgument(""), `""`)
+
+	for _, text := range []string{"Gus", "so long", "", `say "hi"`, `back\slash`, "it’s “smart”", "don't", "--here", "tab\there"} {
+		tokens, err := Tokenize("--x " + QuoteArgument(text))
+		assert.Nil(t, err, text)
+		if assert.EqualValues(t, len(tokens), 2, text) {
+			assert.EqualValues(t, tokens[1].Text, text)
+		}
+	}
+}